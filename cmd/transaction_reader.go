@@ -1,28 +1,623 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/gomisha/trade-journal/parse"
+	"io"
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// usage: go run cmd/transaction_reader.go --data "./testdata/input/1-dmc.csv"
+// usage:
+//
+//	go run cmd/transaction_reader.go import ./testdata/input/1-dmc.csv
+//	go run cmd/transaction_reader.go import ./statements/2023
+//	go run cmd/transaction_reader.go positions --account TFSA
+//	go run cmd/transaction_reader.go --data "./testdata/input/1-dmc.csv"
+const usage = `usage: transaction_reader <command> [flags] [statements]
+
+Commands:
+  import     add the transactions of IBKR activity statements (CSV) to the journal store
+  export     write the journal store as csv, xlsx, json, ndjson, beancount, ledger, ofx, qif or html
+  positions  show the open positions
+  pnl        show the realized P/L of the lots closed
+  dividends  show the dividends and withholding tax
+  validate   check the journal store, or statements, for problems
+  reconcile  check that the statements' transactions are in the journal store and their forex balances match
+
+Statements can be files, globs (e.g. "./statements/2023-*.csv") or directories, they're read in the order of their
+statement periods.
+
+Run "transaction_reader <command> -h" for the flags of a command.
+Without a command, --data reads a single statement and writes ./transactions.csv (run with -h for its flags).
+`
+
+// exit codes
+const (
+	exitFailure = 1 // e.g. validation problems, statements that can't be read
+	exitUsage   = 2 // invalid command or flags
+)
+
+var commands = map[string]func(args []string) int{
+	"import":    importCommand,
+	"export":    exportCommand,
+	"positions": positionsCommand,
+	"pnl":       pnlCommand,
+	"dividends": dividendsCommand,
+	"validate":  validateCommand,
+	"reconcile": reconcileCommand,
+}
+
 func main() {
-	dataFlag := flag.String("data", "", "Path to CSV data.")
+	if len(os.Args) > 1 && strings.HasPrefix(os.Args[1], "-") && os.Args[1] != "-h" && os.Args[1] != "--help" {
+		statementCommand()
+		return
+	}
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		fmt.Fprint(os.Stderr, usage)
+		if len(os.Args) < 2 {
+			os.Exit(exitUsage)
+		}
+		return
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(exitUsage)
+	}
+	os.Exit(command(os.Args[2:]))
+}
+
+// options are the flags shared by all the commands.
+type options struct {
+	store   string
+	account string
+	from    string
+	to      string
+	format  string
+	formats []string
+	args    []string // statements
+}
+
+// commandFlags returns the flags of a command with the shared flags, the first format is the default.
+func commandFlags(name string, arguments string, formats ...string) (*flag.FlagSet, *options) {
+	o := &options{formats: formats}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&o.store, "store", "./journal.ndjson", "Path to the journal store that statements are imported into.")
+	flags.StringVar(&o.account, "account", "", "Only keep transactions for this account alias or ID, all accounts by default.")
+	flags.StringVar(&o.from, "from", "", "First date (YYYY-MM-DD) of the transactions, no limit by default.")
+	flags.StringVar(&o.to, "to", "", "Last date (YYYY-MM-DD) of the transactions, no limit by default.")
+	if len(formats) > 0 {
+		flags.StringVar(&o.format, "format", formats[0], "Output format: "+strings.Join(formats, ", ")+".")
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: transaction_reader %s [flags] %s\n\nFlags:\n", name, arguments)
+		flags.PrintDefaults()
+	}
+	return flags, o
+}
+
+// parse parses the command's flags and checks the shared ones, returning the exit code when the command can't run.
+func (o *options) parse(flags *flag.FlagSet, args []string) (int, bool) {
+	// flags can come after the statements too
+	for {
+		if err := flags.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return 0, false
+			}
+			return exitUsage, false
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		o.args = append(o.args, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	for _, date := range []string{o.from, o.to} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			fmt.Fprintf(flags.Output(), "invalid date %q, expected YYYY-MM-DD\n", date)
+			return exitUsage, false
+		}
+	}
+	if len(o.formats) > 0 && !contains(o.formats, o.format) {
+		fmt.Fprintf(flags.Output(), "invalid format %q, expected one of %s\n", o.format, strings.Join(o.formats, ", "))
+		return exitUsage, false
+	}
+	return 0, true
+}
+
+// transactions reads the journal store, keeping the transactions of the account up to the last date. Transactions
+// before the first date are kept so lots have their cost basis.
+func (o *options) transactions() []parse.Transaction {
+	journal := parse.NewJournal()
+	return o.readStore(&journal)
+}
+
+// readStore is transactions, also adding the accounts, instruments and exchange rates of the store to the journal for
+// the outputs that need them e.g. the base currency of the accounts in OFX.
+func (o *options) readStore(journal *parse.Journal) []parse.Transaction {
+	transactions, err := journal.ReadStore(o.store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if o.account != "" {
+		transactions = parse.FilterAccount(transactions, o.account)
+	}
+	return parse.FilterPeriod(transactions, "", o.to)
+}
+
+// filter keeps the transactions of the account in the period.
+func (o *options) filter(transactions []parse.Transaction) []parse.Transaction {
+	if o.account != "" {
+		transactions = parse.FilterAccount(transactions, o.account)
+	}
+	return parse.FilterPeriod(transactions, o.from, o.to)
+}
+
+func importCommand(args []string) int {
+	flags, o := commandFlags("import", "statements...")
+	aggregateFills := flags.Bool("aggregate-fills", false, "Merge partial fills of the same order into a single transaction.")
+	if code, ok := o.parse(flags, args); !ok {
+		return code
+	}
+	if len(o.args) == 0 {
+		fmt.Fprintln(os.Stderr, "no statements to import")
+		flags.Usage()
+		return exitUsage
+	}
+
+	statements, err := parse.FindStatements(o.args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	journal := parse.NewJournal()
+	journal.SetAggregateFills(*aggregateFills)
+	store, err := journal.ReadStore(o.store)
+	if err != nil {
+		// nothing is imported into a store that can't be read
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	read := 0
+	transactions, err := journal.ReadStatements(statements, func(statement parse.Statement, _ []parse.Transaction) {
+		read++
+		fmt.Fprintf(os.Stderr, "%s  %s\n", statement.Period(), statement.Path)
+	})
+	// the statements are merged into the store once they're all read since later statements change the transactions
+	// of earlier ones, e.g. withholding tax netted into a dividend or a dividend netted out against its reversal
+	store, removed := journal.RemoveReversedDividends(store)
+	store, added, replaced := parse.MergeTransactions(store, o.filter(transactions))
+	// the statements read before one that failed are still imported, the store is written even without new
+	// transactions since the statements can have new accounts, instruments or exchange rates
+	if read > 0 {
+		journal.WriteStore(o.store, store)
+	}
+	fmt.Fprintf(os.Stderr, "imported %d new transactions into %s, %d changed, %d reversed\n", added, o.store, replaced, removed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	return 0
+}
+
+func exportCommand(args []string) int {
+	flags, o := commandFlags("export", "", "csv", "xlsx", "json", "ndjson", "beancount", "ledger", "ofx", "qif", "html")
+	output := flags.String("output", "", "Path to write to, ./transactions.<format> (./report.html for html) by default. "+
+		"json and ndjson are written to stdout by default or with -.")
+	layout := flags.String("layout", "", "Path to a JSON layout of the columns of the csv and xlsx formats, the journal spreadsheet layout by default.")
+	accounts := flags.String("accounts", "", "Path to a JSON file with the Beancount / Ledger account names of each IBKR account alias.")
+	appendFlag := flags.Bool("append", false, "Add new transactions to the existing csv or xlsx file, keeping the columns filled in by hand.")
+	if code, ok := o.parse(flags, args); !ok {
+		return code
+	}
+
+	journal := parse.NewJournal()
+	if *layout != "" {
+		journal.SetLayout(parse.LoadLayout(*layout))
+	}
+	history := o.readStore(&journal)
+	// the report uses the transactions before the period for the cost basis of the lots
+	transactions := parse.FilterPeriod(history, o.from, o.to)
+
+	path := *output
+	if path == "" {
+		path = "./transactions." + o.format
+		switch o.format {
+		case "html":
+			path = "./report.html"
+		case "json", "ndjson":
+			path = "-"
+		}
+	}
+	if path == "-" && o.format != "json" && o.format != "ndjson" {
+		fmt.Fprintf(os.Stderr, "%s can't be written to stdout\n", o.format)
+		return exitUsage
+	}
+
+	var plainText parse.PlainTextConfig
+	if *accounts != "" {
+		plainText = parse.LoadPlainTextConfig(*accounts)
+	}
+	switch o.format {
+	case "csv":
+		if *appendFlag {
+			journal.AppendCsv(transactions, path)
+		} else {
+			journal.WriteCsv(transactions, path)
+		}
+	case "xlsx":
+		if *appendFlag {
+			journal.AppendXlsx(transactions, path)
+		} else {
+			journal.ToXlsx(transactions, path)
+		}
+	case "json", "ndjson":
+		ledger := parse.NewLedger()
+		ledger.Apply(history)
+		export := parse.NewExport(transactions, ledger)
+		code := writeOutput(path, func(w io.Writer) {
+			if o.format == "json" {
+				parse.WriteJson(w, export)
+			} else {
+				parse.WriteNdjson(w, export)
+			}
+		})
+		if code != 0 {
+			return code
+		}
+	case "beancount":
+		journal.ToBeancount(transactions, path, plainText)
+	case "ledger":
+		journal.ToLedger(transactions, path, plainText)
+	case "ofx":
+		journal.ToOfx(transactions, path)
+	case "qif":
+		journal.ToQif(transactions, path)
+	case "html":
+		journal.ToHtml(history, path, o.from, o.to)
+	}
+	if path != "-" {
+		fmt.Fprintf(os.Stderr, "exported %d transactions to %s\n", len(transactions), path)
+	}
+	return 0
+}
+
+func positionsCommand(args []string) int {
+	flags, o := commandFlags("positions", "", "table", "markdown", "csv", "json", "ndjson")
+	if code, ok := o.parse(flags, args); !ok {
+		return code
+	}
+
+	// positions at the end of the period
+	transactions := o.transactions()
+	ledger := parse.NewLedger()
+	ledger.Apply(transactions)
+	positions := ledger.Positions()
+	writeSummary(o.format, parse.PositionsTable(positions, transactions), parse.Export{Positions: positions})
+	return 0
+}
+
+func pnlCommand(args []string) int {
+	flags, o := commandFlags("pnl", "", "table", "markdown", "csv", "json", "ndjson")
+	if code, ok := o.parse(flags, args); !ok {
+		return code
+	}
+
+	transactions := o.transactions()
+	ledger := parse.NewLedger()
+	ledger.Apply(transactions)
+	closed := ledger.ClosedBetween(o.from, o.to)
+	writeSummary(o.format, parse.PnlTable(closed, transactions), parse.Export{ClosedLots: closed})
+	return 0
+}
+
+func dividendsCommand(args []string) int {
+	flags, o := commandFlags("dividends", "", "table", "markdown", "csv", "json", "ndjson")
+	if code, ok := o.parse(flags, args); !ok {
+		return code
+	}
+
+	transactions := parse.FilterPeriod(o.transactions(), o.from, o.to)
+	writeSummary(o.format, parse.DividendsTable(transactions), parse.Export{Transactions: parse.Dividends(transactions)})
+	return 0
+}
+
+func validateCommand(args []string) int {
+	flags, o := commandFlags("validate", "[statements...]")
+	if code, ok := o.parse(flags, args); !ok {
+		return code
+	}
+
+	// each statement is checked on its own since overlapping statements repeat transactions
+	if len(o.args) > 0 {
+		statements, err := parse.FindStatements(o.args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		journal := parse.NewJournal()
+		failed := 0
+		_, err = journal.ReadStatements(statements, func(statement parse.Statement, transactions []parse.Transaction) {
+			transactions = o.filter(transactions)
+			problems := parse.Validate(transactions)
+			for _, problem := range problems {
+				fmt.Printf("%s: %s\n", statement.Path, problem)
+			}
+			if len(problems) > 0 {
+				failed++
+			}
+			fmt.Fprintf(os.Stderr, "%s  %s: %d transactions, %d problems\n", statement.Period(), statement.Path, len(transactions), len(problems))
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		if failed > 0 {
+			return exitFailure
+		}
+		return 0
+	}
+
+	transactions := parse.FilterPeriod(o.transactions(), o.from, o.to)
+	problems := parse.Validate(transactions)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problems in %d transactions of %s\n", len(problems), len(transactions), o.store)
+		return exitFailure
+	}
+	fmt.Fprintf(os.Stderr, "%d transactions of %s, no problems\n", len(transactions), o.store)
+	return 0
+}
+
+func reconcileCommand(args []string) int {
+	flags, o := commandFlags("reconcile", "statements...", "table", "markdown", "csv")
+	home := flags.String("fx-home", "", "Home currency (e.g. CAD) to track forex in and compare to the statements' forex balances, not compared by default.")
+	if code, ok := o.parse(flags, args); !ok {
+		return code
+	}
+	if len(o.args) == 0 {
+		fmt.Fprintln(os.Stderr, "no statements to reconcile")
+		flags.Usage()
+		return exitUsage
+	}
+
+	statements, err := parse.FindStatements(o.args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	journal := parse.NewJournal()
+	store := o.transactions()
+	var missing []parse.Transaction
+	transactions, err := journal.ReadStatements(statements, func(statement parse.Statement, transactions []parse.Transaction) {
+		transactions = o.filter(transactions)
+		notStored := parse.MissingTransactions(store, transactions)
+		missing = append(missing, notStored...)
+		fmt.Fprintf(os.Stderr, "%s  %s: %d transactions, %d not in %s\n", statement.Period(), statement.Path, len(transactions), len(notStored), o.store)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	transactions = o.filter(transactions)
+
+	code := 0
+	if len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "%d transactions of the statements aren't in %s:\n", len(missing), o.store)
+		writeSummary(o.format, parse.TransactionsTable(missing), parse.Export{})
+		code = exitFailure
+	}
+	if *home != "" {
+		fxLedger := parse.NewFxLedger(*home)
+		if err := journal.TrackForex(fxLedger, transactions); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		for _, difference := range journal.ReconcileForex(fxLedger) {
+			fmt.Println("forex balance difference: ", difference)
+			code = exitFailure
+		}
+	}
+	if code == 0 {
+		fmt.Fprintf(os.Stderr, "%d transactions of the statements are all in %s\n", len(transactions), o.store)
+	}
+	return code
+}
+
+// writeSummary writes the summary to stdout as a table or the export as JSON.
+func writeSummary(format string, table parse.Table, export parse.Export) {
+	switch format {
+	case "table":
+		table.WriteText(os.Stdout, terminalWidth(), isTerminal() && os.Getenv("NO_COLOR") == "")
+	case "markdown":
+		table.WriteMarkdown(os.Stdout)
+	case "csv":
+		table.WriteCsv(os.Stdout)
+	case "json":
+		parse.WriteJson(os.Stdout, export)
+	case "ndjson":
+		parse.WriteNdjson(os.Stdout, export)
+	}
+}
+
+// writeOutput writes to the file, or stdout for -.
+func writeOutput(path string, write func(w io.Writer)) int {
+	if path == "-" {
+		write(os.Stdout)
+		return 0
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	defer file.Close()
+	write(file)
+	return 0
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// statementCommand is the original single command, it reads a statement and writes ./transactions.csv with the
+// other outputs chosen by the flags.
+func statementCommand() {
+	dataFlag := flag.String("data", "", "Path to CSV data: a statement, a glob (e.g. \"./statements/2023-*.csv\") or a directory of statements. "+
+		"More statements can follow the flags.")
+	accountFlag := flag.String("account", "", "Only keep transactions for this account alias or ID, all accounts by default.")
+	aggregateFillsFlag := flag.Bool("aggregate-fills", false, "Merge partial fills of the same order into a single transaction.")
+	lotsFlag := flag.Bool("lots", false, "Write the open lots to ./lots.csv.")
+	fxGainFlag := flag.String("fx-gain", "", "Home currency (e.g. CAD) to track realized forex gain / loss in, written to ./fx_gains.csv.")
+	xlsxFlag := flag.Bool("xlsx", false, "Also write the transactions to ./transactions.xlsx, one sheet per account.")
+	appendFlag := flag.Bool("append", false, "Add new transactions to the existing ./transactions.csv (and ./transactions.xlsx), keeping the columns filled in by hand.")
+	formatFlag := flag.String("format", "csv", "Output format: csv writes ./transactions.csv, json and ndjson write the transactions, lots, positions and campaigns to stdout (see schema/v1.json).")
+	beancountFlag := flag.Bool("beancount", false, "Write the transactions to ./transactions.beancount.")
+	ledgerFlag := flag.Bool("ledger", false, "Write the transactions to ./transactions.ledger for Ledger / hledger.")
+	ofxFlag := flag.Bool("ofx", false, "Write the transactions to ./transactions.ofx as OFX investment statements.")
+	qifFlag := flag.Bool("qif", false, "Write the transactions to ./transactions.qif as QIF investment accounts.")
+	htmlFlag := flag.Bool("html", false, "Write an HTML report of the transactions to ./report.html.")
+	fromFlag := flag.String("from", "", "First date (YYYY-MM-DD) of the HTML report, the first transaction's date by default.")
+	toFlag := flag.String("to", "", "Last date (YYYY-MM-DD) of the HTML report, the last transaction's date by default.")
+	summaryFlag := flag.String("summary", "table", "How the transactions are printed: table (aligned columns for the terminal), markdown or none.")
+	accountsFlag := flag.String("accounts", "", "Path to a JSON file with the Beancount / Ledger account names of each IBKR account alias.")
+	layoutFlag := flag.String("layout", "", "Path to a JSON layout of the columns of ./transactions.csv, the journal spreadsheet layout by default.")
 
 	flag.Parse()
 
-	if *dataFlag == "" {
+	if *dataFlag == "" || (*formatFlag != "csv" && *formatFlag != "json" && *formatFlag != "ndjson") ||
+		(*summaryFlag != "table" && *summaryFlag != "markdown" && *summaryFlag != "none") {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
 	journal := parse.NewJournal()
-	transactions := journal.ReadTransactions(*dataFlag)
-	journal.ToCsv(transactions)
+	journal.SetAggregateFills(*aggregateFillsFlag)
+	if *layoutFlag != "" {
+		journal.SetLayout(parse.LoadLayout(*layoutFlag))
+	}
+	statements, err := parse.FindStatements(append([]string{*dataFlag}, flag.Args()...))
+	if err != nil {
+		log.Fatal(err)
+	}
+	var transactions []parse.Transaction
+	for _, statement := range statements {
+		// the journal returns the transactions of all the statements read so far
+		read := len(transactions)
+		transactions = journal.ReadTransactions(statement.Path)
+		if len(statements) > 1 {
+			fmt.Fprintf(os.Stderr, "%s  %s: %d transactions\n", statement.Period(), statement.Path, len(transactions)-read)
+		}
+	}
+	if *accountFlag != "" {
+		transactions = parse.FilterAccount(transactions, *accountFlag)
+	}
+
+	// corporate actions get their cost basis from the lots they were applied to
+	ledger := parse.NewLedger()
+	ledger.Apply(transactions)
+	if *lotsFlag {
+		ledger.ToCsv("./lots.csv")
+	}
+	// messages go to stderr when stdout is the JSON output
+	messages := os.Stdout
+	switch *formatFlag {
+	case "json":
+		parse.WriteJson(os.Stdout, parse.NewExport(transactions, ledger))
+		messages = os.Stderr
+	case "ndjson":
+		parse.WriteNdjson(os.Stdout, parse.NewExport(transactions, ledger))
+		messages = os.Stderr
+	case "csv":
+		if *appendFlag {
+			journal.AppendCsv(transactions, "./transactions.csv")
+		} else {
+			journal.ToCsv(transactions)
+		}
+	}
+	if *xlsxFlag && *appendFlag {
+		journal.AppendXlsx(transactions, "./transactions.xlsx")
+	} else if *xlsxFlag {
+		journal.ToXlsx(transactions, "./transactions.xlsx")
+	}
 
-	for i, transaction := range transactions {
-		fmt.Println("transaction: ", i, " ", transaction)
+	if *beancountFlag || *ledgerFlag {
+		var accounts parse.PlainTextConfig
+		if *accountsFlag != "" {
+			accounts = parse.LoadPlainTextConfig(*accountsFlag)
+		}
+		if *beancountFlag {
+			journal.ToBeancount(transactions, "./transactions.beancount", accounts)
+		}
+		if *ledgerFlag {
+			journal.ToLedger(transactions, "./transactions.ledger", accounts)
+		}
 	}
+
+	if *ofxFlag {
+		journal.ToOfx(transactions, "./transactions.ofx")
+	}
+	if *qifFlag {
+		journal.ToQif(transactions, "./transactions.qif")
+	}
+
+	if *htmlFlag {
+		journal.ToHtml(transactions, "./report.html", *fromFlag, *toFlag)
+	}
+
+	if *fxGainFlag != "" {
+		fxLedger := parse.NewFxLedger(*fxGainFlag)
+		if err := journal.TrackForex(fxLedger, transactions); err != nil {
+			log.Fatal(err)
+		}
+		fxLedger.ToCsv("./fx_gains.csv")
+		fmt.Fprintf(messages, "realized forex gain / loss: %.2f %s\n", fxLedger.RealizedGain(), *fxGainFlag)
+		for _, difference := range journal.ReconcileForex(fxLedger) {
+			fmt.Fprintln(messages, "forex balance difference: ", difference)
+		}
+	}
+
+	// the summary would mix with the JSON output
+	if *formatFlag == "csv" {
+		switch *summaryFlag {
+		case "table":
+			parse.WriteTable(os.Stdout, transactions, terminalWidth(), isTerminal() && os.Getenv("NO_COLOR") == "")
+		case "markdown":
+			parse.WriteMarkdown(os.Stdout, transactions)
+		}
+	}
+}
+
+// terminalWidth is the width of the terminal from $COLUMNS, 0 (no limit) when it isn't set or the output isn't a
+// terminal.
+func terminalWidth() int {
+	if !isTerminal() {
+		return 0
+	}
+	width, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// isTerminal checks if stdout is a terminal instead of a file or pipe.
+func isTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
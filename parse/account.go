@@ -0,0 +1,83 @@
+package parse
+
+import "sort"
+
+// Account is an IBKR account from the "Account Information" section of the statement.
+type Account struct {
+	id           string // e.g. U1234567
+	alias        string // e.g. TFSA
+	name         string
+	customerType string // e.g. Tax-Free Savings Account
+	baseCurrency string // e.g. USD
+	capabilities string // e.g. Cash, Margin
+}
+
+// label is how the account is shown in the journal, the alias if there is one, otherwise the account ID.
+func (a Account) label() string {
+	if a.alias != "" {
+		return a.alias
+	}
+	return a.id
+}
+
+// set updates the account field from an "Account Information" field name.
+func (a *Account) set(field string, value string) {
+	switch field {
+	case "Account":
+		a.id = value
+	case "Account Alias", "Alias":
+		a.alias = value
+	case "Name":
+		a.name = value
+	case "Customer Type":
+		a.customerType = value
+	case "Base Currency":
+		a.baseCurrency = value
+	case "Account Capabilities", "Capabilities":
+		a.capabilities = value
+	}
+}
+
+// registerAccount adds the account to the journal's account registry or updates it if it already exists.
+func (j *Journal) registerAccount(account Account) {
+	if account.id == "" {
+		return
+	}
+	if j.accounts == nil {
+		j.accounts = make(map[string]Account)
+	}
+	j.accounts[account.id] = account
+}
+
+// findAccount looks up the account by its ID. Accounts that weren't in the "Account Information" section will only
+// have the ID.
+func (j *Journal) findAccount(id string) Account {
+	if account, ok := j.accounts[id]; ok {
+		return account
+	}
+	return Account{id: id}
+}
+
+// Accounts returns all the accounts found in the statements, sorted by account ID.
+func (j *Journal) Accounts() []Account {
+	var accounts []Account
+	for _, account := range j.accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(a, b int) bool {
+		return accounts[a].id < accounts[b].id
+	})
+	return accounts
+}
+
+// FilterAccount returns the transactions of a single account, matched by the account alias or account ID.
+// All the transactions together are the consolidated view of the accounts.
+func FilterAccount(transactions []Transaction, account string) []Transaction {
+	var accountTransactions []Transaction
+	for _, transaction := range transactions {
+		if transaction.account == account || transaction.accountID == account {
+			accountTransactions = append(accountTransactions, transaction)
+		}
+	}
+	return accountTransactions
+}
@@ -0,0 +1,169 @@
+package parse
+
+import (
+	"encoding/csv"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keyFields identify a transaction that's already in the journal, e.g. when the same statement is imported again
+// or statements overlap. Amounts aren't part of the key since a later statement can change them (e.g. withholding tax
+// netted into a dividend or a corrected fee), the amounts of a transaction already in the journal are refreshed.
+var keyFields = map[string]bool{
+	"date":            true,
+	"account":         true,
+	"action":          true,
+	"ticker":          true,
+	"optionContract":  true,
+	"orderID":         true,
+	"optionContracts": true,
+	"shares":          true,
+}
+
+// AppendCsv adds the transactions to an existing journal CSV file, creating it if it doesn't exist.
+// Transactions already in the journal have their columns refreshed except for the columns the layout leaves blank,
+// which are filled in by hand and kept as they are. New transactions are inserted after the last row on or before
+// their date.
+func (j *Journal) AppendCsv(txs []Transaction, csvPath string) {
+	layout := j.journalLayout()
+
+	var existing [][]string
+	file, err := os.Open(csvPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		log.Fatal(err)
+	default:
+		reader := csv.NewReader(file)
+		// rows can have extra columns added by hand
+		reader.FieldsPerRecord = -1
+		existing, err = reader.ReadAll()
+		file.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var header [][]string
+	if layout.Header {
+		if len(existing) > 0 {
+			header, existing = existing[:1], existing[1:]
+		} else {
+			header = layout.rows(nil)
+		}
+	}
+
+	writeCsv(csvPath, append(header, layout.merge(existing, txs)...))
+}
+
+func writeCsv(csvPath string, rows [][]string) {
+	f, err := os.Create(csvPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	writer := csv.NewWriter(f)
+	writer.WriteAll(rows)
+}
+
+// merge adds the transactions to the existing rows of the journal, without the header row.
+func (l Layout) merge(existing [][]string, txs []Transaction) [][]string {
+	l.Header = false
+	rows := l.rows(txs)
+
+	dateColumn, orderColumn := -1, -1
+	var keyColumns, generatedColumns []int
+	for c, column := range l.Columns {
+		if keyFields[column.Field] {
+			keyColumns = append(keyColumns, c)
+		}
+		if column.Field != "" || column.Expression != "" {
+			generatedColumns = append(generatedColumns, c)
+		}
+		switch column.Field {
+		case "date":
+			dateColumn = c
+		case "orderID":
+			orderColumn = c
+		}
+	}
+	value := func(row []string, c int) string {
+		if c < 0 || c >= len(row) {
+			return ""
+		}
+		return row[c]
+	}
+	key := func(row []string) string {
+		var values []string
+		for _, c := range keyColumns {
+			values = append(values, normalizeCell(value(row, c)))
+		}
+		return strings.Join(values, "|")
+	}
+
+	// the same transaction can be in the journal more than once e.g. two identical fills, so they're matched in order
+	existingRows := make(map[string][]int)
+	for i, row := range existing {
+		existingRows[key(row)] = append(existingRows[key(row)], i)
+	}
+
+	sort.SliceStable(rows, func(a, b int) bool {
+		if value(rows[a], dateColumn) != value(rows[b], dateColumn) {
+			return value(rows[a], dateColumn) < value(rows[b], dateColumn)
+		}
+		return value(rows[a], orderColumn) < value(rows[b], orderColumn)
+	})
+
+	merged := existing
+	var added [][]string
+	for _, row := range rows {
+		k := key(row)
+		if len(existingRows[k]) == 0 {
+			added = append(added, row)
+			continue
+		}
+		i := existingRows[k][0]
+		existingRows[k] = existingRows[k][1:]
+		for len(merged[i]) < len(row) {
+			merged[i] = append(merged[i], "")
+		}
+		for _, c := range generatedColumns {
+			merged[i][c] = row[c]
+		}
+	}
+
+	for _, row := range added {
+		// after the last row on or before the date, rows without a date (e.g. notes) stay with the row above them
+		position := len(merged)
+		if dateColumn >= 0 {
+			position = 0
+			for i, existingRow := range merged {
+				date := value(existingRow, dateColumn)
+				if date != "" && date <= row[dateColumn] {
+					position = i + 1
+				}
+			}
+			for position < len(merged) && position > 0 && value(merged[position], dateColumn) == "" {
+				position++
+			}
+		}
+		merged = append(merged[:position], append([][]string{row}, merged[position:]...)...)
+	}
+	return merged
+}
+
+// normalizeCell makes numbers comparable regardless of how they were formatted e.g. by a spreadsheet,
+// -4607.00 and -4607 are the same amount.
+func normalizeCell(value string) string {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return strconv.FormatFloat(number, 'f', 8, 64)
+}
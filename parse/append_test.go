@@ -0,0 +1,120 @@
+package parse
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readCsv(t *testing.T, csvPath string) [][]string {
+	f, err := os.Open(csvPath)
+	require.NoError(t, err)
+	defer f.Close()
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	require.NoError(t, err)
+	return rows
+}
+
+func TestAppendCsv(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/13-multiple-trades-same-ticker.csv")
+	csvPath := filepath.Join(t.TempDir(), "transactions.csv")
+
+	// journal with some of the transactions, a column filled in by hand and rows before and after the statement
+	journal.AppendCsv(transactions[:3], csvPath)
+	rows := readCsv(t, csvPath)
+	require.Len(t, rows, 3)
+	rows[0][2] = "entered by hand"
+	before := make([]string, 52)
+	before[0], before[2] = "2023-06-01", "earlier trade"
+	after := make([]string, 52)
+	after[0], after[2] = "2023-06-30", "later trade"
+	rows = append([][]string{before}, append(rows, after)...)
+	writeCsv(csvPath, rows)
+
+	journal.AppendCsv(transactions, csvPath)
+	rows = readCsv(t, csvPath)
+	require.Len(t, rows, len(transactions)+2)
+	require.Equal(t, "earlier trade", rows[0][2])
+	require.Equal(t, "entered by hand", rows[1][2])
+	require.Equal(t, "later trade", rows[len(rows)-1][2])
+	for _, row := range rows[1 : len(rows)-1] {
+		require.Equal(t, "2023-06-08", row[0])
+	}
+
+	// importing the same statement again doesn't add anything
+	journal.AppendCsv(transactions, csvPath)
+	require.Equal(t, rows, readCsv(t, csvPath))
+}
+
+func TestAppendCsvHeader(t *testing.T) {
+	journal := NewJournal()
+	journal.SetLayout(LoadLayout("../testdata/layouts/summary.json"))
+	transactions := journal.ReadTransactions("../testdata/input/2-dividend.csv")
+	csvPath := filepath.Join(t.TempDir(), "transactions.csv")
+
+	journal.AppendCsv(transactions, csvPath)
+	journal.AppendCsv(transactions, csvPath)
+	rows := readCsv(t, csvPath)
+	require.Len(t, rows, len(transactions)+1)
+	require.Equal(t, "Date", rows[0][0])
+}
+
+func TestAppendXlsx(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/14-multi-account.csv")
+	xlsxPath := filepath.Join(t.TempDir(), "transactions.xlsx")
+	layout := DefaultLayout()
+
+	journal.ToXlsx(transactions, xlsxPath)
+	names, sheets := readXlsx(xlsxPath, layout)
+	require.Equal(t, []string{"RRSP", "TFSA"}, names)
+	// the rows read back are the rows written, dates converted back from Excel dates
+	rows := layout.rows(FilterAccount(transactions, "RRSP"))
+	require.Len(t, sheets["RRSP"], len(rows))
+	require.Equal(t, rows[0][:15], sheets["RRSP"][0][:15])
+
+	// a note entered by hand in one of the columns the layout leaves blank is kept
+	sheets["RRSP"][0][2] = "entered by hand"
+	writeXlsx(xlsxPath, layout, names, sheets)
+	journal.AppendXlsx(transactions, xlsxPath)
+
+	_, appended := readXlsx(xlsxPath, layout)
+	require.Equal(t, sheets, appended)
+}
+
+func TestNormalizeCell(t *testing.T) {
+	require.Equal(t, normalizeCell("-4607"), normalizeCell("-4607.00"))
+	require.Equal(t, normalizeCell("46.08000000"), normalizeCell("46.08"))
+	require.Equal(t, "Trade", normalizeCell(" Trade "))
+	require.Equal(t, 0, columnIndex("A1"))
+	require.Equal(t, 27, columnIndex("AB2"))
+}
+
+func TestAppendCsvChangedAmount(t *testing.T) {
+	dividend := Transaction{date: "2023-06-08", account: "RRSP", action: "Dividend", ticker: "MSFT", dividend: "136", currency: "USD",
+		notes: "MSFT(US5949181045) Cash Dividend USD 0.68 per Share (Ordinary Dividend)"}
+	csvPath := filepath.Join(t.TempDir(), "transactions.csv")
+
+	journal := NewJournal()
+	journal.AppendCsv([]Transaction{dividend}, csvPath)
+	rows := readCsv(t, csvPath)
+	rows[0][2] = "entered by hand"
+	writeCsv(csvPath, rows)
+
+	// the withholding tax is in the next statement
+	dividend.fee = "-20.4"
+	dividend.notes += "\n15% tax withdrawn"
+	journal.AppendCsv([]Transaction{dividend}, csvPath)
+	rows = readCsv(t, csvPath)
+	require.Len(t, rows, 1)
+	require.Equal(t, "entered by hand", rows[0][2])
+	require.Equal(t, "136", rows[0][20])
+	require.Equal(t, "-20.4", rows[0][24])
+	require.Equal(t, dividend.notes, rows[0][34])
+}
@@ -0,0 +1,80 @@
+package parse
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// assetMultiplier returns the units per contract of futures, bonds and mutual funds.
+// Bonds are priced in % of par and mutual funds are priced per unit. Futures multipliers are replaced with the one
+// from the statement's "Financial Instrument Information" once it's read, until then the multiplier is derived from
+// the proceeds of the trade (e.g. -214512.5 / (1 * 4290.25) = 50).
+func assetMultiplier(assetCategory string, proceeds float64, quantity float64, price float64) string {
+	switch assetCategory {
+	case "Bonds":
+		return "0.01"
+	case "Mutual Funds":
+		return "1"
+	}
+	if quantity == 0 || price == 0 {
+		return ""
+	}
+	multiplier := math.Round(math.Abs(proceeds/(quantity*price))*10000) / 10000
+	return strconv.FormatFloat(multiplier, 'f', -1, 64)
+}
+
+// setMultipliers sets the futures multipliers from the statement's "Financial Instrument Information".
+func (j *Journal) setMultipliers() {
+	for ticker := range j.trades {
+		for i := range j.trades[ticker] {
+			transaction := &j.trades[ticker][i]
+			if multiplier, ok := j.multipliers[transaction.ticker]; ok && transaction.action == "Trade - Future" {
+				transaction.multiplier = multiplier
+			}
+		}
+	}
+}
+
+// accruedInterest adds the interest paid or received when trading bonds to the bond trades. Accrued interest that
+// doesn't match a bond trade is added as its own transaction.
+// e.g. "Purchase Accrued Interest T 3 1/2 02/15/33" is added to the T 3 1/2 02/15/33 trade on the same date
+func (j *Journal) accruedInterest(interest []Transaction) {
+	for _, transaction := range interest {
+		trade := j.findBondTrade(transaction)
+		if trade == nil {
+			j.addTransaction(transaction)
+			continue
+		}
+
+		accruedInterest := parseAmount(trade.accruedInterest) + parseAmount(transaction.dividend)
+		trade.accruedInterest = fmt.Sprintf("%.2f", accruedInterest)
+	}
+}
+
+// findBondTrade finds the bond trade for the same account and date that the interest description is for.
+func (j *Journal) findBondTrade(interest Transaction) *Transaction {
+	for ticker := range j.trades {
+		for i := range j.trades[ticker] {
+			transaction := &j.trades[ticker][i]
+			if transaction.action == "Trade - Bond" &&
+				transaction.account == interest.account &&
+				transaction.date == interest.date &&
+				strings.Contains(interest.notes, transaction.ticker) {
+				return transaction
+			}
+		}
+	}
+	return nil
+}
+
+// isCashSettled checks if the options on the underlying are cash-settled broad-based index options.
+// These are Section 1256 contracts.
+func isCashSettled(underlying string) bool {
+	switch underlying {
+	case "SPX", "SPXW", "XSP", "NDX", "NDXP", "XND", "RUT", "RUTW", "MRUT", "VIX", "VIXW", "DJX", "OEX", "XEO":
+		return true
+	}
+	return false
+}
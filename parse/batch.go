@@ -0,0 +1,149 @@
+package parse
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Statement is an IBKR activity statement file and its period.
+type Statement struct {
+	Path string
+	From string // e.g. 2023-06-01
+	To   string // e.g. 2023-06-30
+}
+
+// FindStatements expands the files, globs (e.g. ./statements/2023-*.csv) and directories (all the .csv files in them
+// and their subdirectories) into the statements ordered by their period, so they can be read one after another.
+// A path that matches no statement, or a file without a statement period, is an error.
+func FindStatements(paths []string) ([]Statement, error) {
+	var files []string
+	for _, path := range paths {
+		matches := []string{path}
+		if strings.ContainsAny(path, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(path); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%s: no statements match", path)
+			}
+		}
+		for _, match := range matches {
+			found, err := statementFiles(match)
+			if err != nil {
+				return nil, err
+			}
+			if len(found) == 0 {
+				return nil, fmt.Errorf("%s: no statements in the directory", match)
+			}
+			files = append(files, found...)
+		}
+	}
+
+	// the same statement can be matched more than once, e.g. by a directory and a glob
+	seen := make(map[string]bool)
+	var statements []Statement
+	for _, file := range files {
+		if seen[filepath.Clean(file)] {
+			continue
+		}
+		seen[filepath.Clean(file)] = true
+		from, to, err := readStatementPeriod(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		statements = append(statements, Statement{Path: file, From: from, To: to})
+	}
+	sort.SliceStable(statements, func(a, b int) bool {
+		sa, sb := statements[a], statements[b]
+		if sa.From != sb.From {
+			return sa.From < sb.From
+		}
+		if sa.To != sb.To {
+			return sa.To < sb.To
+		}
+		return sa.Path < sb.Path
+	})
+	return statements, nil
+}
+
+// statementFiles returns the file, or the .csv files of the directory and its subdirectories.
+func statementFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(file), ".csv") {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// readStatementPeriod reads the period from the Statement section at the top of the statement,
+// e.g. Statement,Data,Period,"June 1, 2023 - June 30, 2023"
+func readStatementPeriod(csvPath string) (string, string, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			return "", "", fmt.Errorf("no statement period, not an IBKR activity statement")
+		} else if err != nil {
+			return "", "", err
+		}
+		if len(rec) >= 4 && rec[0] == "Statement" && rec[1] == "Data" && rec[2] == "Period" {
+			return parsePeriod(rec[3])
+		}
+	}
+}
+
+// Period is the statement's dates, e.g. 2023-06-05 for a daily statement or 2023-06-01 - 2023-06-30.
+func (s Statement) Period() string {
+	if s.From == s.To {
+		return s.From
+	}
+	return s.From + " - " + s.To
+}
+
+// ReadStatements reads the statements into the journal one after another, calling read with the transactions each
+// statement added to the journal or changed. It returns the transactions of all the statements read.
+// A statement that can't be read or parsed stops the reading and is an error instead of a crash, the transactions of
+// the statements read before it are still returned.
+func (j *Journal) ReadStatements(statements []Statement, read func(statement Statement, transactions []Transaction)) (transactions []Transaction, err error) {
+	var statement Statement
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: %v", statement.Path, r)
+		}
+	}()
+	for _, statement = range statements {
+		// the journal returns the transactions of all the statements read so far
+		all := j.ReadTransactions(statement.Path)
+		read(statement, MissingTransactions(transactions, all))
+		transactions = all
+	}
+	return transactions, nil
+}
@@ -0,0 +1,74 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindStatements(t *testing.T) {
+	statements, err := FindStatements([]string{"../testdata/input", "../testdata/input/1-dmc.csv"})
+	require.NoError(t, err)
+	// the directory and the file are the same statement
+	require.Len(t, statements, 28)
+	require.Equal(t, Statement{Path: "../testdata/input/1-dmc.csv", From: "2022-11-25", To: "2022-11-25"}, statements[0])
+	for i := 1; i < len(statements); i++ {
+		require.LessOrEqual(t, statements[i-1].From, statements[i].From)
+	}
+
+	statements, err = FindStatements([]string{"../testdata/input/1[56]-*.csv", "../testdata/input/3-forex.csv", "../testdata/input/19-fees.csv"})
+	require.NoError(t, err)
+	require.Equal(t, []Statement{
+		{Path: "../testdata/input/19-fees.csv", From: "2023-06-01", To: "2023-06-30"},
+		{Path: "../testdata/input/3-forex.csv", From: "2023-06-05", To: "2023-06-05"},
+		{Path: "../testdata/input/15-multi-currency.csv", From: "2023-06-15", To: "2023-06-15"},
+		{Path: "../testdata/input/16-forex-usd-cad.csv", From: "2023-06-20", To: "2023-06-20"},
+	}, statements)
+	require.Equal(t, "2023-06-01 - 2023-06-30", statements[0].Period())
+	require.Equal(t, "2023-06-05", statements[1].Period())
+}
+
+func TestFindStatementsErrors(t *testing.T) {
+	_, err := FindStatements([]string{"../testdata/input/missing.csv"})
+	require.Error(t, err)
+
+	_, err = FindStatements([]string{"../testdata/input/*.xlsx"})
+	require.EqualError(t, err, "../testdata/input/*.xlsx: no statements match")
+
+	notStatement := filepath.Join(t.TempDir(), "lots.csv")
+	require.NoError(t, os.WriteFile(notStatement, []byte("Account,Symbol\nTFSA,PR\n"), 0644))
+	_, err = FindStatements([]string{notStatement})
+	require.EqualError(t, err, notStatement+": no statement period, not an IBKR activity statement")
+}
+
+func TestReadStatementsCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	var statements []Statement
+	for i, statement := range []string{"1-dmc.csv", "3-forex.csv", "19-fees.csv"} {
+		data, err := os.ReadFile(filepath.Join("../testdata/input", statement))
+		require.NoError(t, err)
+		if i == 1 {
+			// a quote in the middle of a field that the CSV parser can't read
+			data = append(data, []byte("Trades,Data,Order,Stocks,USD,\"TECK\"X,1\n")...)
+		}
+		path := filepath.Join(dir, statement)
+		require.NoError(t, os.WriteFile(path, data, 0644))
+		statements = append(statements, Statement{Path: path})
+	}
+
+	journal := NewJournal()
+	var read []string
+	transactions, err := journal.ReadStatements(statements, func(statement Statement, _ []Transaction) {
+		read = append(read, statement.Path)
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), statements[1].Path+": ")
+	// the statement before the corrupt one is still read, the ones after it aren't
+	require.Equal(t, []string{statements[0].Path}, read)
+	expected := NewJournal()
+	first := expected.ReadTransactions("../testdata/input/1-dmc.csv")
+	require.Len(t, transactions, len(first))
+	require.Empty(t, MissingTransactions(transactions, first))
+}
@@ -0,0 +1,109 @@
+package parse
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statementRates are the exchange rates to the base currency from the "Base Currency Exchange Rate" section of a
+// statement, which are valid for the statement period.
+type statementRates struct {
+	from  string // e.g. 2023-06-01
+	to    string // e.g. 2023-06-30
+	rates map[string]string
+}
+
+// statementPeriod converts the statement period to the first and last date of the period.
+// e.g. "June 5, 2023" will return 2023-06-05, 2023-06-05
+// e.g. "May 1, 2023 - May 31, 2023" will return 2023-05-01, 2023-05-31
+func statementPeriod(period string) (string, string) {
+	from, to, err := parsePeriod(period)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return from, to
+}
+
+func parsePeriod(period string) (string, string, error) {
+	dates := strings.Split(period, " - ")
+	var parsed []string
+	for _, date := range dates {
+		t, err := time.Parse("January 2, 2006", strings.TrimSpace(date))
+		if err != nil {
+			return "", "", fmt.Errorf("invalid statement period: %s", period)
+		}
+		parsed = append(parsed, t.Format("2006-01-02"))
+	}
+	return parsed[0], parsed[len(parsed)-1], nil
+}
+
+// fxRate finds the exchange rate from the currency to the base currency on the date.
+// The rates of the statement that covers the date are used, otherwise the rates of the latest statement before the
+// date. Returns blank when there is no rate.
+func (j *Journal) fxRate(date string, currency string) string {
+	rate := ""
+	latest := ""
+	for _, statement := range j.rates {
+		if statement.from <= date && date <= statement.to {
+			if r, ok := statement.rates[currency]; ok {
+				return r
+			}
+		}
+		if statement.to <= date && statement.to > latest {
+			if r, ok := statement.rates[currency]; ok {
+				rate = r
+				latest = statement.to
+			}
+		}
+	}
+	return rate
+}
+
+// convertToBase sets the exchange rate to the account's base currency for transactions that don't have it yet.
+func (j *Journal) convertToBase() {
+	for ticker := range j.trades {
+		for i := range j.trades[ticker] {
+			transaction := &j.trades[ticker][i]
+			j.setFxRateToBase(transaction)
+			for f := range transaction.fills {
+				j.setFxRateToBase(&transaction.fills[f])
+			}
+		}
+	}
+}
+
+func (j *Journal) setFxRateToBase(transaction *Transaction) {
+	if transaction.currency == "" || transaction.fxRateToBase != "" {
+		return
+	}
+	if transaction.currency == j.findAccount(transaction.accountID).baseCurrency {
+		transaction.fxRateToBase = "1"
+		return
+	}
+	transaction.fxRateToBase = j.fxRate(transaction.date, transaction.currency)
+}
+
+// toBase converts an amount in the transaction's currency to the account's base currency.
+// Returns blank when the amount is blank or there is no exchange rate.
+func (t Transaction) toBase(amount string) string {
+	if amount == "" || t.fxRateToBase == "" {
+		return ""
+	}
+	rate, err := strconv.ParseFloat(t.fxRateToBase, 64)
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%.2f", parseAmount(amount)*rate)
+}
+
+// commissionToBase converts the commission to the account's base currency.
+func (t Transaction) commissionToBase() string {
+	if t.commissionCurrency != "" && t.commission != "" {
+		// IBKR reports commissions that aren't in the transaction currency (e.g. forex) in the base currency
+		return fmt.Sprintf("%.2f", parseAmount(t.commission))
+	}
+	return t.toBase(t.commission)
+}
@@ -0,0 +1,231 @@
+package parse
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// withholdingTax matches a withholding tax row to its dividend and updates the dividend's fee and notes.
+// A withholding tax that doesn't match any dividend (e.g. refund of tax withheld in an earlier statement) is added
+// as its own transaction.
+func (j *Journal) withholdingTax(withholding Transaction) {
+	dividend := findWithheldDividend(withholding, j.trades[withholding.ticker])
+	if dividend == nil {
+		// the dividend was imported into the store from an earlier statement
+		if stored := findWithheldDividend(withholding, j.storedDividends); stored != nil {
+			dividend = j.restoreDividend(stored)
+		}
+	}
+	if dividend == nil {
+		withholding.action = "Withholding Tax"
+		if parseAmount(withholding.fee) > 0 {
+			withholding.notes += "\nwithholding tax refunded"
+		}
+		j.addTransaction(withholding)
+		return
+	}
+
+	// a dividend can have several withholding rows, e.g. tax withheld and then partially refunded
+	if dividend.fee == "" {
+		dividend.fee = withholding.fee
+	} else {
+		fee := math.Round((parseAmount(dividend.fee)+parseAmount(withholding.fee))*100) / 100
+		dividend.fee = strconv.FormatFloat(fee, 'f', -1, 64)
+	}
+
+	description := strings.Split(dividend.notes, "\n")[0]
+	dividend.notes = description + "\n" + withholdingNote(dividend.dividend, dividend.fee)
+}
+
+// findWithheldDividend finds the dividend of the transactions that the withholding tax was withheld from.
+// A refund is matched to the reversal of the dividend when there is one. Otherwise the dividend for the same account
+// and ticker with the same description (e.g. "MSFT(US5949181045) Cash Dividend USD 0.68 per Share") on the same date
+// is preferred, then the same description on any date (e.g. tax adjusted later), then any dividend on the same date.
+func findWithheldDividend(withholding Transaction, transactions []Transaction) *Transaction {
+	description := dividendDescription(withholding.notes)
+
+	// a refund is preferably matched to the reversal of the dividend the tax was withheld from
+	refund := parseAmount(withholding.fee) > 0
+	for i := range transactions {
+		transaction := &transactions[i]
+		if refund &&
+			transaction.action == "Dividend" &&
+			transaction.dividendType == "Reversal" &&
+			transaction.account == withholding.account &&
+			dividendDescription(transaction.notes) == description {
+			return transaction
+		}
+	}
+
+	var sameDescription, sameDate *Transaction
+	for i := range transactions {
+		transaction := &transactions[i]
+		if transaction.action != "Dividend" || transaction.ticker != withholding.ticker || transaction.account != withholding.account {
+			continue
+		}
+		matchesDescription := dividendDescription(transaction.notes) == description
+		if matchesDescription && transaction.date == withholding.date {
+			return transaction
+		}
+		if matchesDescription && sameDescription == nil {
+			sameDescription = transaction
+		}
+		if transaction.date == withholding.date && sameDate == nil {
+			sameDate = transaction
+		}
+	}
+
+	if sameDescription != nil {
+		return sameDescription
+	}
+	return sameDate
+}
+
+// dividendDescription removes the dividend type and withholding suffix from a dividend or withholding tax description.
+// e.g. "MSFT(US5949181045) Cash Dividend USD 0.68 per Share (Ordinary Dividend)" and
+// "MSFT(US5949181045) Cash Dividend USD 0.68 per Share - US Tax" will both return
+// "MSFT(US5949181045) Cash Dividend USD 0.68 per Share"
+func dividendDescription(notes string) string {
+	description := strings.Split(notes, "\n")[0]
+	if i := strings.LastIndex(description, " - "); i != -1 && strings.HasSuffix(description, " Tax") {
+		description = description[:i]
+	}
+	if strings.HasSuffix(description, ")") {
+		if i := strings.LastIndex(description, " ("); i != -1 {
+			description = description[:i]
+		}
+	}
+	return description
+}
+
+// withholdingNote describes the tax withheld as a percentage of the dividend, e.g. "15% tax withdrawn".
+func withholdingNote(dividend string, fee string) string {
+	amount := parseAmount(dividend)
+	withheld := -parseAmount(fee)
+	switch {
+	case withheld == 0:
+		return "withholding tax refunded"
+	case withheld < 0:
+		return fmt.Sprintf("%.2f withholding tax refunded", -withheld)
+	case amount == 0:
+		return "tax withdrawn"
+	}
+	rate := math.Round(withheld/amount*10000) / 100
+	return strconv.FormatFloat(rate, 'f', -1, 64) + "% tax withdrawn"
+}
+
+// dividendType classifies the dividend from its description and amount.
+// e.g. "SMG(US8101861065) Payment in Lieu of Dividend (Ordinary Dividend)" is a Payment in Lieu which is taxed
+// differently than an ordinary dividend. A negative amount is the reversal of an earlier dividend, except a negative
+// payment in lieu which is charged on a short position unless its description says it's a reversal.
+func dividendType(description string, amount string) string {
+	switch {
+	case strings.Contains(description, "Reversal"):
+		return "Reversal"
+	case parseAmount(amount) < 0 && strings.Contains(description, "Payment in Lieu"):
+		// dividend paid to the lender of the shares of a short position
+		return "Payment in Lieu Charged"
+	case parseAmount(amount) < 0:
+		return "Reversal"
+	case strings.Contains(description, "Payment in Lieu"):
+		return "Payment in Lieu"
+	case strings.Contains(description, "Return of Capital"):
+		return "Return of Capital"
+	}
+	return "Ordinary Dividend"
+}
+
+// netDividendReversals nets reversals out against the dividends they reverse.
+// IBKR corrects a dividend by reversing it and posting the corrected dividend, so a dividend and its reversal
+// (along with their withholding tax) cancel out and only the corrected dividend is kept. The dividend can be from an
+// earlier statement read by the journal or imported into the store. A reversal whose dividend isn't in the journal
+// is kept as it is, payments in lieu charged on short positions are never netted.
+func (j *Journal) netDividendReversals() {
+	for ticker := range j.trades {
+		transactions := j.trades[ticker]
+		matched := make(map[int]bool)
+		removed := make(map[int]bool)
+
+		for r := range transactions {
+			if transactions[r].action != "Dividend" || transactions[r].dividendType != "Reversal" || parseAmount(transactions[r].dividend) >= 0 {
+				continue
+			}
+			o := -1
+			for i := range transactions {
+				if !matched[i] && reverses(transactions[r], transactions[i]) {
+					o = i
+					break
+				}
+			}
+			if o == -1 {
+				// the dividend was imported into the store from an earlier statement
+				var stored *Transaction
+				for i := range j.storedDividends {
+					if reverses(transactions[r], j.storedDividends[i]) {
+						stored = &j.storedDividends[i]
+						break
+					}
+				}
+				if stored == nil {
+					continue
+				}
+				j.restoreDividend(stored)
+				transactions = j.trades[ticker]
+				o = len(transactions) - 1
+			}
+			reversal, original := &transactions[r], &transactions[o]
+
+			matched[o] = true
+			removed[r] = true
+			j.reversedDividends = append(j.reversedDividends, *reversal)
+
+			// withholding tax that wasn't refunded with the reversal stays with the original dividend
+			fee := math.Round((parseAmount(original.fee)+parseAmount(reversal.fee))*100) / 100
+			if fee != 0 {
+				original.dividend = "0"
+				original.fee = strconv.FormatFloat(fee, 'f', -1, 64)
+				original.notes = strings.Split(original.notes, "\n")[0] + "\nreversed, " +
+					withholdingNote(original.dividend, original.fee)
+			} else {
+				removed[o] = true
+				j.reversedDividends = append(j.reversedDividends, *original)
+			}
+		}
+
+		var kept []Transaction
+		for i, transaction := range transactions {
+			if !removed[i] {
+				kept = append(kept, transaction)
+			}
+		}
+		j.trades[ticker] = kept
+	}
+}
+
+// reverses checks whether the reversal reverses the dividend: same account, description and amount.
+func reverses(reversal Transaction, dividend Transaction) bool {
+	return dividend.action == "Dividend" &&
+		parseAmount(dividend.dividend) > 0 &&
+		dividend.ticker == reversal.ticker &&
+		dividend.account == reversal.account &&
+		dividendDescription(dividend.notes) == dividendDescription(reversal.notes) &&
+		parseAmount(dividend.dividend) == -parseAmount(reversal.dividend)
+}
+
+// restoreDividend moves a dividend of the store into the journal so it's changed by the withholding tax or reversal
+// of a later statement, and returns it.
+func (j *Journal) restoreDividend(stored *Transaction) *Transaction {
+	for i := range j.storedDividends {
+		if &j.storedDividends[i] != stored {
+			continue
+		}
+		dividend := *stored
+		j.storedDividends = append(j.storedDividends[:i:i], j.storedDividends[i+1:]...)
+		j.addTransaction(dividend)
+		transactions := j.trades[dividend.ticker]
+		return &transactions[len(transactions)-1]
+	}
+	return nil
+}
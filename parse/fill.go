@@ -0,0 +1,123 @@
+package parse
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fillWindow is how long after the last fill of an order another partial fill can still belong to the same order.
+// Separate orders for the same contract on the same day (e.g. two covered calls hours apart) are kept apart.
+const fillWindow = 15 * time.Minute
+
+// SetAggregateFills turns fill aggregation on or off.
+// When on, an order that IBKR reports as several partial fills is merged into a single transaction with the
+// volume weighted average price and summed commission. The individual fills are kept on the merged transaction.
+func (j *Journal) SetAggregateFills(aggregateFills bool) {
+	j.aggregateFills = aggregateFills
+}
+
+// findFill finds the transaction of an earlier fill that belongs to the same order as the fill. Only partial
+// executions (the P code) are fills of the same order, and only when the fill follows the last one within fillWindow.
+func (j *Journal) findFill(fill Transaction) *Transaction {
+	if !hasCode(fill.codes, "P") {
+		return nil
+	}
+	for i := range j.trades[fill.ticker] {
+		transaction := &j.trades[fill.ticker][i]
+		if transaction.account == fill.account &&
+			transaction.date == fill.date &&
+			transaction.action == fill.action &&
+			transaction.optionContract == fill.optionContract &&
+			transaction.buySell == fill.buySell &&
+			hasCode(transaction.codes, "P") &&
+			hasCode(transaction.codes, "O") == hasCode(fill.codes, "O") {
+			gap := orderTime(fill.orderID).Sub(transaction.lastFillTime())
+			if gap >= 0 && gap <= fillWindow {
+				return transaction
+			}
+		}
+	}
+	return nil
+}
+
+// lastFillTime is the time of the latest fill of the transaction.
+func (t *Transaction) lastFillTime() time.Time {
+	last := orderTime(t.orderID)
+	for _, fill := range t.fills {
+		if fillTime := orderTime(fill.orderID); fillTime.After(last) {
+			last = fillTime
+		}
+	}
+	return last
+}
+
+// addExecution keeps an execution listed under its order as a fill of the order's transaction. The order row is
+// already the total of its executions, so the first execution replaces the order row when it was merged as a fill.
+func (t *Transaction) addExecution(execution Transaction, first bool) {
+	if first && len(t.fills) > 0 {
+		t.fills = t.fills[:len(t.fills)-1]
+	}
+	t.fills = append(t.fills, execution)
+}
+
+// mergeFill merges a partial fill into the transaction and recalculates the totals from all fills.
+func (t *Transaction) mergeFill(fill Transaction) {
+	if t.fills == nil {
+		t.fills = []Transaction{*t}
+	}
+	t.fills = append(t.fills, fill)
+
+	var quantity, value, proceeds, commission, costBasisTotal, realizedPL float64
+	for _, f := range t.fills {
+		fillQuantity := f.shares
+		if f.optionContracts != "" {
+			fillQuantity = f.optionContracts
+		}
+		q := parseAmount(fillQuantity)
+		quantity += q
+		value += q * parseAmount(f.price)
+		proceeds += parseAmount(f.proceeds)
+		commission += parseAmount(f.commission)
+		costBasisTotal += parseAmount(f.costBasisTotal)
+		realizedPL += parseAmount(f.realizedPL)
+	}
+
+	if t.optionContracts != "" {
+		t.optionContracts = strconv.FormatFloat(quantity, 'f', -1, 64)
+	} else {
+		t.shares = strconv.FormatFloat(quantity, 'f', -1, 64)
+	}
+
+	// volume weighted average price, rounded to 9 decimal places like IBKR prices (e.g. 10.588333333)
+	price := math.Round(value/quantity*1e9) / 1e9
+	t.price = strconv.FormatFloat(price, 'f', -1, 64)
+
+	t.proceeds = fmt.Sprintf("%.2f", proceeds)
+	t.commission = fmt.Sprint(commission)
+
+	// cost basis will be blank when the transaction was condensed with an option assignment / exercise
+	if t.costBasisBuyOrOption != "" {
+		t.costBasisBuyOrOption = fmt.Sprint(proceeds + commission)
+	}
+	if t.costBasisTotal != "" {
+		t.costBasisTotal = fmt.Sprint(costBasisTotal)
+	}
+	if t.realizedPL != "" {
+		t.realizedPL = fmt.Sprint(realizedPL)
+	}
+}
+
+// parseAmount parses an IBKR amount (e.g. "4,838.82"), a blank amount is 0.
+func parseAmount(amount string) float64 {
+	if amount == "" {
+		return 0
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(amount, ",", ""), 64)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
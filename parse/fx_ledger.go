@@ -0,0 +1,343 @@
+package parse
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FxLedger tracks foreign currency cash of each account to calculate the realized forex gain / loss in the home
+// currency (e.g. CAD) whenever foreign currency (e.g. USD) is spent or converted back.
+// The cost of each currency is the average cost of all of it held in the account (adjusted cost base).
+type FxLedger struct {
+	homeCurrency string
+
+	// cash held by account ID and currency
+	balances     map[string]map[string]*fxBalance
+	dispositions []FxDisposition
+}
+
+// fxBalance is the foreign currency held in an account with its cost in the home currency.
+type fxBalance struct {
+	amount float64
+	cost   float64
+	lots   []fxLot // acquisitions of the currency
+}
+
+// fxLot is foreign currency acquired on a date (e.g. bought with forex, proceeds from a sale, dividend).
+type fxLot struct {
+	date   string
+	amount float64
+	cost   float64 // in home currency
+	source string
+}
+
+// FxDisposition is foreign currency spent or converted with the realized forex gain / loss in the home currency.
+type FxDisposition struct {
+	account  string
+	date     string
+	currency string
+	amount   float64 // foreign currency disposed, always positive
+	proceeds float64 // value in home currency at the time of disposition
+	cost     float64 // adjusted cost base in home currency
+	gain     float64 // proceeds - cost
+	source   string  // e.g. Trade TECK, Forex
+}
+
+// FxDifference is a difference between the foreign currency tracked by the ledger and the statement's
+// "Forex Balances" section.
+type FxDifference struct {
+	account   string
+	currency  string
+	statement float64
+	ledger    float64
+}
+
+// cashFlow is a change to foreign currency cash from a transaction.
+type cashFlow struct {
+	accountID string
+	date      string
+	timestamp string // e.g. 20230605111759 from the order ID, blank for dividends and fees
+	currency  string
+	amount    float64
+	homeValue float64 // exact value in home currency when known (e.g. forex with the home currency)
+	exact     bool
+	source    string
+}
+
+// forexBalance is a row from the statement's "Forex Balances" section.
+type forexBalance struct {
+	accountID string
+	date      string
+	currency  string
+	quantity  string
+}
+
+func NewFxLedger(homeCurrency string) *FxLedger {
+	return &FxLedger{
+		homeCurrency: homeCurrency,
+		balances:     make(map[string]map[string]*fxBalance),
+	}
+}
+
+// SetOpeningBalance sets the foreign currency held in the account before the first tracked transaction and its
+// cost in the home currency.
+func (l *FxLedger) SetOpeningBalance(accountID string, currency string, amount float64, cost float64) {
+	balance := l.balance(accountID, currency)
+	balance.amount = amount
+	balance.cost = cost
+	balance.lots = []fxLot{{amount: amount, cost: cost, source: "opening balance"}}
+}
+
+func (l *FxLedger) balance(accountID string, currency string) *fxBalance {
+	if l.balances[accountID] == nil {
+		l.balances[accountID] = make(map[string]*fxBalance)
+	}
+	if l.balances[accountID][currency] == nil {
+		l.balances[accountID][currency] = &fxBalance{}
+	}
+	return l.balances[accountID][currency]
+}
+
+// TrackForex applies the foreign currency cash flows of the transactions to the ledger in date order.
+// Currency acquired on a date is added before currency spent on the same date, then trades are applied in the order
+// they were made. Cash flows that can't be converted to the home currency because the statements have no exchange
+// rate for the currency are an error, the flows before it are applied.
+func (j *Journal) TrackForex(ledger *FxLedger, transactions []Transaction) error {
+	var flows []cashFlow
+	for _, transaction := range transactions {
+		flows = append(flows, cashFlows(transaction, ledger.homeCurrency)...)
+	}
+	sort.SliceStable(flows, func(a, b int) bool {
+		if flows[a].date != flows[b].date {
+			return flows[a].date < flows[b].date
+		}
+		if (flows[a].amount > 0) != (flows[b].amount > 0) {
+			return flows[a].amount > 0
+		}
+		if flows[a].timestamp != flows[b].timestamp {
+			return flows[a].timestamp < flows[b].timestamp
+		}
+		return flows[a].source < flows[b].source
+	})
+
+	for _, flow := range flows {
+		if flow.currency == ledger.homeCurrency || flow.amount == 0 {
+			continue
+		}
+		if !flow.exact {
+			homeValue, err := j.homeValue(flow, ledger.homeCurrency)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", flow.accountID, flow.source, err)
+			}
+			flow.homeValue = homeValue
+		}
+		ledger.apply(flow)
+	}
+	return nil
+}
+
+// cashFlows finds the foreign currency cash flows of a transaction.
+func cashFlows(transaction Transaction, homeCurrency string) []cashFlow {
+	flow := cashFlow{
+		accountID: transaction.accountID,
+		date:      transaction.date,
+		timestamp: transaction.orderID[strings.LastIndex(transaction.orderID, "-")+1:],
+		currency:  transaction.currency,
+		source:    transaction.action + " " + transaction.ticker,
+	}
+
+	switch {
+	case transaction.action == "Forex":
+		bought := flow
+		bought.currency = transaction.forexBuyCurrency
+		bought.amount = parseAmount(transaction.forexBuyAmount)
+		bought.source = "Forex"
+
+		sold := flow
+		sold.currency = transaction.forexSellCurrency
+		sold.amount = parseAmount(transaction.forexSellAmount)
+		sold.source = "Forex"
+
+		// the value of one side of the conversion is exact when the other side is in the home currency, cross pairs
+		// (e.g. EUR.USD for a CAD home currency) are valued with the exchange rates
+		if sold.currency == homeCurrency {
+			bought.homeValue, bought.exact = -sold.amount, true
+		}
+		if bought.currency == homeCurrency {
+			sold.homeValue, sold.exact = -bought.amount, true
+		}
+
+		commission := flow
+		commission.currency = transaction.currency
+		if transaction.commissionCurrency != "" {
+			commission.currency = transaction.commissionCurrency
+		}
+		commission.amount = parseAmount(transaction.commission)
+		commission.source = "Forex commission"
+
+		return []cashFlow{bought, sold, commission}
+
+	case transaction.action == "Trade - Future":
+		// futures don't exchange the contract value, only the mark-to-market P/L is settled in cash
+		flow.amount = parseAmount(transaction.mtmPL) + parseAmount(transaction.commission)
+
+	case transaction.proceeds != "":
+		// trades, bonds are bought and sold with the accrued interest
+		flow.amount = parseAmount(transaction.proceeds) + parseAmount(transaction.commission) +
+			parseAmount(transaction.accruedInterest)
+
+	default:
+		// dividends with withholding tax, fees
+		flow.amount = parseAmount(transaction.dividend) + parseAmount(transaction.fee)
+	}
+	return []cashFlow{flow}
+}
+
+// homeValue converts the cash flow to the home currency with the statement exchange rates.
+func (j *Journal) homeValue(flow cashFlow, homeCurrency string) (float64, error) {
+	baseCurrency := j.findAccount(flow.accountID).baseCurrency
+	rate := func(currency string) (float64, error) {
+		if currency == baseCurrency {
+			return 1, nil
+		}
+		r := j.fxRate(flow.date, currency)
+		if r == "" {
+			return 0, fmt.Errorf("no %s exchange rate on %s", currency, flow.date)
+		}
+		value, err := strconv.ParseFloat(r, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s exchange rate %q on %s", currency, r, flow.date)
+		}
+		return value, nil
+	}
+	rateFrom, err := rate(flow.currency)
+	if err != nil {
+		return 0, err
+	}
+	rateTo, err := rate(homeCurrency)
+	if err != nil {
+		return 0, err
+	}
+	return flow.amount * rateFrom / rateTo, nil
+}
+
+func (l *FxLedger) apply(flow cashFlow) {
+	balance := l.balance(flow.accountID, flow.currency)
+
+	if flow.amount > 0 {
+		balance.amount += flow.amount
+		balance.cost += flow.homeValue
+		balance.lots = append(balance.lots, fxLot{date: flow.date, amount: flow.amount, cost: flow.homeValue, source: flow.source})
+		return
+	}
+
+	disposed := -flow.amount
+	proceeds := -flow.homeValue
+
+	// currency disposed beyond the tracked balance (e.g. no opening balance) has a cost of its current value,
+	// so no gain is realized on it
+	cost := proceeds
+	if balance.amount > 0 {
+		tracked := math.Min(disposed, balance.amount)
+		cost = balance.cost*tracked/balance.amount + proceeds*(disposed-tracked)/disposed
+	}
+
+	balance.amount -= disposed
+	balance.cost -= cost
+
+	l.dispositions = append(l.dispositions, FxDisposition{
+		account:  flow.accountID,
+		date:     flow.date,
+		currency: flow.currency,
+		amount:   disposed,
+		proceeds: proceeds,
+		cost:     cost,
+		gain:     proceeds - cost,
+		source:   flow.source,
+	})
+}
+
+// Dispositions returns every time foreign currency was spent or converted, in date order.
+func (l *FxLedger) Dispositions() []FxDisposition {
+	return l.dispositions
+}
+
+// RealizedGain returns the total realized forex gain / loss in the home currency.
+func (l *FxLedger) RealizedGain() float64 {
+	gain := 0.0
+	for _, disposition := range l.dispositions {
+		gain += disposition.gain
+	}
+	return gain
+}
+
+// ReconcileForex compares the foreign currency held in the ledger to the statements' "Forex Balances" sections
+// and returns the currencies that don't match.
+func (j *Journal) ReconcileForex(ledger *FxLedger) []FxDifference {
+	// only compare against the latest balance of each account and currency
+	latest := make(map[string]forexBalance)
+	for _, balance := range j.forexBalances {
+		key := balance.accountID + " " + balance.currency
+		if balance.date >= latest[key].date {
+			latest[key] = balance
+		}
+	}
+
+	var differences []FxDifference
+	for _, balance := range latest {
+		if balance.currency == ledger.homeCurrency {
+			continue
+		}
+		statement := parseAmount(balance.quantity)
+		tracked := ledger.balance(balance.accountID, balance.currency).amount
+		// IBKR balances have up to 9 decimal places
+		if math.Abs(statement-tracked) > 0.005 {
+			differences = append(differences, FxDifference{
+				account:   balance.accountID,
+				currency:  balance.currency,
+				statement: statement,
+				ledger:    tracked,
+			})
+		}
+	}
+	sort.Slice(differences, func(a, b int) bool {
+		return differences[a].account+differences[a].currency < differences[b].account+differences[b].currency
+	})
+	return differences
+}
+
+func (d FxDifference) String() string {
+	return fmt.Sprintf("%s %s: statement %.2f, ledger %.2f", d.account, d.currency, d.statement, d.ledger)
+}
+
+// ToCsv writes the forex dispositions with their realized gain / loss to a CSV file.
+func (l *FxLedger) ToCsv(csvPath string) {
+	rows := [][]string{{"Date", "Account", "Currency", "Amount", "Proceeds", "Cost", "Gain", "Source"}}
+	for _, d := range l.dispositions {
+		rows = append(rows, []string{
+			d.date,
+			d.account,
+			d.currency,
+			fmt.Sprintf("%.2f", d.amount),
+			fmt.Sprintf("%.2f", d.proceeds),
+			fmt.Sprintf("%.2f", d.cost),
+			fmt.Sprintf("%.2f", d.gain),
+			d.source,
+		})
+	}
+
+	f, err := os.Create(csvPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	writer := csv.NewWriter(f)
+	writer.WriteAll(rows)
+}
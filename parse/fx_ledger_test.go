@@ -0,0 +1,86 @@
+package parse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackForex(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/3-forex.csv")
+
+	ledger := NewFxLedger("CAD")
+	require.NoError(t, journal.TrackForex(ledger, transactions))
+
+	// USD bought with CAD and from selling the call pays for the stock and the forex commission
+	dispositions := ledger.Dispositions()
+	require.Len(t, dispositions, 2)
+
+	// forex commission was charged before the stock was bought
+	require.Equal(t, "Forex commission", dispositions[0].source)
+	require.InDelta(t, 2, dispositions[0].amount, 1e-9)
+
+	require.Equal(t, "U1234567", dispositions[1].account)
+	require.Equal(t, "2023-06-05", dispositions[1].date)
+	require.Equal(t, "USD", dispositions[1].currency)
+	require.Equal(t, "Trade TECK", dispositions[1].source)
+	require.InDelta(t, 4209.37025725, dispositions[1].amount, 1e-9)
+	require.InDelta(t, 5659.43, dispositions[1].proceeds, 0.005)
+	require.InDelta(t, 5654.92, dispositions[1].cost, 0.005)
+	require.InDelta(t, 4.51, dispositions[1].gain, 0.005)
+
+	require.InDelta(t, 4.51, ledger.RealizedGain(), 0.005)
+
+	// the statement balance includes USD held before the statement period
+	differences := journal.ReconcileForex(ledger)
+	require.Len(t, differences, 1)
+	require.Equal(t, "U1234567 USD: statement 4350.18, ledger 1133.39", differences[0].String())
+}
+
+func TestTrackForexOpeningBalance(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/3-forex.csv")
+
+	// 3216.79 USD held before the statement at a cost of 1.30 CAD
+	ledger := NewFxLedger("CAD")
+	ledger.SetOpeningBalance("U1234567", "USD", 3216.790369, 4181.83)
+	require.NoError(t, journal.TrackForex(ledger, transactions))
+
+	require.Empty(t, journal.ReconcileForex(ledger))
+
+	// lower average cost of the USD held realizes a bigger gain
+	dispositions := ledger.Dispositions()
+	require.Len(t, dispositions, 2)
+	require.Greater(t, dispositions[1].gain, 4.51)
+	require.InDelta(t, dispositions[1].proceeds-dispositions[1].cost, dispositions[1].gain, 1e-9)
+}
+
+func TestTrackForexCrossPair(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/16-forex-usd-cad.csv")
+
+	ledger := NewFxLedger("CAD")
+	ledger.SetOpeningBalance("U1234567", "USD", 3000, 3900)
+	require.NoError(t, journal.TrackForex(ledger, transactions))
+
+	dispositions := ledger.Dispositions()
+	require.Len(t, dispositions, 3)
+	// USD sold for CAD is valued at the CAD received
+	require.InDelta(t, 2662.4, dispositions[0].proceeds, 1e-9)
+
+	// USD sold for EUR is valued at the statement rates, not the EUR amount
+	require.Equal(t, "USD", dispositions[2].currency)
+	require.InDelta(t, 164.448625, dispositions[2].amount, 1e-9)
+	require.InDelta(t, 164.448625/0.755210, dispositions[2].proceeds, 1e-9)
+	require.InDelta(t, 217.75, ledger.balances["U1234567"]["EUR"].cost, 0.005)
+}
+
+func TestTrackForexMissingRate(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/16-forex-usd-cad.csv")
+
+	// the statement has no GBP rate to convert the CAD and EUR to
+	err := journal.TrackForex(NewFxLedger("GBP"), transactions)
+	require.EqualError(t, err, "U1234567 Forex: no GBP exchange rate on 2023-06-20")
+}
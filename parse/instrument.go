@@ -0,0 +1,105 @@
+package parse
+
+import (
+	"sort"
+	"strings"
+)
+
+// instrument is a stock, option, future, bond or fund from the statements' "Financial Instrument Information".
+type instrument struct {
+	symbol        string // as traded in the journal e.g. TECK, TECK 21JUL23 38 C
+	description   string // e.g. TECK RESOURCES LTD-CLS B
+	assetCategory string // e.g. Stocks, Equity and Index Options
+	conid         string // IBKR contract ID
+	securityID    string // ISIN e.g. CA8787422044, blank for options
+	multiplier    string
+	expiry        string // options and futures e.g. 2023-07-21
+	putCall       string // C or P
+	strike        string
+}
+
+// addInstrument adds a row of "Financial Instrument Information" to the instruments.
+// Options are listed under their OCC symbol (e.g. "BPT   230120C00015000") with the description the journal uses as
+// the option's symbol (e.g. "BPT 20JAN23 15 C").
+func (j *Journal) addInstrument(data row) {
+	if j.instruments == nil {
+		j.instruments = make(map[string]instrument)
+	}
+	i := instrument{
+		symbol:        data.get("Symbol"),
+		description:   data.get("Description"),
+		assetCategory: data.get("Asset Category"),
+		conid:         data.get("Conid"),
+		securityID:    data.get("Security ID"),
+		multiplier:    data.get("Multiplier"),
+		expiry:        data.get("Expiry"),
+		putCall:       data.get("Type"),
+		strike:        data.get("Strike"),
+	}
+	if strings.Contains(i.assetCategory, "Options") {
+		i.symbol = i.description
+	} else {
+		// stocks have a security type (e.g. COMMON, ETF) in the same column as the put / call of options
+		i.putCall = ""
+	}
+	j.instruments[i.symbol] = i
+}
+
+// instrument returns the instrument of the symbol. Instruments that aren't in the statements only have what can be
+// told from the symbol e.g. the expiry, strike and put / call of TECK 21JUL23 38 C.
+func (j *Journal) instrument(symbol string) instrument {
+	if i, ok := j.instruments[symbol]; ok {
+		return i
+	}
+	i := instrument{symbol: symbol, description: symbol}
+	if expiry := optionExpiry(symbol); expiry != "" {
+		parts := strings.Split(symbol, " ")
+		i.assetCategory = "Equity and Index Options"
+		i.expiry, i.strike, i.putCall, i.multiplier = expiry, parts[2], parts[3], "100"
+	}
+	return i
+}
+
+// securities returns the instruments traded, received or paid dividends in the transactions, sorted by symbol.
+func (j *Journal) securities(txs []Transaction) []instrument {
+	symbols := make(map[string]string) // symbol -> action of its first trade
+	for _, tx := range txs {
+		symbol := securitySymbol(tx)
+		if action, ok := symbols[symbol]; symbol != "" && (!ok || !strings.HasPrefix(action, "Trade")) {
+			symbols[symbol] = tx.action
+		}
+	}
+	var securities []instrument
+	for symbol, action := range symbols {
+		security := j.instrument(symbol)
+		if security.assetCategory == "" {
+			// e.g. Trade - Bond -> Bonds, when the statements don't have the instrument information
+			switch action {
+			case "Trade - Bond", "Trade - Future", "Trade - Mutual Fund":
+				security.assetCategory = strings.TrimPrefix(action, "Trade - ") + "s"
+			default:
+				security.assetCategory = "Stocks"
+			}
+		}
+		securities = append(securities, security)
+	}
+	sort.Slice(securities, func(a, b int) bool {
+		return securities[a].symbol < securities[b].symbol
+	})
+	return securities
+}
+
+// securitySymbol returns the symbol of the stock, option etc. of the transaction, blank for forex and fees that aren't
+// for a security (e.g. market data).
+func securitySymbol(tx Transaction) string {
+	if tx.action == "Forex" || tx.ticker == "" {
+		return ""
+	}
+	symbol, _ := tradedSymbol(tx)
+	return symbol
+}
+
+// isOption checks if the instrument is an equity or index option.
+func (i instrument) isOption() bool {
+	return i.putCall == "C" || i.putCall == "P" || strings.Contains(i.assetCategory, "Options")
+}
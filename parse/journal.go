@@ -13,14 +13,18 @@ import (
 
 type Transaction struct {
 	ticker     string
-	account    string
+	account    string // account alias e.g. TFSA, or account ID if the account has no alias
+	accountID  string // e.g. U1234567
 	date       string
 	commission string
 	price      string // stock / option price
 
+	currency     string // currency of all the amounts in the transaction e.g. USD, CAD
+	fxRateToBase string // exchange rate from the currency to the account's base currency
+
 	optionContracts string // # of contracts
 	optionContract  string // contract name e.g. PR 20JAN23 9 C
-	shares          string
+	shares          string // shares, or units / contracts of futures, bonds and mutual funds
 	buySell         string // buy / sell / transfer
 	action          string // trade / trade-option / dividend
 	actionModified  string // e.g. "Trade" -> "Trade - Close" (option assignment), "Trade - Option" -> "Trade - Option - Assignment" (option assignment)
@@ -31,18 +35,64 @@ type Transaction struct {
 	costBasisTotal       string // will be calculated, not imported
 	realizedPL           string // will be calculated, not imported
 
-	forexUSDBuy  string // USD bought during CAD -> USD forex
-	forexUSDCAD  string // exchange rate USD/CAD
-	forexCADSell string // CAD sold during CAD -> USD forex
+	forexBuyCurrency   string // currency bought during forex e.g. USD
+	forexBuyAmount     string // amount bought during forex
+	forexSellCurrency  string // currency sold during forex e.g. CAD
+	forexSellAmount    string // amount sold during forex, always negative
+	forexRate          string // exchange rate of the currency pair e.g. 1.3433 for USD.CAD
+	commissionCurrency string // currency of the commission when it's not the transaction currency e.g. forex commission in USD
+
+	multiplier      string // units per contract when it's not a share e.g. 50 for ES futures, 0.01 for bonds priced in % of par
+	accruedInterest string // bond interest paid (negative) or received (positive) with the trade
+	mtmPL           string // futures mark-to-market P/L settled in cash
+	section1256     string // 60/40 for Section 1256 contracts (futures, broad-based index options), 60% long-term / 40% short-term
+
+	value        string // market value of the shares received in a corporate action or transfer
+	acquiredDate string // original acquisition date of transferred shares
+
+	dividend     string // dividend payment
+	dividendType string // Ordinary Dividend, Payment in Lieu (Charged), Return of Capital or Reversal
+	fee          string // e.g. dividend withholding, monthly live data subscription
+	notes        string // automated notes (e.g. dividend payment)
+
+	codes          string // IBKR trade codes (e.g. "CP;O;P")
+	orderID        string // legs executed together (same account, underlying and time) share the same order ID
+	strategy       string // multi-leg strategy e.g. covered call, collar, married put, vertical, roll
+	netDebitCredit string // net cash of all legs in the order, negative for debit and positive for credit
 
-	dividend string // dividend payment
-	fee      string // e.g. dividend withholding, monthly live data subscription
-	notes    string // automated notes (e.g. dividend payment)
+	fills []Transaction // executions of the order and partial fills merged into this transaction when aggregating fills
 }
 
 type Journal struct {
 	// each map entry is for a ticker and all the transactions associated with that ticker
 	trades map[string][]Transaction
+
+	// accounts from the "Account Information" section of all statements, by account ID
+	accounts map[string]Account
+
+	// exchange rates to the base currency of all statements
+	rates []statementRates
+
+	// foreign currency cash at the end of each statement
+	forexBalances []forexBalance
+
+	// dividends and their reversals that were netted out against each other
+	reversedDividends []Transaction
+
+	// dividends of the store, matched by the withholding tax and reversals of the statements read after it
+	storedDividends []Transaction
+
+	// contract multipliers from the statements' "Financial Instrument Information" by symbol e.g. ESU3: 50
+	multipliers map[string]string
+
+	// stocks, options etc. from the statements' "Financial Instrument Information" by symbol e.g. TECK, TECK 21JUL23 38 C
+	instruments map[string]instrument
+
+	// merge partial fills of the same order into a single transaction
+	aggregateFills bool
+
+	// columns written by ToCsv, DefaultLayout when nil
+	layout *Layout
 }
 
 func NewJournal() Journal {
@@ -54,7 +104,7 @@ func NewJournal() Journal {
 func ScrubFile(csvPath string) {
 	input, err := os.ReadFile(csvPath)
 	if err != nil {
-		log.Fatal(err)
+		panic(err)
 	}
 
 	lines := strings.Split(string(input), "\n")
@@ -67,7 +117,7 @@ func ScrubFile(csvPath string) {
 	output := strings.Join(lines, "\n")
 	err = os.WriteFile(csvPath, []byte(output), 0644)
 	if err != nil {
-		log.Fatalln(err)
+		panic(err)
 	}
 }
 
@@ -78,71 +128,254 @@ func (j *Journal) ReadTransactions(csvPath string) []Transaction {
 
 	file, err := os.Open(csvPath)
 	if err != nil {
-		log.Fatal(err)
+		panic(err)
 	}
 	defer file.Close()
 	reader := csv.NewReader(file)
 
 	// expect variable number of columns so parser won't crash
 	reader.FieldsPerRecord = -1
-	accountAlias := ""
+
+	// account of a single account statement, consolidated statements will have an Account column in each section
+	statementAccount := Account{}
+
+	// last header row of each section
+	headers := make(map[string][]string)
+
+	// exchange rates to the base currency for the statement period
+	rates := statementRates{rates: make(map[string]string)}
+	var forexBalances []forexBalance
+	// interest rows are matched to bond trades once all trades are read
+	var interest []Transaction
+
+	// symbol of the last order, executions listed right after their order are already included in the order totals
+	orderSymbol := ""
+	// transaction of the last order and whether its executions were added as fills yet
+	var order *Transaction
+	orderExecutions := false
+	// the last order was skipped or condensed into another transaction (e.g. an option assignment into its stock
+	// trade), so are its executions
+	skippedOrder := false
 
 	for {
 		rec, err := reader.Read()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			log.Fatal(err)
-		} else
+			panic(err)
+		} else if len(rec) < 3 {
+			// e.g. lines removed by ScrubFile
+			continue
+		} else if rec[1] == "Header" {
+			headers[rec[0]] = rec[2:]
+			continue
+		}
+
+		data := row{header: headers[rec[0]], rec: rec[2:]}
+
+		// account of the data row
+		account := statementAccount
+		if accountID := data.get("Account"); accountID != "" {
+			account = j.findAccount(accountID)
+		}
 
-		// find account alias
-		if rec[0] == "Account Information" && rec[1] == "Data" && rec[2] == "Account Alias" {
-			accountAlias = rec[3]
-		} else if rec[0] == "Dividends" && rec[1] == "Data" && rec[2] == "USD" {
+		// currency of the data row, total rows (e.g. "Total", "Total in USD") don't have a currency
+		currency := data.get("Currency")
+		if strings.HasPrefix(currency, "Total") {
+			currency = ""
+		}
+
+		if rec[0] == "Statement" && rec[1] == "Data" && data.get("Field Name") == "Period" {
+			rates.from, rates.to = statementPeriod(data.get("Field Value"))
+		} else if rec[0] == "Base Currency Exchange Rate" && rec[1] == "Data" && currency != "" {
+			rates.rates[currency] = data.get("Rate")
+		} else if rec[0] == "Forex Balances" && rec[1] == "Data" && data.get("Asset Category") == "Forex" {
+			// e.g. Forex,USD,CAD,0.013143 is 0.013143 CAD held, valued in USD
+			forexBalances = append(forexBalances, forexBalance{
+				accountID: account.id,
+				currency:  data.get("Description"),
+				quantity:  data.get("Quantity"),
+			})
+		} else if rec[0] == "Account Information" && rec[1] == "Data" && data.get("Field Name") != "" {
+			// single account statement lists the account as field name / value pairs
+			statementAccount.set(data.get("Field Name"), data.get("Field Value"))
+			j.registerAccount(statementAccount)
+		} else if rec[0] == "Account Information" && rec[1] == "Data" {
+			// consolidated statement lists each account on its own row
+			for _, field := range data.header {
+				account.set(field, data.get(field))
+			}
+			j.registerAccount(account)
+		} else if rec[0] == "Dividends" && rec[1] == "Data" && currency != "" {
 			// dividend transaction
-			ticker := strings.Split(rec[4], "(") // e.g. MSFT(US5949181045) Cash Dividend USD 0.68 per Share (Ordinary Dividend)
+			description := data.get("Description")
+			ticker := strings.Split(description, "(") // e.g. MSFT(US5949181045) Cash Dividend USD 0.68 per Share (Ordinary Dividend)
 
 			transaction := Transaction{
-				date:     rec[3],
-				account:  accountAlias,
-				action:   "Dividend",
-				ticker:   ticker[0],
-				dividend: rec[5],
-				notes:    rec[4],
+				date:         data.get("Date"),
+				account:      account.label(),
+				accountID:    account.id,
+				currency:     currency,
+				action:       "Dividend",
+				ticker:       ticker[0],
+				dividend:     data.get("Amount"),
+				dividendType: dividendType(description, data.get("Amount")),
+				notes:        description,
 			}
 			j.addTransaction(transaction)
-		} else if rec[0] == "Withholding Tax" && rec[1] == "Data" && rec[2] == "USD" {
-			// some dividend payments will have 15% withholding tax
-
+		} else if rec[0] == "Withholding Tax" && rec[1] == "Data" && currency != "" {
+			// tax withheld from dividends (negative) or refunded (positive)
 			// e.g. SMG(US8101861065) Payment in Lieu of Dividend - US Tax
-			ticker := strings.Split(rec[4], "(")[0]
-
-			// look up transactions by ticker and ensure there's a single dividend transaction
-			transaction := j.findSingleTransaction(ticker, "Dividend")
-			if transaction == nil {
-				panic(fmt.Sprintf("expected single dividend transaction for ticker %s", ticker))
+			description := data.get("Description")
+
+			j.withholdingTax(Transaction{
+				date:      data.get("Date"),
+				account:   account.label(),
+				accountID: account.id,
+				currency:  currency,
+				ticker:    strings.Split(description, "(")[0],
+				fee:       data.get("Amount"),
+				notes:     description,
+			})
+		} else if isFeeSection(rec[0]) && rec[1] == "Data" && currency != "" {
+			// account charges e.g. monthly live data subscription
+			// e.g. Other Fees,USD,2023-06-05,P*****42:OPRA TOP OF BOOK (L1) (NP) FOR MAY 2023,-1.5
+			j.addTransaction(Transaction{
+				date:      data.get("Date"),
+				account:   account.label(),
+				accountID: account.id,
+				currency:  currency,
+				action:    "Fee",
+				fee:       data.get("Amount"),
+				notes:     data.get("Description"),
+			})
+		} else if rec[0] == "Financial Instrument Information" && rec[1] == "Data" {
+			if data.get("Multiplier") != "" {
+				if j.multipliers == nil {
+					j.multipliers = make(map[string]string)
+				}
+				j.multipliers[data.get("Symbol")] = data.get("Multiplier")
 			}
+			j.addInstrument(data)
+		} else if rec[0] == "Interest" && rec[1] == "Data" && strings.Contains(data.get("Description"), "Accrued Interest") {
+			// interest paid or received when trading bonds e.g. Purchase Accrued Interest T 3 1/2 02/15/33
+			interest = append(interest, Transaction{
+				date:      data.get("Date"),
+				account:   account.label(),
+				accountID: account.id,
+				currency:  currency,
+				action:    "Interest",
+				dividend:  data.get("Amount"),
+				notes:     data.get("Description"),
+			})
+		} else if rec[0] == "Borrow Fee Details" && rec[1] == "Data" && currency != "" {
+			// daily fee for borrowing hard to borrow shares of a short position
+			j.addTransaction(Transaction{
+				date:      data.get("Value Date"),
+				account:   account.label(),
+				accountID: account.id,
+				currency:  currency,
+				action:    "Fee",
+				ticker:    data.get("Symbol"),
+				fee:       data.get("Total Charges"),
+				notes:     fmt.Sprintf("borrow fee %s%% on %s shares", data.get("Fee Rate (%)"), strings.TrimPrefix(data.get("Quantity"), "-")),
+			})
+		} else if rec[0] == "Corporate Actions" && rec[1] == "Data" && data.get("Asset Category") == "Stocks" {
+			// e.g. GOOGL(US02079K3059) Split 20 for 1 (GOOGL, ALPHABET INC-CL A, US02079K3059)
+			description := data.get("Description")
+			shares := data.get("Quantity")
 
-			transaction.fee = rec[5]
-			transaction.notes += "\n15% tax withdrawn"
+			transaction := Transaction{
+				date:      strings.Split(data.get("Date/Time"), ", ")[0],
+				account:   account.label(),
+				accountID: account.id,
+				currency:  currency,
+				action:    "Corporate Action - " + corporateActionType(description),
+				ticker:    strings.Split(description, "(")[0],
+				shares:    shares,
+				proceeds:  data.get("Proceeds"),
+				value:     data.get("Value"),
+				notes:     description,
+			}
+			if strings.HasPrefix(shares, "-") {
+				transaction.buySell = "Sell"
+			} else {
+				transaction.buySell = "Buy"
+			}
+			j.addTransaction(transaction)
+		} else if rec[0] == "Transfers" && rec[1] == "Data" && data.get("Asset Category") == "Stocks" {
+			// shares moved between our IBKR accounts (Internal) or from / to another broker (ACATS)
+			shares := strings.TrimPrefix(data.get("Qty"), "-")
+			direction := "in from"
+			if data.get("Direction") == "Out" {
+				shares = "-" + shares
+				direction = "out to"
+			}
+			transferType := data.get("Type")
+			if transferType == "Internal" {
+				transferType = "internal"
+			}
 
-			j.updateSingleTransaction(ticker, *transaction)
-		} else if rec[0] == "Trades" && rec[1] == "Data" && rec[2] == "Order" {
+			transaction := Transaction{
+				date:         data.get("Date"),
+				account:      account.label(),
+				accountID:    account.id,
+				currency:     currency,
+				action:       "Transfer",
+				ticker:       data.get("Symbol"),
+				buySell:      "Transfer",
+				shares:       shares,
+				price:        data.get("Xfer Price"),
+				value:        data.get("Market Value"),
+				acquiredDate: data.get("Acquisition Date"),
+				codes:        data.get("Code"),
+			}
+			// internal transfers don't have a company e.g. --,U1237792
+			counterparty := strings.TrimSpace(strings.TrimPrefix(data.get("Xfer Company"), "--") + " " + data.get("Xfer Account"))
+			transaction.notes = fmt.Sprintf("%s transfer %s %s", transferType, direction, counterparty)
+			// cost basis reported by the other broker, negative like a buy
+			if basis := data.get("Cost Basis"); basis != "" {
+				transaction.costBasisTotal = fmt.Sprint(-parseAmount(basis))
+			}
+			j.addTransaction(transaction)
+		} else if rec[0] == "Trades" && rec[1] == "Data" && (rec[2] == "Order" || rec[2] == "Execution") {
 			// find trade transactions
+			symbol := data.get("Symbol")
+			// executions listed right after their order are already included in the order totals
+			execution := rec[2] == "Execution" && symbol == orderSymbol
+			if rec[2] == "Order" {
+				orderSymbol, order, skippedOrder = symbol, nil, true
+			}
+			if execution && skippedOrder {
+				continue
+			}
+
+			dateTime := strings.Split(data.get("Date/Time"), ", ")
 
-			dateTime := strings.Split(rec[6], ", ")
+			// options symbol will have the underlying in the first split index: PR 20JAN23 9 C
+			underlying := strings.Split(symbol, " ")[0]
 
+			// forex commission is in the base currency e.g. "Comm in CAD"
 			transaction := Transaction{
 				date:       dateTime[0],
-				account:    accountAlias,
-				commission: rec[11],
+				account:    account.label(),
+				accountID:  account.id,
+				currency:   currency,
+				commission: data.get("Comm/Fee", "Comm in "+baseCommissionCurrency(data.header)),
+				codes:      data.get("Code"),
+				orderID:    orderID(account.label(), underlying, data.get("Date/Time")),
+			}
+
+			assetCategory := data.get("Asset Category")
+			if assetCategory == "Equity and Index Options" && isCashSettled(underlying) {
+				assetCategory = "Index Options"
 			}
-			switch rec[3] {
+			switch assetCategory {
 			case "Stocks":
-				transaction.price = rec[8]
+				transaction.price = data.get("T. Price")
 				// stock ticker will be in this column
-				transaction.ticker = rec[5]
-				transaction.shares = rec[7]
+				transaction.ticker = symbol
+				transaction.shares = data.get("Quantity")
 				transaction.optionContracts = ""
 				transaction.action = "Trade"
 				if strings.HasPrefix(transaction.shares, "-") {
@@ -175,11 +408,24 @@ func (j *Journal) ReadTransactions(csvPath string) []Transaction {
 				transaction.costBasisBuyOrOption = fmt.Sprint(costBasisBuyOrOption)
 				transaction.costBasisTotal = transaction.costBasisBuyOrOption
 
-				// for call assignments and GTC target hits, there will be negative shares multiple of -100
-				if shares < 0 && math.Mod(shares, -100) == 0 {
+				// stock delivered by an option assignment / exercise is matched to the option as a regular trade
+				optionDelivery := hasCode(transaction.codes, "A") || hasCode(transaction.codes, "Ex")
+
+				if shares < 0 && hasCode(transaction.codes, "O") && !optionDelivery {
+					// selling shares that aren't owned opens a short position, cost basis is the cash received
+					transaction.action = "Trade - Short"
+				} else if shares > 0 && hasCode(transaction.codes, "C") && !optionDelivery {
+					// buy to cover closes the short position
+					transaction.action = "Trade - Cover"
+
+					// cost basis of a short position is positive from IBKR (cash received), so make it negative
+					transaction.costBasisTotal = fmt.Sprint(-parseAmount(data.get("Basis")))
+					transaction.realizedPL = data.get("Realized P/L")
+				} else if shares < 0 && math.Mod(shares, -100) == 0 {
+					// for call assignments and GTC target hits, there will be negative shares multiple of -100
 					// cost basis total will be different from transaction.costBasisBuyOrOption and we will need this to
 					// calculate cost basis per share
-					costBasisTotal, err := strconv.ParseFloat(rec[12], 64)
+					costBasisTotal, err := strconv.ParseFloat(data.get("Basis"), 64)
 					if err != nil {
 						panic(err)
 					}
@@ -188,16 +434,16 @@ func (j *Journal) ReadTransactions(csvPath string) []Transaction {
 					transaction.costBasisTotal = fmt.Sprint(costBasisTotal)
 
 					// import this figure directly from IBKR since it takes into account previous option credit
-					transaction.realizedPL = rec[13]
+					transaction.realizedPL = data.get("Realized P/L")
 				}
 
 			case "Equity and Index Options":
-				transaction.price = rec[8]
-				optionTicker := strings.Split(rec[5], " ")
+				transaction.price = data.get("T. Price")
+				optionTicker := strings.Split(symbol, " ")
 				// options ticker will be in first split index: PR 20JAN23 9 C
-				optionContract := strings.Split(rec[5], optionTicker[0]+" ")
+				optionContract := strings.Split(symbol, optionTicker[0]+" ")
 				transaction.ticker = optionTicker[0]
-				transaction.optionContracts = rec[7]
+				transaction.optionContracts = data.get("Quantity")
 				transaction.optionContract = optionContract[1] //extract "20JAN23 9 C" from "PR 20JAN23 9 C"
 				transaction.action = "Trade - Option"
 				if strings.HasPrefix(transaction.optionContracts, "-") {
@@ -217,85 +463,90 @@ func (j *Journal) ReadTransactions(csvPath string) []Transaction {
 					panic(err)
 				}
 
-				// skip lapsed call or put (expired OTM) which won't have a matching stock trade transaction
-				singleTransaction := j.findSingleTransaction(transaction.ticker, "Trade")
-				if price == 0 && singleTransaction == nil {
-					continue
-				}
-
 				// extract the strike price from the option contract name
 				// e.g. 21JUL23 50 C will extract 50
 				// e.g. 21JUL23 140 P will extract 140
 				strike := strings.Split(transaction.optionContract, " ")[1]
 
-				// check that the option strike price matches the stock trade transaction
-				// e.g. 21JUL23 50 C will match a stock sell price of 50
-				// e.g. 21JUL23 140 P will match a stock sell price of 140
-				if price == 0 && singleTransaction.price != strike {
-					continue
-				} else if price == 0 && singleTransaction.price == strike {
-					singleTransaction.costBasisBuyOrOption = ""
+				// check if contract is a call or put (e.g. PR 20JAN23 9 C would extract C)
+				lastLetter := optionContract[1][len(optionContract[1])-1:]
+
+				// option assignments and exercises will have a price of 0
+				if price == 0 {
+					// check that the option strike price matches the stock trade transaction
+					// e.g. 21JUL23 50 C will match a stock sell price of 50
+					// e.g. 21JUL23 140 P will match a stock sell price of 140
+					stockTrade := j.findAssignedStockTrade(transaction, strike)
+					if stockTrade == nil {
+						// skip lapsed call or put (expired OTM) which won't have a matching stock trade transaction
+						continue
+					}
+
+					stockTrade.costBasisBuyOrOption = ""
 					// update stock trade transaction with option contract name
-					singleTransaction.optionContract = transaction.optionContract
-					costBasisTotal, err := strconv.ParseFloat(singleTransaction.costBasisTotal, 64)
+					stockTrade.optionContract = transaction.optionContract
+					costBasisTotal, err := strconv.ParseFloat(stockTrade.costBasisTotal, 64)
 					if err != nil {
 						panic(err)
 					}
-					shares, err := strconv.ParseFloat(singleTransaction.shares, 64)
+					shares, err := strconv.ParseFloat(stockTrade.shares, 64)
 					if err != nil {
 						panic(err)
 					}
 					costBasisPerShare := costBasisTotal / shares
 					// always round to 8 decimal places - Go sometimes is slightly off in decimal calculations
-					singleTransaction.costBasisShare = fmt.Sprintf("%.8f", costBasisPerShare)
-
-					// check if contract is a call or put (e.g. PR 20JAN23 9 C would extract C)
-					switch transaction.optionContract[len(transaction.optionContract)-1:] {
-					// short call option assignments (i.e. short calls called away) will have a price of 0
-					case "C":
-						singleTransaction.actionModified = "Trade - Option - Assignment"
-						singleTransaction.notes = "called away for profit"
-
-					// long put option exercises will have a price of 0
-					case "P":
-						singleTransaction.actionModified = "Trade - Option - Exercise"
-						singleTransaction.notes = "exercised long put"
+					stockTrade.costBasisShare = fmt.Sprintf("%.8f", costBasisPerShare)
+
+					switch {
+					// short call option assignments (i.e. short calls called away)
+					case lastLetter == "C" && !hasCode(transaction.codes, "Ex"):
+						stockTrade.actionModified = "Trade - Option - Assignment"
+						stockTrade.notes = "called away for profit"
+
+					case lastLetter == "C":
+						stockTrade.actionModified = "Trade - Option - Exercise"
+						stockTrade.notes = "exercised long call"
+
+					// long put option exercises
+					case lastLetter == "P" && !hasCode(transaction.codes, "A"):
+						stockTrade.actionModified = "Trade - Option - Exercise"
+						stockTrade.notes = "exercised long put"
+
+					case lastLetter == "P":
+						stockTrade.actionModified = "Trade - Option - Assignment"
+						stockTrade.notes = "assigned short put"
+
 					default:
 						panic("unknown option contract type")
 					}
-
-					j.updateSingleTransaction(transaction.ticker, *singleTransaction)
+					stockTrade.action = stockTrade.actionModified
 
 					// don't add this transaction because long put exercise / short call assignment will be condensed to a single transaction which already exists
 					continue
 				}
 
 				// hit GTC target or closed manually - only for calls
-				// check if contract is a call or put (e.g. PR 20JAN23 9 C would extract C)
-				lastLetter := optionContract[1][len(optionContract[1])-1:]
-
 				if transaction.buySell == "Buy" && lastLetter == "C" {
-					singleTransaction := j.findSingleTransaction(transaction.ticker, "Trade")
-					if singleTransaction != nil {
-						singleTransaction.actionModified = "Trade - Close"
-						singleTransaction.costBasisBuyOrOption = ""
+					stockTrade := j.findClosedStockTrade(transaction)
+					if stockTrade != nil {
+						stockTrade.actionModified = "Trade - Close"
+						stockTrade.action = stockTrade.actionModified
+						stockTrade.costBasisBuyOrOption = ""
 
-						costBasisTotal, err := strconv.ParseFloat(singleTransaction.costBasisTotal, 64)
+						costBasisTotal, err := strconv.ParseFloat(stockTrade.costBasisTotal, 64)
 						if err != nil {
 							panic(err)
 						}
-						shares, err := strconv.ParseFloat(singleTransaction.shares, 64)
+						shares, err := strconv.ParseFloat(stockTrade.shares, 64)
 						if err != nil {
 							panic(err)
 						}
 
 						costBasisPerShare := costBasisTotal / shares
 						// always round to 8 decimal places - Go sometimes is slightly off in decimal calculations
-						singleTransaction.costBasisShare = fmt.Sprintf("%.8f", costBasisPerShare)
-						singleTransaction.notes = "hit GTC target"
+						stockTrade.costBasisShare = fmt.Sprintf("%.8f", costBasisPerShare)
+						stockTrade.notes = "hit GTC target"
 						transaction.notes = "hit GTC target"
-
-						j.updateSingleTransaction(transaction.ticker, *singleTransaction)
 					}
 				}
 
@@ -315,45 +566,151 @@ func (j *Journal) ReadTransactions(csvPath string) []Transaction {
 				costBasisBuyOrOption := proceeds + commission
 				transaction.costBasisBuyOrOption = fmt.Sprint(costBasisBuyOrOption)
 
+			case "Index Options":
+				// cash-settled index options e.g. SPX 16JUN23 4300 C
+				// exercise / assignment settles the option in cash instead of delivering shares, so the settlement is
+				// booked as the proceeds of the option itself
+				transaction.ticker = underlying
+				transaction.optionContract = strings.TrimPrefix(symbol, underlying+" ")
+				transaction.optionContracts = data.get("Quantity")
+				transaction.price = data.get("T. Price")
+				transaction.action = "Trade - Option"
+				transaction.section1256 = "60/40"
+				if strings.HasPrefix(transaction.optionContracts, "-") {
+					transaction.buySell = "Sell"
+				} else {
+					transaction.buySell = "Buy"
+				}
+
+				contracts := parseAmount(transaction.optionContracts)
+				proceeds := parseAmount(data.get("Proceeds"))
+
+				if hasCode(transaction.codes, "A") || hasCode(transaction.codes, "Ex") {
+					transaction.action = "Trade - Option - Cash Settlement"
+					transaction.actionModified = transaction.action
+					transaction.realizedPL = data.get("Realized P/L")
+					if hasCode(transaction.codes, "A") {
+						transaction.notes = "cash settled assignment"
+					} else {
+						transaction.notes = "cash settled exercise"
+					}
+					// settlement value per share e.g. 95 for SPX settling 95 points in the money
+					if parseAmount(transaction.price) == 0 {
+						transaction.price = strconv.FormatFloat(math.Abs(proceeds/(100*contracts)), 'f', -1, 64)
+					}
+				} else if parseAmount(transaction.price) == 0 {
+					// expired worthless
+					continue
+				}
+
+				transaction.proceeds = fmt.Sprintf("%.2f", proceeds)
+				transaction.costBasisShare = "0"
+				transaction.costBasisBuyOrOption = fmt.Sprint(proceeds + parseAmount(transaction.commission))
+
 			case "Forex":
 				transaction.action = "Forex"
 				// Trades,Data,Order,Forex,CAD,USD.CAD,"2023-06-05, 11:17:59","4,838.82",1.3433,,-6499.986906,-2,,,4.259739,
-				transaction.forexUSDBuy = rec[7]
-				transaction.forexUSDCAD = rec[8]
+				// symbol is the currency pair e.g. USD.CAD, quantity is in the first currency and price in the second currency
+				pair := strings.Split(symbol, ".")
+				quantity := data.get("Quantity")
+				transaction.forexRate = data.get("T. Price")
 
+				transaction.commissionCurrency = baseCommissionCurrency(data.header)
 				if transaction.commission == "0" {
 					transaction.commission = ""
 				}
 
-				usdBuyNoComma := strings.ReplaceAll(transaction.forexUSDBuy, ",", "") // remove comma from string
-				usdBuy, err := strconv.ParseFloat(usdBuyNoComma, 64)
+				rate, err := strconv.ParseFloat(transaction.forexRate, 64)
 				if err != nil {
 					panic(err)
 				}
 
-				usdcad, err := strconv.ParseFloat(transaction.forexUSDCAD, 64)
-				if err != nil {
-					panic(err)
-				}
+				// amount of the second currency, use 6 decimal places to correspond with IBKR report
+				counterAmount := fmt.Sprintf("%.6f", parseAmount(quantity)*rate*-1)
 
-				cadSell := usdBuy * usdcad * -1
+				if strings.HasPrefix(quantity, "-") {
+					// e.g. USD.CAD -2,000 sells USD and buys CAD
+					transaction.forexSellCurrency, transaction.forexSellAmount = pair[0], quantity
+					transaction.forexBuyCurrency, transaction.forexBuyAmount = pair[1], counterAmount
+				} else {
+					// e.g. USD.CAD 4,838.82 buys USD and sells CAD
+					transaction.forexBuyCurrency, transaction.forexBuyAmount = pair[0], quantity
+					transaction.forexSellCurrency, transaction.forexSellAmount = pair[1], counterAmount
+				}
 
-				// use 6 decimal places to correspond with IBKR report
-				transaction.forexCADSell = fmt.Sprintf("%.6f", cadSell)
+				// auto conversions are done by IBKR when trading in a currency that the account doesn't have enough of
+				if hasCode(transaction.codes, "AFx") {
+					transaction.notes = fmt.Sprintf("auto converted %s to %s", transaction.forexSellCurrency, transaction.forexBuyCurrency)
+				} else {
+					transaction.notes = fmt.Sprintf("converted %s to %s", transaction.forexSellCurrency, transaction.forexBuyCurrency)
+				}
 
-				if usdBuy < 5 {
-					transaction.notes = "remaining CAD auto converted"
+			case "Futures", "Bonds", "Mutual Funds":
+				// e.g. Trades,Data,Order,Futures,USD,ESU3,"2023-06-05, 10:12:45",1,4290.25,4295,-214512.5,-2.25,214514.75,0,237.5,O
+				transaction.ticker = symbol
+				transaction.shares = data.get("Quantity")
+				transaction.price = data.get("T. Price")
+				transaction.action = "Trade - " + strings.TrimSuffix(assetCategory, "s")
+				if strings.HasPrefix(transaction.shares, "-") {
+					transaction.buySell = "Sell"
 				} else {
-					transaction.notes = "converted all CAD to USD"
+					transaction.buySell = "Buy"
+				}
+
+				// proceeds already include the multiplier (e.g. bond price is % of par)
+				proceeds := parseAmount(data.get("Proceeds"))
+				transaction.proceeds = fmt.Sprintf("%.2f", proceeds)
+				transaction.multiplier = assetMultiplier(assetCategory, proceeds, parseAmount(transaction.shares), parseAmount(transaction.price))
+
+				transaction.costBasisBuyOrOption = fmt.Sprint(proceeds + parseAmount(transaction.commission))
+				transaction.costBasisTotal = transaction.costBasisBuyOrOption
+				if hasCode(transaction.codes, "C") {
+					// cost basis total is from IBKR with the opposite sign
+					transaction.costBasisTotal = fmt.Sprint(-parseAmount(data.get("Basis")))
+					transaction.realizedPL = data.get("Realized P/L")
+				}
+
+				if assetCategory == "Futures" {
+					// futures are marked to market daily, the P/L since the last close is settled in cash
+					transaction.mtmPL = data.get("MTM P/L")
+					transaction.section1256 = "60/40"
 				}
 
 			default:
-				log.Fatal("Invalid transaction type: ", rec[3])
+				// e.g. warrants, CFDs, the rest of the statement is still read
+				log.Printf("%s: skipped %s trade of %s on %s, unsupported asset category", csvPath, data.get("Asset Category"), symbol, transaction.date)
+				continue
+			}
+
+			if execution {
+				// kept as fills of the order for audit
+				order.addExecution(transaction, !orderExecutions)
+				orderExecutions = true
+				continue
+			}
+			orderExecutions, skippedOrder = false, false
+			if j.aggregateFills && transaction.action != "Forex" {
+				if order = j.findFill(transaction); order != nil {
+					order.mergeFill(transaction)
+					continue
+				}
 			}
 			j.addTransaction(transaction)
+			order = &j.trades[transaction.ticker][len(j.trades[transaction.ticker])-1]
 		}
 	}
 
+	j.rates = append(j.rates, rates)
+	for _, balance := range forexBalances {
+		balance.date = rates.to
+		j.forexBalances = append(j.forexBalances, balance)
+	}
+	j.accruedInterest(interest)
+	j.setMultipliers()
+	j.netDividendReversals()
+	j.convertToBase()
+	j.groupOrders()
+
 	var transactions []Transaction
 	for _, tickerTransactions := range j.trades {
 		for _, transaction := range tickerTransactions {
@@ -377,130 +734,13 @@ func (j *Journal) addTransaction(transaction Transaction) {
 	j.trades[transaction.ticker] = transactions
 }
 
-func (j *Journal) findSingleTransaction(ticker string, action string) *Transaction {
-	if j.trades == nil {
-		// when rolling an option there won't be an existing stock transaction so return nil
-		return nil
-	}
-	// get list of transactions for that ticker
-	transactions := j.trades[ticker]
-	if transactions == nil {
-		// when rolling a call / put there won't be an existing stock transaction so return nil
-		return nil
-	}
-
-	// loop over transactions and find the one with the action
-	matchedTransactions := make([]Transaction, 0)
-	for i, v := range transactions {
-		if v.action == action {
-			matchedTransactions = append(matchedTransactions, transactions[i])
-		}
-	}
-
-	if len(matchedTransactions) == 0 {
-		// when rolling an option, there won't be a transaction action to match so return nil
-		return nil
-	}
-
-	// if there is more than 1 transaction with the same action, panic
-	if len(matchedTransactions) > 1 {
-		panic(fmt.Sprintf("expected only 1 transaction for ticker %s with action %s but have %d", ticker, action, len(matchedTransactions)))
-	}
-
-	// return the single matched transaction
-	return &(matchedTransactions)[0]
-}
-
-// update updateSingleTransaction to take another parameter of the Action to match so that can have multiple transactions for the same ticker
-func (j *Journal) updateSingleTransaction(ticker string, transaction Transaction) {
-	if j.trades == nil {
-		panic("No transactions in journal")
-	}
-	// get list of transactions for that ticker
-	transactions := j.trades[ticker]
-	if transactions == nil {
-		panic(fmt.Sprintf("no transactions for ticker %s", ticker))
-	}
-	//if len(transactions) > 1 {
-	//	panic(fmt.Sprintf("expected only 1 transaction for ticker %s but have %d", ticker, len(transactions)))
-	//}
-
-	// loop over transactions and find the one with the action
-	matchedTransactions := make([]Transaction, 0)
-	matchedTransactionIndex := -1
-	for i, v := range transactions {
-		if v.action == transaction.action {
-			matchedTransactions = append(matchedTransactions, transactions[i])
-			matchedTransactionIndex = i
-		}
-	}
-
-	// should only have 1 matched transaction
-	if len(matchedTransactions) == 0 || len(matchedTransactions) > 1 {
-		panic(fmt.Sprintf("expected 1 transaction for ticker %s with action %s but have %d", ticker, transaction.action, len(matchedTransactions)))
-	}
-
-	// update the single matched transaction
-	if transaction.actionModified != "" {
-		transaction.action = transaction.actionModified
-	}
-
-	j.trades[ticker][matchedTransactionIndex] = transaction
-}
-
+// ToCsv writes the transactions to ./transactions.csv with the columns of the journal's layout.
 func (j *Journal) ToCsv(txs []Transaction) {
-	// convert [] Transaction to [] string, so they can be written to CSV
-	var txsStr [][]string
-	for _, tx := range txs {
-		var row []string
-
-		//txsStr[i] = make([]string, 10)
-		row = append(row, tx.date)
-		row = append(row, tx.account)
-		row = append(row, "")
-		row = append(row, tx.action)
-		row = append(row, "")
-		row = append(row, "")
-		row = append(row, tx.ticker)
-		row = append(row, "")
-		row = append(row, "")
-		row = append(row, tx.optionContract)
-		row = append(row, tx.buySell)
-		row = append(row, tx.optionContracts)
-		row = append(row, tx.shares)
-		row = append(row, tx.price)
-		row = append(row, tx.proceeds)
-		row = append(row, "")
-		row = append(row, tx.costBasisShare)
-		row = append(row, tx.costBasisBuyOrOption)
-		row = append(row, tx.costBasisTotal)
-		row = append(row, tx.realizedPL)
-		row = append(row, tx.dividend)
-		row = append(row, tx.commission)
-		row = append(row, "")
-		row = append(row, "")
-		row = append(row, tx.fee)
-		row = append(row, "")
-		row = append(row, tx.forexUSDBuy)
-		row = append(row, tx.forexUSDCAD)
-		row = append(row, tx.forexCADSell)
-		row = append(row, "")
-		row = append(row, "")
-		row = append(row, "")
-		row = append(row, "")
-		row = append(row, "")
-		row = append(row, tx.notes)
-
-		txsStr = append(txsStr, row)
-	}
-
-	// create the file
-	f, err := os.Create("./transactions.csv")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer f.Close()
+	j.WriteCsv(txs, "./transactions.csv")
+}
 
-	writer := csv.NewWriter(f)
-	writer.WriteAll(txsStr)
+// WriteCsv writes the transactions to a CSV file with the columns of the journal's layout.
+func (j *Journal) WriteCsv(txs []Transaction, csvPath string) {
+	layout := j.journalLayout()
+	writeCsv(csvPath, layout.rows(txs))
 }
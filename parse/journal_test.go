@@ -1,6 +1,10 @@
 package parse
 
 import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -16,6 +20,9 @@ func TestReadTransactions(t *testing.T) {
 		{
 			date:                 "2022-11-25",
 			account:              "TFSA",
+			accountID:            "U1237792",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade",
 			ticker:               "PR",
 			buySell:              "Buy",
@@ -25,10 +32,17 @@ func TestReadTransactions(t *testing.T) {
 			costBasisBuyOrOption: "-6355.999999799999",
 			costBasisTotal:       "-6355.999999799999",
 			commission:           "-3",
+			codes:                "CP;O;P",
+			orderID:              "TFSA-PR-20221125111850",
+			strategy:             "collar",
+			netDebitCredit:       "-5209.00",
 		},
 		{
 			date:                 "2022-11-25",
 			account:              "TFSA",
+			accountID:            "U1237792",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade - Option",
 			ticker:               "PR",
 			optionContract:       "20JAN23 9 C",
@@ -39,10 +53,17 @@ func TestReadTransactions(t *testing.T) {
 			costBasisShare:       "0",
 			costBasisBuyOrOption: "1179.9809295",
 			commission:           "-3.0190707",
+			codes:                "CP;O;P",
+			orderID:              "TFSA-PR-20221125111850",
+			strategy:             "collar",
+			netDebitCredit:       "-5209.00",
 		},
 		{
 			date:                 "2022-11-25",
 			account:              "TFSA",
+			accountID:            "U1237792",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade - Option",
 			ticker:               "PR",
 			optionContract:       "20JAN23 5 P",
@@ -53,47 +74,72 @@ func TestReadTransactions(t *testing.T) {
 			costBasisShare:       "0",
 			costBasisBuyOrOption: "-32.9788998",
 			commission:           "-0.9789",
+			codes:                "CP;O;P",
+			orderID:              "TFSA-PR-20221125111850",
+			strategy:             "collar",
+			netDebitCredit:       "-5209.00",
 		},
 	}
 
 	expectedTransactions2 := []Transaction{
 		{
-			date:     "2023-06-08",
-			account:  "RRSP",
-			action:   "Dividend",
-			ticker:   "MSFT",
-			dividend: "136",
-			notes:    "MSFT(US5949181045) Cash Dividend USD 0.68 per Share (Ordinary Dividend)",
+			date:         "2023-06-08",
+			account:      "RRSP",
+			accountID:    "U2084273",
+			currency:     "USD",
+			fxRateToBase: "1",
+			action:       "Dividend",
+			ticker:       "MSFT",
+			dividend:     "136",
+			dividendType: "Ordinary Dividend",
+			notes:        "MSFT(US5949181045) Cash Dividend USD 0.68 per Share (Ordinary Dividend)",
 		},
 	}
 
 	expectedTransactions3 := []Transaction{
 		{
-			date:         "2023-06-05",
-			account:      "Margin",
-			action:       "Forex",
-			commission:   "-2",
-			forexUSDBuy:  "4,838.82",
-			forexUSDCAD:  "1.3433",
-			forexCADSell: "-6499.986906",
-			notes:        "converted all CAD to USD",
+			date:               "2023-06-05",
+			account:            "Margin",
+			accountID:          "U1234567",
+			currency:           "CAD",
+			fxRateToBase:       "0.743780",
+			action:             "Forex",
+			commission:         "-2",
+			commissionCurrency: "USD",
+			forexBuyCurrency:   "USD",
+			forexBuyAmount:     "4,838.82",
+			forexSellCurrency:  "CAD",
+			forexSellAmount:    "-6499.986906",
+			forexRate:          "1.3433",
+			notes:              "converted CAD to USD",
+			orderID:            "Margin-USD.CAD-20230605111759",
 		},
 		{
 			date:                 "2023-06-05",
 			account:              "Margin",
+			accountID:            "U1234567",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade",
 			ticker:               "TECK",
 			buySell:              "Buy",
 			shares:               "100",
 			price:                "42.09",
 			proceeds:             "-4209.00",
-			costBasisBuyOrOption: "-4209.370257250001",
-			costBasisTotal:       "-4209.370257250001",
+			costBasisBuyOrOption: "-4209.37025725",
+			costBasisTotal:       "-4209.37025725",
 			commission:           "-0.37025725",
+			codes:                "CP;O",
+			orderID:              "Margin-TECK-20230605114423",
+			strategy:             "covered call",
+			netDebitCredit:       "-3703.43",
 		},
 		{
 			date:                 "2023-06-05",
 			account:              "Margin",
+			accountID:            "U1234567",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade - Option",
 			ticker:               "TECK",
 			optionContract:       "21JUL23 38 C",
@@ -104,18 +150,26 @@ func TestReadTransactions(t *testing.T) {
 			costBasisShare:       "0",
 			costBasisBuyOrOption: "505.944454",
 			commission:           "-1.055546",
+			codes:                "CP;O",
+			orderID:              "Margin-TECK-20230605114423",
+			strategy:             "covered call",
+			netDebitCredit:       "-3703.43",
 		},
 	}
 
 	expectedTransactions4 := []Transaction{
 		{
-			date:     "2023-06-09",
-			account:  "Margin",
-			action:   "Dividend",
-			ticker:   "SMG",
-			dividend: "66",
-			fee:      "-9.9",
-			notes:    "SMG(US8101861065) Payment in Lieu of Dividend (Ordinary Dividend)\n15% tax withdrawn",
+			date:         "2023-06-09",
+			account:      "Margin",
+			accountID:    "U1234567",
+			currency:     "USD",
+			fxRateToBase: "1",
+			action:       "Dividend",
+			ticker:       "SMG",
+			dividend:     "66",
+			dividendType: "Payment in Lieu",
+			fee:          "-9.9",
+			notes:        "SMG(US8101861065) Payment in Lieu of Dividend (Ordinary Dividend)\n15% tax withdrawn",
 		},
 	}
 
@@ -123,6 +177,9 @@ func TestReadTransactions(t *testing.T) {
 		{
 			date:           "2023-06-08",
 			account:        "RRSP",
+			accountID:      "U1234567",
+			currency:       "USD",
+			fxRateToBase:   "1",
 			action:         "Trade - Option - Assignment",
 			actionModified: "Trade - Option - Assignment",
 			ticker:         "FDX",
@@ -136,6 +193,8 @@ func TestReadTransactions(t *testing.T) {
 			realizedPL:     "3873.744617",  // imports IBKR value
 			commission:     "-0.1385",
 			notes:          "called away for profit",
+			codes:          "A;C",
+			orderID:        "RRSP-FDX-20230608162000",
 		},
 	}
 
@@ -143,6 +202,9 @@ func TestReadTransactions(t *testing.T) {
 		{
 			date:                 "2023-06-08",
 			account:              "TFSA",
+			accountID:            "U1234567",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade - Close",
 			actionModified:       "Trade - Close",
 			ticker:               "BBWI",
@@ -156,10 +218,17 @@ func TestReadTransactions(t *testing.T) {
 			realizedPL:           "326.482091", // imports IBKR value
 			commission:           "-0.51790925",
 			notes:                "hit GTC target",
+			codes:                "C;CP",
+			orderID:              "TFSA-BBWI-20230608093024",
+			strategy:             "covered call - close",
+			netDebitCredit:       "3489.43",
 		},
 		{
 			date:                 "2023-06-08",
 			account:              "TFSA",
+			accountID:            "U1234567",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade - Option",
 			ticker:               "BBWI",
 			optionContract:       "16JUN23 35 C",
@@ -171,6 +240,10 @@ func TestReadTransactions(t *testing.T) {
 			costBasisBuyOrOption: "-654.05155",
 			commission:           "-1.05155",
 			notes:                "hit GTC target",
+			codes:                "C;CP",
+			orderID:              "TFSA-BBWI-20230608093024",
+			strategy:             "covered call - close",
+			netDebitCredit:       "3489.43",
 		},
 	}
 
@@ -179,6 +252,9 @@ func TestReadTransactions(t *testing.T) {
 		{
 			date:                 "2023-06-12",
 			account:              "RRSP",
+			accountID:            "U1234567",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade - Option",
 			ticker:               "HPQ",
 			optionContract:       "16JUN23 27 C",
@@ -189,10 +265,17 @@ func TestReadTransactions(t *testing.T) {
 			costBasisShare:       "0",
 			costBasisBuyOrOption: "-664.6581",
 			commission:           "-0.6581",
+			codes:                "C;P",
+			orderID:              "RRSP-HPQ-20230612122516",
+			strategy:             "roll",
+			netDebitCredit:       "58.67",
 		},
 		{
 			date:                 "2023-06-12",
 			account:              "RRSP",
+			accountID:            "U1234567",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade - Option",
 			ticker:               "HPQ",
 			optionContract:       "18AUG23 27 C",
@@ -203,12 +286,19 @@ func TestReadTransactions(t *testing.T) {
 			costBasisShare:       "0",
 			costBasisBuyOrOption: "723.331228",
 			commission:           "-0.668772",
+			codes:                "O;P",
+			orderID:              "RRSP-HPQ-20230612122516",
+			strategy:             "roll",
+			netDebitCredit:       "58.67",
 		},
 
 		// STNG roll down
 		{
 			date:                 "2023-06-12",
 			account:              "RRSP",
+			accountID:            "U1234567",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade - Option",
 			ticker:               "STNG",
 			optionContract:       "21JUL23 46 C",
@@ -219,10 +309,17 @@ func TestReadTransactions(t *testing.T) {
 			costBasisShare:       "0",
 			costBasisBuyOrOption: "-197.64905",
 			commission:           "-0.64905",
+			codes:                "C;CP",
+			orderID:              "RRSP-STNG-20230612142231",
+			strategy:             "roll",
+			netDebitCredit:       "80.70",
 		},
 		{
 			date:                 "2023-06-12",
 			account:              "RRSP",
+			accountID:            "U1234567",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade - Option",
 			ticker:               "STNG",
 			optionContract:       "21JUL23 44 C",
@@ -233,6 +330,10 @@ func TestReadTransactions(t *testing.T) {
 			costBasisShare:       "0",
 			costBasisBuyOrOption: "278.346278",
 			commission:           "-0.653722",
+			codes:                "CP;O",
+			orderID:              "RRSP-STNG-20230612142231",
+			strategy:             "roll",
+			netDebitCredit:       "80.70",
 		},
 	}
 
@@ -240,6 +341,9 @@ func TestReadTransactions(t *testing.T) {
 		{
 			date:                 "2023-06-15",
 			account:              "TFSA",
+			accountID:            "U1234567",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade - Option",
 			ticker:               "MOS",
 			optionContract:       "16JUN23 32.5 C",
@@ -250,11 +354,18 @@ func TestReadTransactions(t *testing.T) {
 			costBasisShare:       "0",
 			costBasisBuyOrOption: "-625.6581",
 			commission:           "-0.6581",
+			codes:                "C;CP;P",
+			orderID:              "TFSA-MOS-20230615150000",
+			strategy:             "roll",
+			netDebitCredit:       "138.67",
 		},
 
 		{
 			date:                 "2023-06-15",
 			account:              "TFSA",
+			accountID:            "U1234567",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade - Option",
 			ticker:               "MOS",
 			optionContract:       "21JUL23 32.5 C",
@@ -265,15 +376,23 @@ func TestReadTransactions(t *testing.T) {
 			costBasisShare:       "0",
 			costBasisBuyOrOption: "764.3309",
 			commission:           "-0.6691",
+			codes:                "CP;O;P",
+			orderID:              "TFSA-MOS-20230615150000",
+			strategy:             "roll",
+			netDebitCredit:       "138.67",
 		},
 		{
-			date:     "2023-06-15",
-			account:  "TFSA",
-			action:   "Dividend",
-			ticker:   "MOS",
-			dividend: "40",
-			fee:      "-6",
-			notes:    "MOS(US61945C1036) Cash Dividend USD 0.20 per Share (Ordinary Dividend)\n15% tax withdrawn",
+			date:         "2023-06-15",
+			account:      "TFSA",
+			accountID:    "U1234567",
+			currency:     "USD",
+			fxRateToBase: "1",
+			action:       "Dividend",
+			ticker:       "MOS",
+			dividend:     "40",
+			dividendType: "Ordinary Dividend",
+			fee:          "-6",
+			notes:        "MOS(US61945C1036) Cash Dividend USD 0.20 per Share (Ordinary Dividend)\n15% tax withdrawn",
 		},
 	}
 
@@ -281,6 +400,9 @@ func TestReadTransactions(t *testing.T) {
 		{
 			date:                 "2023-07-21",
 			account:              "RRSP",
+			accountID:            "U1234567",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade - Option - Exercise",
 			actionModified:       "Trade - Option - Exercise",
 			ticker:               "STNG",
@@ -295,10 +417,15 @@ func TestReadTransactions(t *testing.T) {
 			realizedPL:           "-1791.673807", // imports IBKR value
 			commission:           "-0.0545",
 			notes:                "exercised long put",
+			codes:                "C;CP;Ex",
+			orderID:              "RRSP-STNG-20230721162000",
 		},
 		{
 			date:                 "2023-07-21",
 			account:              "RRSP",
+			accountID:            "U1234567",
+			currency:             "USD",
+			fxRateToBase:         "1",
 			action:               "Trade - Option - Exercise",
 			actionModified:       "Trade - Option - Exercise",
 			ticker:               "TGT",
@@ -313,6 +440,240 @@ func TestReadTransactions(t *testing.T) {
 			realizedPL:           "-3011.535807", // imports IBKR value
 			commission:           "-0.1265",
 			notes:                "exercised long put",
+			codes:                "C;CP;Ex",
+			orderID:              "RRSP-TGT-20230721162000",
+		},
+	}
+
+	expectedTransactions10 := []Transaction{
+		// GTC target hit for a covered call and a new position opened later the same day
+		{
+			date:                 "2023-06-08",
+			account:              "RRSP",
+			accountID:            "U2084273",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade - Close",
+			actionModified:       "Trade - Close",
+			ticker:               "BBWI",
+			buySell:              "Sell",
+			shares:               "-100",
+			price:                "41.44",
+			proceeds:             "4144.00",
+			costBasisShare:       "-38.17000000",
+			costBasisBuyOrOption: "",
+			costBasisTotal:       "3817",
+			realizedPL:           "326.482091",
+			commission:           "-0.51790925",
+			notes:                "hit GTC target",
+			codes:                "C;CP",
+			orderID:              "RRSP-BBWI-20230608093024",
+			strategy:             "covered call - close",
+			netDebitCredit:       "3489.43",
+		},
+		{
+			date:                 "2023-06-08",
+			account:              "RRSP",
+			accountID:            "U2084273",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade - Option",
+			ticker:               "BBWI",
+			optionContract:       "16JUN23 35 C",
+			buySell:              "Buy",
+			optionContracts:      "1",
+			price:                "6.53",
+			proceeds:             "-653.00",
+			costBasisShare:       "0",
+			costBasisBuyOrOption: "-654.05155",
+			commission:           "-1.05155",
+			notes:                "hit GTC target",
+			codes:                "C;CP",
+			orderID:              "RRSP-BBWI-20230608093024",
+			strategy:             "covered call - close",
+			netDebitCredit:       "3489.43",
+		},
+		{
+			date:                 "2023-06-08",
+			account:              "RRSP",
+			accountID:            "U2084273",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade",
+			ticker:               "BBWI",
+			buySell:              "Buy",
+			shares:               "100",
+			price:                "40",
+			proceeds:             "-4000.00",
+			costBasisBuyOrOption: "-4001",
+			costBasisTotal:       "-4001",
+			commission:           "-1",
+			codes:                "O",
+			orderID:              "RRSP-BBWI-20230608110210",
+		},
+
+		// call assignment for a ticker that was also bought the same day
+		{
+			date:                 "2023-06-08",
+			account:              "RRSP",
+			accountID:            "U2084273",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade",
+			ticker:               "FDX",
+			buySell:              "Buy",
+			shares:               "100",
+			price:                "220",
+			proceeds:             "-22000.00",
+			costBasisBuyOrOption: "-22001",
+			costBasisTotal:       "-22001",
+			commission:           "-1",
+			codes:                "O",
+			orderID:              "RRSP-FDX-20230608103000",
+		},
+		{
+			date:           "2023-06-08",
+			account:        "RRSP",
+			accountID:      "U2084273",
+			currency:       "USD",
+			fxRateToBase:   "1",
+			action:         "Trade - Option - Assignment",
+			actionModified: "Trade - Option - Assignment",
+			ticker:         "FDX",
+			optionContract: "16JUN23 155 C",
+			buySell:        "Sell",
+			shares:         "-100",
+			price:          "155",
+			proceeds:       "15500.00",
+			costBasisShare: "-172.67370257",
+			costBasisTotal: "17267.370257",
+			realizedPL:     "3873.744617",
+			commission:     "-0.1385",
+			notes:          "called away for profit",
+			codes:          "A;C",
+			orderID:        "RRSP-FDX-20230608162000",
+		},
+
+		// bought twice
+		{
+			date:                 "2023-06-08",
+			account:              "RRSP",
+			accountID:            "U2084273",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade",
+			ticker:               "PR",
+			buySell:              "Buy",
+			shares:               "300",
+			price:                "10.5",
+			proceeds:             "-3150.00",
+			costBasisBuyOrOption: "-3151",
+			costBasisTotal:       "-3151",
+			commission:           "-1",
+			codes:                "O",
+			orderID:              "RRSP-PR-20230608094500",
+		},
+		{
+			date:                 "2023-06-08",
+			account:              "RRSP",
+			accountID:            "U2084273",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade",
+			ticker:               "PR",
+			buySell:              "Buy",
+			shares:               "200",
+			price:                "10.4",
+			proceeds:             "-2080.00",
+			costBasisBuyOrOption: "-2081",
+			costBasisTotal:       "-2081",
+			commission:           "-1",
+			codes:                "O",
+			orderID:              "RRSP-PR-20230608131000",
+		},
+
+		// two covered calls on the same stock
+		{
+			date:                 "2023-06-08",
+			account:              "RRSP",
+			accountID:            "U2084273",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade",
+			ticker:               "XOM",
+			buySell:              "Buy",
+			shares:               "100",
+			price:                "105",
+			proceeds:             "-10500.00",
+			costBasisBuyOrOption: "-10501",
+			costBasisTotal:       "-10501",
+			commission:           "-1",
+			codes:                "CP;O",
+			orderID:              "RRSP-XOM-20230608100000",
+			strategy:             "covered call",
+			netDebitCredit:       "-10292.00",
+		},
+		{
+			date:                 "2023-06-08",
+			account:              "RRSP",
+			accountID:            "U2084273",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade - Option",
+			ticker:               "XOM",
+			optionContract:       "21JUL23 110 C",
+			buySell:              "Sell",
+			optionContracts:      "-1",
+			price:                "2.1",
+			proceeds:             "210.00",
+			costBasisShare:       "0",
+			costBasisBuyOrOption: "209",
+			commission:           "-1",
+			codes:                "CP;O",
+			orderID:              "RRSP-XOM-20230608100000",
+			strategy:             "covered call",
+			netDebitCredit:       "-10292.00",
+		},
+		{
+			date:                 "2023-06-08",
+			account:              "RRSP",
+			accountID:            "U2084273",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade",
+			ticker:               "XOM",
+			buySell:              "Buy",
+			shares:               "100",
+			price:                "106",
+			proceeds:             "-10600.00",
+			costBasisBuyOrOption: "-10601",
+			costBasisTotal:       "-10601",
+			commission:           "-1",
+			codes:                "CP;O",
+			orderID:              "RRSP-XOM-20230608140000",
+			strategy:             "covered call",
+			netDebitCredit:       "-10512.00",
+		},
+		{
+			date:                 "2023-06-08",
+			account:              "RRSP",
+			accountID:            "U2084273",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade - Option",
+			ticker:               "XOM",
+			optionContract:       "21JUL23 115 C",
+			buySell:              "Sell",
+			optionContracts:      "-1",
+			price:                "0.9",
+			proceeds:             "90.00",
+			costBasisShare:       "0",
+			costBasisBuyOrOption: "89",
+			commission:           "-1",
+			codes:                "CP;O",
+			orderID:              "RRSP-XOM-20230608140000",
+			strategy:             "covered call",
+			netDebitCredit:       "-10512.00",
 		},
 	}
 
@@ -365,6 +726,10 @@ func TestReadTransactions(t *testing.T) {
 			expectedTransactions: expectedTransactions9,
 			filePath:             "../testdata/input/11-exercise-put.csv",
 		},
+		"multiple trades for the same ticker": {
+			expectedTransactions: expectedTransactions10,
+			filePath:             "../testdata/input/13-multiple-trades-same-ticker.csv",
+		},
 	}
 
 	for k, testData := range testDataMap {
@@ -377,3 +742,879 @@ func TestReadTransactions(t *testing.T) {
 		})
 	}
 }
+
+func TestReadTransactionsAggregateFills(t *testing.T) {
+	stockFills := []Transaction{
+		{
+			date:                 "2023-06-20",
+			account:              "TFSA",
+			accountID:            "U1237792",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade",
+			ticker:               "DVN",
+			buySell:              "Buy",
+			shares:               "100",
+			price:                "48.5",
+			proceeds:             "-4850.00",
+			costBasisBuyOrOption: "-4850.5",
+			costBasisTotal:       "-4850.5",
+			commission:           "-0.5",
+			codes:                "O;P",
+			orderID:              "TFSA-DVN-20230620100112",
+		},
+		{
+			date:                 "2023-06-20",
+			account:              "TFSA",
+			accountID:            "U1237792",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade",
+			ticker:               "DVN",
+			buySell:              "Buy",
+			shares:               "200",
+			price:                "48.2",
+			proceeds:             "-9640.00",
+			costBasisBuyOrOption: "-9641",
+			costBasisTotal:       "-9641",
+			commission:           "-1",
+			codes:                "O;P",
+			orderID:              "TFSA-DVN-20230620100345",
+		},
+	}
+
+	optionFills := []Transaction{
+		{
+			date:                 "2023-06-20",
+			account:              "TFSA",
+			accountID:            "U1237792",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade - Option",
+			ticker:               "DVN",
+			optionContract:       "21JUL23 50 C",
+			buySell:              "Sell",
+			optionContracts:      "-2",
+			price:                "1.5",
+			proceeds:             "300.00",
+			costBasisShare:       "0",
+			costBasisBuyOrOption: "298.75",
+			commission:           "-1.25",
+			codes:                "O;P",
+			orderID:              "TFSA-DVN-20230620100345",
+		},
+		{
+			date:                 "2023-06-20",
+			account:              "TFSA",
+			accountID:            "U1237792",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade - Option",
+			ticker:               "DVN",
+			optionContract:       "21JUL23 50 C",
+			buySell:              "Sell",
+			optionContracts:      "-1",
+			price:                "1.45",
+			proceeds:             "145.00",
+			costBasisShare:       "0",
+			costBasisBuyOrOption: "144.25",
+			commission:           "-0.75",
+			codes:                "O;P",
+			orderID:              "TFSA-DVN-20230620100510",
+		},
+	}
+
+	expectedTransactions := []Transaction{
+		{
+			date:                 "2023-06-20",
+			account:              "TFSA",
+			accountID:            "U1237792",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade",
+			ticker:               "DVN",
+			buySell:              "Buy",
+			shares:               "300",
+			price:                "48.3",
+			proceeds:             "-14490.00",
+			costBasisBuyOrOption: "-14491.5",
+			costBasisTotal:       "-14491.5",
+			commission:           "-1.5",
+			codes:                "O;P",
+			orderID:              "TFSA-DVN-20230620100112",
+			fills:                stockFills,
+		},
+		{
+			date:                 "2023-06-20",
+			account:              "TFSA",
+			accountID:            "U1237792",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade - Option",
+			ticker:               "DVN",
+			optionContract:       "21JUL23 50 C",
+			buySell:              "Sell",
+			optionContracts:      "-3",
+			price:                "1.483333333",
+			proceeds:             "445.00",
+			costBasisShare:       "0",
+			costBasisBuyOrOption: "443",
+			commission:           "-2",
+			codes:                "O;P",
+			orderID:              "TFSA-DVN-20230620100345",
+			fills:                optionFills,
+		},
+		// executions listed under the order are already included in the order, they're kept as its fills
+		{
+			date:                 "2023-06-20",
+			account:              "TFSA",
+			accountID:            "U1237792",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade",
+			ticker:               "OXY",
+			buySell:              "Buy",
+			shares:               "100",
+			price:                "58.1",
+			proceeds:             "-5810.00",
+			costBasisBuyOrOption: "-5810.5",
+			costBasisTotal:       "-5810.5",
+			commission:           "-0.5",
+			codes:                "O",
+			orderID:              "TFSA-OXY-20230620111502",
+			fills: []Transaction{
+				{
+					date:                 "2023-06-20",
+					account:              "TFSA",
+					accountID:            "U1237792",
+					currency:             "USD",
+					fxRateToBase:         "1",
+					action:               "Trade",
+					ticker:               "OXY",
+					buySell:              "Buy",
+					shares:               "60",
+					price:                "58.1",
+					proceeds:             "-3486.00",
+					costBasisBuyOrOption: "-3486.3",
+					costBasisTotal:       "-3486.3",
+					commission:           "-0.3",
+					codes:                "O;P",
+					orderID:              "TFSA-OXY-20230620111501",
+				},
+				{
+					date:                 "2023-06-20",
+					account:              "TFSA",
+					accountID:            "U1237792",
+					currency:             "USD",
+					fxRateToBase:         "1",
+					action:               "Trade",
+					ticker:               "OXY",
+					buySell:              "Buy",
+					shares:               "40",
+					price:                "58.1",
+					proceeds:             "-2324.00",
+					costBasisBuyOrOption: "-2324.2",
+					costBasisTotal:       "-2324.2",
+					commission:           "-0.2",
+					codes:                "O;P",
+					orderID:              "TFSA-OXY-20230620111502",
+				},
+			},
+		},
+	}
+
+	journal := NewJournal()
+	journal.SetAggregateFills(true)
+	actualTransactions := journal.ReadTransactions("../testdata/input/12-partial-fills.csv")
+
+	require.ElementsMatch(t, expectedTransactions, actualTransactions)
+}
+
+func TestReadTransactionsMultiAccount(t *testing.T) {
+	expectedTransactions := []Transaction{
+		{
+			date:         "2023-06-08",
+			account:      "RRSP",
+			accountID:    "U2084273",
+			currency:     "USD",
+			fxRateToBase: "1",
+			action:       "Dividend",
+			ticker:       "MSFT",
+			dividend:     "136",
+			dividendType: "Ordinary Dividend",
+			notes:        "MSFT(US5949181045) Cash Dividend USD 0.68 per Share (Ordinary Dividend)",
+		},
+		{
+			date:                 "2023-06-08",
+			account:              "TFSA",
+			accountID:            "U1237792",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade",
+			ticker:               "PR",
+			buySell:              "Buy",
+			shares:               "100",
+			price:                "10.5",
+			proceeds:             "-1050.00",
+			costBasisBuyOrOption: "-1051",
+			costBasisTotal:       "-1051",
+			commission:           "-1",
+			codes:                "CP;O",
+			orderID:              "TFSA-PR-20230608111850",
+			strategy:             "covered call",
+			netDebitCredit:       "-1002.00",
+		},
+		{
+			date:                 "2023-06-08",
+			account:              "RRSP",
+			accountID:            "U2084273",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade",
+			ticker:               "PR",
+			buySell:              "Buy",
+			shares:               "200",
+			price:                "10.5",
+			proceeds:             "-2100.00",
+			costBasisBuyOrOption: "-2101",
+			costBasisTotal:       "-2101",
+			commission:           "-1",
+			codes:                "CP;O",
+			orderID:              "RRSP-PR-20230608111850",
+			strategy:             "covered call",
+			netDebitCredit:       "-2002.50",
+		},
+		{
+			date:                 "2023-06-08",
+			account:              "TFSA",
+			accountID:            "U1237792",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade - Option",
+			ticker:               "PR",
+			optionContract:       "21JUL23 11 C",
+			buySell:              "Sell",
+			optionContracts:      "-1",
+			price:                "0.5",
+			proceeds:             "50.00",
+			costBasisShare:       "0",
+			costBasisBuyOrOption: "49",
+			commission:           "-1",
+			codes:                "CP;O",
+			orderID:              "TFSA-PR-20230608111850",
+			strategy:             "covered call",
+			netDebitCredit:       "-1002.00",
+		},
+		{
+			date:                 "2023-06-08",
+			account:              "RRSP",
+			accountID:            "U2084273",
+			currency:             "USD",
+			fxRateToBase:         "1",
+			action:               "Trade - Option",
+			ticker:               "PR",
+			optionContract:       "21JUL23 11 C",
+			buySell:              "Sell",
+			optionContracts:      "-2",
+			price:                "0.5",
+			proceeds:             "100.00",
+			costBasisShare:       "0",
+			costBasisBuyOrOption: "98.5",
+			commission:           "-1.5",
+			codes:                "CP;O",
+			orderID:              "RRSP-PR-20230608111850",
+			strategy:             "covered call",
+			netDebitCredit:       "-2002.50",
+		},
+	}
+
+	expectedAccounts := []Account{
+		{id: "U1234567", alias: "Margin", name: "Sam Smith", customerType: "Individual", baseCurrency: "USD", capabilities: "Margin"},
+		{id: "U1237792", alias: "TFSA", name: "Sam Smith", customerType: "Tax-Free Savings Account", baseCurrency: "USD", capabilities: "Cash"},
+		{id: "U2084273", alias: "RRSP", name: "Sam Smith", customerType: "Registered Retirement Savings Plan", baseCurrency: "USD", capabilities: "Cash"},
+	}
+
+	journal := NewJournal()
+	actualTransactions := journal.ReadTransactions("../testdata/input/14-multi-account.csv")
+
+	require.ElementsMatch(t, expectedTransactions, actualTransactions)
+	require.Equal(t, expectedAccounts, journal.Accounts())
+
+	// per account views
+	require.ElementsMatch(t, []Transaction{expectedTransactions[1], expectedTransactions[3]}, FilterAccount(actualTransactions, "TFSA"))
+	require.ElementsMatch(t, []Transaction{expectedTransactions[0], expectedTransactions[2], expectedTransactions[4]}, FilterAccount(actualTransactions, "U2084273"))
+	require.Empty(t, FilterAccount(actualTransactions, "Margin"))
+}
+
+func TestReadTransactionsMultiCurrency(t *testing.T) {
+	expectedTransactions := []Transaction{
+		{
+			date:                 "2023-06-15",
+			account:              "TFSA",
+			accountID:            "U1237792",
+			currency:             "CAD",
+			fxRateToBase:         "0.747800",
+			action:               "Trade",
+			ticker:               "ENB",
+			buySell:              "Buy",
+			shares:               "100",
+			price:                "49.5",
+			proceeds:             "-4950.00",
+			costBasisBuyOrOption: "-4951",
+			costBasisTotal:       "-4951",
+			commission:           "-1",
+			codes:                "O",
+			orderID:              "TFSA-ENB-20230615101233",
+		},
+		{
+			date:         "2023-06-15",
+			account:      "TFSA",
+			accountID:    "U1237792",
+			currency:     "CAD",
+			fxRateToBase: "0.747800",
+			action:       "Dividend",
+			ticker:       "ENB",
+			dividend:     "88.75",
+			dividendType: "Ordinary Dividend",
+			notes:        "ENB(CA29250N1050) Cash Dividend CAD 0.8875 per Share (Ordinary Dividend)",
+		},
+		{
+			date:         "2023-06-15",
+			account:      "TFSA",
+			accountID:    "U1237792",
+			currency:     "USD",
+			fxRateToBase: "1",
+			action:       "Dividend",
+			ticker:       "MSFT",
+			dividend:     "68",
+			dividendType: "Ordinary Dividend",
+			fee:          "-10.2",
+			notes:        "MSFT(US5949181045) Cash Dividend USD 0.68 per Share (Ordinary Dividend)\n15% tax withdrawn",
+		},
+	}
+
+	journal := NewJournal()
+	actualTransactions := journal.ReadTransactions("../testdata/input/15-multi-currency.csv")
+
+	require.ElementsMatch(t, expectedTransactions, actualTransactions)
+
+	// native and base currency amounts
+	require.Equal(t, "-3701.61", expectedTransactions[0].toBase(expectedTransactions[0].proceeds))
+	require.Equal(t, "66.37", expectedTransactions[1].toBase(expectedTransactions[1].dividend))
+	require.Equal(t, "-10.20", expectedTransactions[2].toBase(expectedTransactions[2].fee))
+}
+
+func TestReadTransactionsWithholdingTax(t *testing.T) {
+	dividend := func(date string, ticker string, amount string, fee string, notes string) Transaction {
+		return Transaction{
+			date:         date,
+			account:      "TFSA",
+			accountID:    "U1237792",
+			currency:     "USD",
+			fxRateToBase: "1",
+			action:       "Dividend",
+			ticker:       ticker,
+			dividend:     amount,
+			dividendType: "Ordinary Dividend",
+			fee:          fee,
+			notes:        notes,
+		}
+	}
+
+	expectedTransactions := []Transaction{
+		// 30% withheld and then half refunded
+		dividend("2023-06-08", "MSFT", "68", "-10.2",
+			"MSFT(US5949181045) Cash Dividend USD 0.68 per Share (Ordinary Dividend)\n15% tax withdrawn"),
+		// second dividend for the same ticker
+		dividend("2023-06-22", "MSFT", "50", "-15",
+			"MSFT(US5949181045) Cash Dividend USD 0.50 per Share (Ordinary Dividend)\n30% tax withdrawn"),
+		dividend("2023-06-12", "NVO", "40", "-10",
+			"NVO(US6701002056) Cash Dividend USD 0.40 per Share (Ordinary Dividend)\n25% tax withdrawn"),
+		// refund of tax withheld from a dividend in an earlier statement
+		{
+			date:         "2023-06-15",
+			account:      "TFSA",
+			accountID:    "U1237792",
+			currency:     "USD",
+			fxRateToBase: "1",
+			action:       "Withholding Tax",
+			ticker:       "KO",
+			fee:          "6.9",
+			notes:        "KO(US1912161007) Cash Dividend USD 0.46 per Share - US Tax\nwithholding tax refunded",
+		},
+	}
+
+	journal := NewJournal()
+	actualTransactions := journal.ReadTransactions("../testdata/input/17-withholding-tax.csv")
+
+	require.ElementsMatch(t, expectedTransactions, actualTransactions)
+}
+
+func TestDividendType(t *testing.T) {
+	require.Equal(t, "Ordinary Dividend", dividendType("KO(US1912161007) Cash Dividend USD 0.46 per Share (Ordinary Dividend)", "46"))
+	require.Equal(t, "Reversal", dividendType("KO(US1912161007) Cash Dividend USD 0.46 per Share (Ordinary Dividend)", "-46"))
+	require.Equal(t, "Payment in Lieu", dividendType("SMG(US8101861065) Payment in Lieu of Dividend (Ordinary Dividend)", "66"))
+	require.Equal(t, "Payment in Lieu Charged", dividendType("GME(US36467W1099) Payment in Lieu of Dividend (Ordinary Dividend)", "-10"))
+	require.Equal(t, "Reversal", dividendType("SMG(US8101861065) Payment in Lieu of Dividend - Reversal (Ordinary Dividend)", "-66"))
+	require.Equal(t, "Return of Capital", dividendType("MAIN(US56035L1044) Cash Dividend USD 0.225 per Share (Return of Capital)", "22.5"))
+}
+
+func TestNetDividendReversalsPaymentInLieuCharged(t *testing.T) {
+	description := "GME(US36467W1099) Payment in Lieu of Dividend (Ordinary Dividend)"
+	received := Transaction{date: "2023-06-15", account: "Margin", action: "Dividend", ticker: "GME", dividend: "10", dividendType: "Payment in Lieu", notes: description}
+	charged := Transaction{date: "2023-06-15", account: "Margin", action: "Dividend", ticker: "GME", dividend: "-10", dividendType: "Payment in Lieu Charged", notes: description}
+
+	journal := NewJournal()
+	journal.addTransaction(received)
+	journal.addTransaction(charged)
+	journal.netDividendReversals()
+
+	// a payment in lieu charged on a short position isn't a reversal of the payment in lieu received
+	require.Equal(t, []Transaction{received, charged}, journal.trades["GME"])
+}
+
+func TestReadTransactionsDividendReversal(t *testing.T) {
+	dividend := func(date string, ticker string, amount string, dividendType string, fee string, notes string) Transaction {
+		return Transaction{
+			date:         date,
+			account:      "TFSA",
+			accountID:    "U1237792",
+			currency:     "USD",
+			fxRateToBase: "1",
+			action:       "Dividend",
+			ticker:       ticker,
+			dividend:     amount,
+			dividendType: dividendType,
+			fee:          fee,
+			notes:        notes,
+		}
+	}
+
+	expectedTransactions := []Transaction{
+		// reversal of a dividend paid in an earlier statement
+		dividend("2023-06-05", "PFE", "-41", "Reversal", "6.15",
+			"PFE(US7170811035) Cash Dividend USD 0.41 per Share (Ordinary Dividend)\n6.15 withholding tax refunded"),
+		dividend("2023-06-09", "SMG", "66", "Payment in Lieu", "-9.9",
+			"SMG(US8101861065) Payment in Lieu of Dividend (Ordinary Dividend)\n15% tax withdrawn"),
+		// KO dividend of 0.46 was reversed and corrected to 0.47 per share
+		dividend("2023-06-20", "KO", "47", "Ordinary Dividend", "-7.05",
+			"KO(US1912161007) Cash Dividend USD 0.47 per Share (Ordinary Dividend)\n15% tax withdrawn"),
+		dividend("2023-06-26", "MAIN", "22.5", "Return of Capital", "",
+			"MAIN(US56035L1044) Cash Dividend USD 0.225 per Share (Return of Capital)"),
+	}
+
+	journal := NewJournal()
+	actualTransactions := journal.ReadTransactions("../testdata/input/18-dividend-reversal.csv")
+
+	require.ElementsMatch(t, expectedTransactions, actualTransactions)
+}
+
+func TestReadTransactionsFees(t *testing.T) {
+	fee := func(currency string, fxRateToBase string, date string, amount string, notes string) Transaction {
+		return Transaction{
+			date:         date,
+			account:      "Margin",
+			accountID:    "U1234567",
+			currency:     currency,
+			fxRateToBase: fxRateToBase,
+			action:       "Fee",
+			fee:          amount,
+			notes:        notes,
+		}
+	}
+
+	expectedTransactions := []Transaction{
+		fee("USD", "1", "2023-06-05", "-1.5", "E*****42:NYSE NETWORK A (NP,L1) FOR MAY 2023"),
+		fee("USD", "1", "2023-06-05", "-1.5", "P*****42:OPRA TOP OF BOOK (L1) (NP) FOR MAY 2023"),
+		fee("CAD", "0.755000", "2023-06-05", "-2", "T*****42:TSX TOP OF BOOK (L1) (NP) FOR MAY 2023"),
+		fee("USD", "1", "2023-06-30", "-25", "Advisor Fee for June 2023"),
+	}
+
+	journal := NewJournal()
+	actualTransactions := journal.ReadTransactions("../testdata/input/19-fees.csv")
+
+	require.ElementsMatch(t, expectedTransactions, actualTransactions)
+	require.Equal(t, "-1.51", expectedTransactions[2].toBase(expectedTransactions[2].fee))
+}
+
+func TestReadTransactionsShortSale(t *testing.T) {
+	transaction := func(date string, action string) Transaction {
+		return Transaction{
+			date:         date,
+			account:      "Margin",
+			accountID:    "U1234567",
+			currency:     "USD",
+			fxRateToBase: "1",
+			action:       action,
+			ticker:       "GME",
+		}
+	}
+
+	shortSale := transaction("2023-06-01", "Trade - Short")
+	shortSale.buySell = "Sell"
+	shortSale.shares = "-100"
+	shortSale.price = "25"
+	shortSale.proceeds = "2500.00"
+	shortSale.commission = "-1"
+	shortSale.costBasisBuyOrOption = "2499"
+	shortSale.costBasisTotal = "2499"
+	shortSale.codes = "O"
+	shortSale.orderID = "Margin-GME-20230601100531"
+
+	cover := transaction("2023-06-20", "Trade - Cover")
+	cover.buySell = "Buy"
+	cover.shares = "100"
+	cover.price = "20"
+	cover.proceeds = "-2000.00"
+	cover.commission = "-1"
+	cover.costBasisBuyOrOption = "-2001"
+	cover.costBasisTotal = "-2499"
+	cover.realizedPL = "498"
+	cover.codes = "C"
+	cover.orderID = "Margin-GME-20230620143208"
+
+	paymentInLieu := transaction("2023-06-15", "Dividend")
+	paymentInLieu.dividend = "-10"
+	paymentInLieu.dividendType = "Payment in Lieu Charged"
+	paymentInLieu.notes = "GME(US36467W1099) Payment in Lieu of Dividend (Ordinary Dividend)"
+
+	borrowFee1 := transaction("2023-06-02", "Fee")
+	borrowFee1.fee = "-1.79"
+	borrowFee1.notes = "borrow fee 25.5% on 100 shares"
+
+	borrowFee2 := transaction("2023-06-05", "Fee")
+	borrowFee2.fee = "-5.29"
+	borrowFee2.notes = "borrow fee 25.5% on 100 shares"
+
+	expectedTransactions := []Transaction{shortSale, cover, paymentInLieu, borrowFee1, borrowFee2}
+
+	journal := NewJournal()
+	actualTransactions := journal.ReadTransactions("../testdata/input/22-short-sale.csv")
+
+	require.ElementsMatch(t, expectedTransactions, actualTransactions)
+
+	// short lot opened with the cash received and closed by the buy to cover
+	ledger := NewLedger()
+	ledger.Apply(actualTransactions)
+	require.Empty(t, ledger.Lots())
+	closed := ledger.Closed()
+	require.Len(t, closed, 1)
+	require.Equal(t, -100.0, closed[0].quantity)
+	require.Equal(t, -2499.0, closed[0].costBasis)
+	require.Equal(t, 498.0, closed[0].realizedPL)
+}
+
+func TestReadTransactionsFuturesBondsFunds(t *testing.T) {
+	trade := func(date string, action string, ticker string, buySell string, shares string, price string) Transaction {
+		return Transaction{
+			date:         date,
+			account:      "Margin",
+			accountID:    "U1234567",
+			currency:     "USD",
+			fxRateToBase: "1",
+			action:       action,
+			ticker:       ticker,
+			buySell:      buySell,
+			shares:       shares,
+			price:        price,
+		}
+	}
+
+	futureBuy := trade("2023-06-05", "Trade - Future", "ESU3", "Buy", "1", "4290.25")
+	futureBuy.proceeds = "-214512.50"
+	futureBuy.commission = "-2.25"
+	futureBuy.costBasisBuyOrOption = "-214514.75"
+	futureBuy.costBasisTotal = "-214514.75"
+	futureBuy.multiplier = "50"
+	futureBuy.mtmPL = "237.5"
+	futureBuy.section1256 = "60/40"
+	futureBuy.codes = "O"
+	futureBuy.orderID = "Margin-ESU3-20230605101245"
+
+	futureSell := trade("2023-06-07", "Trade - Future", "ESU3", "Sell", "-1", "4300")
+	futureSell.proceeds = "215000.00"
+	futureSell.commission = "-2.25"
+	futureSell.costBasisBuyOrOption = "214997.75"
+	futureSell.costBasisTotal = "214514.75"
+	futureSell.realizedPL = "483"
+	futureSell.multiplier = "50"
+	futureSell.mtmPL = "100"
+	futureSell.section1256 = "60/40"
+	futureSell.codes = "C"
+	futureSell.orderID = "Margin-ESU3-20230607140102"
+
+	bond := trade("2023-06-06", "Trade - Bond", "T 3 1/2 02/15/33", "Buy", "10000", "98.5")
+	bond.proceeds = "-9850.00"
+	bond.commission = "-5"
+	bond.costBasisBuyOrOption = "-9855"
+	bond.costBasisTotal = "-9855"
+	bond.multiplier = "0.01"
+	bond.accruedInterest = "-106.94"
+	bond.codes = "O"
+	bond.orderID = "Margin-T-20230606113000"
+
+	fund := trade("2023-06-08", "Trade - Mutual Fund", "VFIAX", "Buy", "2.5", "400")
+	fund.proceeds = "-1000.00"
+	fund.commission = "0"
+	fund.costBasisBuyOrOption = "-1000"
+	fund.costBasisTotal = "-1000"
+	fund.multiplier = "1"
+	fund.codes = "O"
+	fund.orderID = "Margin-VFIAX-20230608160000"
+
+	expectedTransactions := []Transaction{futureBuy, futureSell, bond, fund}
+
+	journal := NewJournal()
+	actualTransactions := journal.ReadTransactions("../testdata/input/23-futures-bonds-funds.csv")
+
+	require.ElementsMatch(t, expectedTransactions, actualTransactions)
+
+	ledger := NewLedger()
+	ledger.Apply(actualTransactions)
+	closed := ledger.Closed()
+	require.Len(t, closed, 1)
+	require.Equal(t, 50.0, closed[0].multiplier)
+	require.InDelta(t, 483, closed[0].realizedPL, 1e-9)
+	lots := ledger.Lots()
+	require.Len(t, lots, 2)
+	require.Equal(t, "T 3 1/2 02/15/33", lots[0].symbol)
+	require.Equal(t, 0.01, lots[0].multiplier)
+	require.Equal(t, "VFIAX", lots[1].symbol)
+	require.Equal(t, 2.5, lots[1].quantity)
+}
+
+func TestReadTransactionsIndexOptions(t *testing.T) {
+	option := func(date string, ticker string, optionContract string, buySell string, contracts string, price string) Transaction {
+		return Transaction{
+			date:            date,
+			account:         "Margin",
+			accountID:       "U1234567",
+			currency:        "USD",
+			fxRateToBase:    "1",
+			action:          "Trade - Option",
+			ticker:          ticker,
+			optionContract:  optionContract,
+			buySell:         buySell,
+			optionContracts: contracts,
+			price:           price,
+			costBasisShare:  "0",
+			section1256:     "60/40",
+		}
+	}
+
+	spxBuy := option("2023-06-01", "SPX", "16JUN23 4300 C", "Buy", "1", "50")
+	spxBuy.proceeds = "-5000.00"
+	spxBuy.commission = "-1.05"
+	spxBuy.costBasisBuyOrOption = "-5001.05"
+	spxBuy.codes = "O"
+	spxBuy.orderID = "Margin-SPX-20230601103012"
+
+	xspSell := option("2023-06-01", "XSP", "16JUN23 430 P", "Sell", "-1", "2")
+	xspSell.proceeds = "200.00"
+	xspSell.commission = "-0.65"
+	xspSell.costBasisBuyOrOption = "199.35"
+	xspSell.codes = "O"
+	xspSell.orderID = "Margin-XSP-20230601103140"
+
+	xspBuy := option("2023-06-01", "XSP", "16JUN23 420 P", "Buy", "1", "1")
+	xspBuy.proceeds = "-100.00"
+	xspBuy.commission = "-0.65"
+	xspBuy.costBasisBuyOrOption = "-100.65"
+	xspBuy.codes = "O"
+	xspBuy.orderID = "Margin-XSP-20230601103205"
+
+	// exercised SPX call settles 95 points in cash instead of delivering shares
+	spxExercise := option("2023-06-16", "SPX", "16JUN23 4300 C", "Sell", "-1", "95")
+	spxExercise.action = "Trade - Option - Cash Settlement"
+	spxExercise.actionModified = "Trade - Option - Cash Settlement"
+	spxExercise.proceeds = "9500.00"
+	spxExercise.commission = "0"
+	spxExercise.costBasisBuyOrOption = "9500"
+	spxExercise.realizedPL = "4498.95"
+	spxExercise.notes = "cash settled exercise"
+	spxExercise.codes = "C;Ex"
+	spxExercise.orderID = "Margin-SPX-20230616162000"
+
+	// unrelated SPY trade at the XSP strike isn't matched to the index options
+	spy := Transaction{
+		date:                 "2023-06-16",
+		account:              "Margin",
+		accountID:            "U1234567",
+		currency:             "USD",
+		fxRateToBase:         "1",
+		action:               "Trade",
+		ticker:               "SPY",
+		buySell:              "Buy",
+		shares:               "100",
+		price:                "430",
+		proceeds:             "-43000.00",
+		commission:           "-1",
+		costBasisBuyOrOption: "-43001",
+		costBasisTotal:       "-43001",
+		codes:                "O",
+		orderID:              "Margin-SPY-20230616162000",
+	}
+
+	expectedTransactions := []Transaction{spy, spxBuy, xspSell, xspBuy, spxExercise}
+
+	journal := NewJournal()
+	actualTransactions := journal.ReadTransactions("../testdata/input/24-index-options.csv")
+
+	require.ElementsMatch(t, expectedTransactions, actualTransactions)
+
+	// settlement closes the SPX lot, expired XSP options close when the ledger moves past the expiry
+	ledger := NewLedger()
+	ledger.Apply(actualTransactions)
+	ledger.Expire("2023-06-30")
+	require.Equal(t, []string{"SPY"}, []string{ledger.Lots()[0].symbol})
+	require.Len(t, ledger.Lots(), 1)
+	realizedPL := 0.0
+	for _, lot := range ledger.Closed() {
+		realizedPL += lot.realizedPL
+	}
+	require.InDelta(t, 4498.95+199.35-100.65, realizedPL, 1e-9)
+}
+
+func TestReadTransactionsForex(t *testing.T) {
+	expectedTransactions := []Transaction{
+		{
+			date:               "2023-06-20",
+			account:            "Margin",
+			accountID:          "U1234567",
+			currency:           "CAD",
+			fxRateToBase:       "0.755210",
+			action:             "Forex",
+			commission:         "-2",
+			commissionCurrency: "USD",
+			forexBuyCurrency:   "CAD",
+			forexBuyAmount:     "2662.400000",
+			forexSellCurrency:  "USD",
+			forexSellAmount:    "-2,000",
+			forexRate:          "1.3312",
+			notes:              "converted USD to CAD",
+			orderID:            "Margin-USD.CAD-20230620093015",
+		},
+		{
+			date:               "2023-06-20",
+			account:            "Margin",
+			accountID:          "U1234567",
+			currency:           "USD",
+			fxRateToBase:       "1",
+			action:             "Forex",
+			commissionCurrency: "USD",
+			forexBuyCurrency:   "EUR",
+			forexBuyAmount:     "150.25",
+			forexSellCurrency:  "USD",
+			forexSellAmount:    "-164.448625",
+			forexRate:          "1.0945",
+			notes:              "auto converted USD to EUR",
+			codes:              "AFx",
+			orderID:            "Margin-EUR.USD-20230620101144",
+		},
+	}
+
+	journal := NewJournal()
+	actualTransactions := journal.ReadTransactions("../testdata/input/16-forex-usd-cad.csv")
+
+	require.ElementsMatch(t, expectedTransactions, actualTransactions)
+	require.Equal(t, "-2.00", expectedTransactions[0].commissionToBase())
+}
+
+func TestReadTransactionsForexNonUsdBase(t *testing.T) {
+	expectedTransactions := []Transaction{
+		{
+			date:               "2023-06-21",
+			account:            "Joint",
+			accountID:          "U3045126",
+			currency:           "CAD",
+			fxRateToBase:       "1",
+			action:             "Forex",
+			commission:         "-2.65",
+			commissionCurrency: "CAD",
+			forexBuyCurrency:   "USD",
+			forexBuyAmount:     "1,500",
+			forexSellCurrency:  "CAD",
+			forexSellAmount:    "-1987.050000",
+			forexRate:          "1.3247",
+			notes:              "converted CAD to USD",
+			orderID:            "Joint-USD.CAD-20230621104207",
+		},
+	}
+
+	journal := NewJournal()
+	actualTransactions := journal.ReadTransactions("../testdata/input/26-forex-cad-base.csv")
+
+	// commission is in the CAD base currency
+	require.ElementsMatch(t, expectedTransactions, actualTransactions)
+	require.Equal(t, "-2.65", actualTransactions[0].commissionToBase())
+}
+
+func TestReadTransactionsAggregateFillsSeparateOrders(t *testing.T) {
+	journal := NewJournal()
+	journal.SetAggregateFills(true)
+	actualTransactions := journal.ReadTransactions("../testdata/input/25-separate-orders.csv")
+
+	// the first two fills are one order, the order hours later is another
+	require.Len(t, actualTransactions, 2)
+	sortTransactions(actualTransactions)
+	require.Equal(t, "-2", actualTransactions[0].optionContracts)
+	require.Equal(t, "TFSA-DVN-20230622100004", actualTransactions[0].orderID)
+	require.Len(t, actualTransactions[0].fills, 2)
+	require.Equal(t, "-2", actualTransactions[1].optionContracts)
+	require.Equal(t, "TFSA-DVN-20230622140017", actualTransactions[1].orderID)
+	require.Empty(t, actualTransactions[1].fills)
+}
+
+func TestReadTransactionsSkippedOrderExecutions(t *testing.T) {
+	input, err := os.ReadFile("../testdata/input/5-call-assignment.csv")
+	require.NoError(t, err)
+	// another sale of the shares at the strike price on the day of the assignment
+	assigned := `Trades,Data,Order,Stocks,USD,FDX,"2023-06-08, 16:20:00",-100,155,223.76,15500,-0.1385,-17267.370257,3873.744617,-6876,A;C`
+	sale := `Trades,Data,Order,Stocks,USD,FDX,"2023-06-08, 10:00:00",-100,155,223.76,15500,-1,-17267.370257,3873.744617,-6876,C`
+	require.Contains(t, string(input), assigned)
+	withSale := strings.Replace(string(input), assigned, assigned+"\n"+sale, 1)
+
+	// the assigned option's order is condensed into the stock trade, its execution isn't a trade of its own that would
+	// be matched to the other sale
+	order := `Trades,Data,Order,Equity and Index Options,USD,FDX 16JUN23 155 C,"2023-06-08, 16:20:00",1,0,68.9658,0,0,5641.253374,0,6896.58,A;C`
+	execution := strings.Replace(order, ",Order,", ",Execution,", 1)
+	require.Contains(t, withSale, order)
+	withExecution := strings.Replace(withSale, order, order+"\n"+execution, 1)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sale.csv"), []byte(withSale), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "execution.csv"), []byte(withExecution), 0644))
+	journal := NewJournal()
+	expectedTransactions := journal.ReadTransactions(filepath.Join(dir, "sale.csv"))
+	journal = NewJournal()
+	actualTransactions := journal.ReadTransactions(filepath.Join(dir, "execution.csv"))
+	sortTransactions(expectedTransactions)
+	sortTransactions(actualTransactions)
+	require.Equal(t, expectedTransactions, actualTransactions)
+}
+
+func TestReadTransactionsUnsupportedAssetCategory(t *testing.T) {
+	input, err := os.ReadFile("../testdata/input/12-partial-fills.csv")
+	require.NoError(t, err)
+	oxy := `Trades,Data,Order,Stocks,USD,OXY,"2023-06-20, 11:15:02",100,58.1,58.3,-5810,-0.5,5810.5,0,20,O`
+	require.Contains(t, string(input), oxy)
+	warrant := `Trades,Data,Order,Warrants,USD,OXY WS,"2023-06-20, 10:01:15",100,28.1,28.3,-2810,-1,2811,0,20,O` + "\n" +
+		`Trades,Data,Execution,Warrants,USD,OXY WS,"2023-06-20, 10:01:15",100,28.1,28.3,-2810,-1,2811,0,20,O`
+	statement := filepath.Join(t.TempDir(), "warrants.csv")
+	require.NoError(t, os.WriteFile(statement, []byte(strings.Replace(string(input), oxy, warrant+"\n"+oxy, 1)), 0644))
+
+	var warnings strings.Builder
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+
+	journal := NewJournal()
+	expectedTransactions := journal.ReadTransactions("../testdata/input/12-partial-fills.csv")
+	journal = NewJournal()
+	actualTransactions := journal.ReadTransactions(statement)
+
+	// the warrant trade is skipped with a warning, the rest of the statement is read
+	require.Contains(t, warnings.String(), "skipped Warrants trade of OXY WS on 2023-06-20, unsupported asset category")
+	sortTransactions(expectedTransactions)
+	sortTransactions(actualTransactions)
+	require.Equal(t, expectedTransactions, actualTransactions)
+}
@@ -0,0 +1,401 @@
+package parse
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"strconv"
+)
+
+// JsonSchemaVersion is the version of the JSON and NDJSON output, documented in schema/v1.json.
+// It changes whenever a field is removed, renamed or changes type, adding fields doesn't change it.
+const JsonSchemaVersion = 1
+
+// Export is everything written to the JSON and NDJSON outputs.
+type Export struct {
+	Transactions []Transaction
+	Lots         []Lot // open lots
+	ClosedLots   []Lot
+	Positions    []Position
+	Campaigns    []Campaign
+}
+
+// NewExport exports the transactions with the lots, positions and campaigns of the ledger they were applied to.
+func NewExport(transactions []Transaction, ledger *Ledger) Export {
+	return Export{
+		Transactions: transactions,
+		Lots:         ledger.Lots(),
+		ClosedLots:   ledger.Closed(),
+		Positions:    ledger.Positions(),
+		Campaigns:    ledger.Campaigns(transactions),
+	}
+}
+
+type transactionRecord struct {
+	Date               string              `json:"date"`
+	Account            string              `json:"account"`
+	AccountID          string              `json:"accountId"`
+	Action             string              `json:"action"`
+	ActionModified     string              `json:"actionModified,omitempty"`
+	Ticker             string              `json:"ticker"`
+	OptionContract     string              `json:"optionContract,omitempty"`
+	BuySell            string              `json:"buySell,omitempty"`
+	OptionContracts    json.Number         `json:"optionContracts,omitempty"`
+	Shares             json.Number         `json:"shares,omitempty"`
+	Price              json.Number         `json:"price,omitempty"`
+	Proceeds           json.Number         `json:"proceeds,omitempty"`
+	CostBasisShare     json.Number         `json:"costBasisShare,omitempty"`
+	CostBasisBuyOrOpt  json.Number         `json:"costBasisBuyOrOption,omitempty"`
+	CostBasisTotal     json.Number         `json:"costBasisTotal,omitempty"`
+	RealizedPL         json.Number         `json:"realizedPL,omitempty"`
+	Commission         json.Number         `json:"commission,omitempty"`
+	CommissionCurrency string              `json:"commissionCurrency,omitempty"`
+	Dividend           json.Number         `json:"dividend,omitempty"`
+	DividendType       string              `json:"dividendType,omitempty"`
+	Fee                json.Number         `json:"fee,omitempty"`
+	Currency           string              `json:"currency"`
+	FxRateToBase       json.Number         `json:"fxRateToBase,omitempty"`
+	ForexBuyCurrency   string              `json:"forexBuyCurrency,omitempty"`
+	ForexBuyAmount     json.Number         `json:"forexBuyAmount,omitempty"`
+	ForexSellCurrency  string              `json:"forexSellCurrency,omitempty"`
+	ForexSellAmount    json.Number         `json:"forexSellAmount,omitempty"`
+	ForexRate          json.Number         `json:"forexRate,omitempty"`
+	Multiplier         json.Number         `json:"multiplier,omitempty"`
+	AccruedInterest    json.Number         `json:"accruedInterest,omitempty"`
+	MtmPL              json.Number         `json:"mtmPL,omitempty"`
+	Section1256        string              `json:"section1256,omitempty"`
+	Value              json.Number         `json:"value,omitempty"`
+	AcquiredDate       string              `json:"acquiredDate,omitempty"`
+	Notes              string              `json:"notes,omitempty"`
+	Codes              string              `json:"codes,omitempty"`
+	OrderID            string              `json:"orderId,omitempty"`
+	Strategy           string              `json:"strategy,omitempty"`
+	NetDebitCredit     json.Number         `json:"netDebitCredit,omitempty"`
+	Fills              []transactionRecord `json:"fills,omitempty"`
+}
+
+type lotRecord struct {
+	Account    string   `json:"account"`
+	Symbol     string   `json:"symbol"`
+	Ticker     string   `json:"ticker"`
+	Date       string   `json:"date"`
+	Quantity   float64  `json:"quantity"`
+	CostBasis  float64  `json:"costBasis"`
+	Multiplier float64  `json:"multiplier"`
+	CloseDate  string   `json:"closeDate,omitempty"`
+	Proceeds   *float64 `json:"proceeds,omitempty"`
+	RealizedPL *float64 `json:"realizedPL,omitempty"`
+}
+
+type positionRecord struct {
+	Account           string  `json:"account"`
+	Symbol            string  `json:"symbol"`
+	Ticker            string  `json:"ticker"`
+	OpenDate          string  `json:"openDate"`
+	Quantity          float64 `json:"quantity"`
+	CostBasis         float64 `json:"costBasis"`
+	CostBasisPerShare float64 `json:"costBasisPerShare"`
+	Multiplier        float64 `json:"multiplier"`
+	Lots              int     `json:"lots"`
+}
+
+type campaignRecord struct {
+	Account    string   `json:"account"`
+	Ticker     string   `json:"ticker"`
+	StartDate  string   `json:"startDate"`
+	EndDate    string   `json:"endDate,omitempty"`
+	Open       bool     `json:"open"`
+	Symbols    []string `json:"symbols"`
+	RealizedPL float64  `json:"realizedPL"`
+	Dividends  float64  `json:"dividends"`
+	Fees       float64  `json:"fees"`
+	NetPL      float64  `json:"netPL"`
+}
+
+// accountRecord, instrumentRecord and ratesRecord are only in the journal store, they keep what the statements had
+// besides the transactions.
+type accountRecord struct {
+	ID           string `json:"id"`
+	Alias        string `json:"alias,omitempty"`
+	Name         string `json:"name,omitempty"`
+	CustomerType string `json:"customerType,omitempty"`
+	BaseCurrency string `json:"baseCurrency,omitempty"`
+	Capabilities string `json:"capabilities,omitempty"`
+}
+
+type instrumentRecord struct {
+	Symbol        string `json:"symbol"`
+	Description   string `json:"description,omitempty"`
+	AssetCategory string `json:"assetCategory,omitempty"`
+	Conid         string `json:"conid,omitempty"`
+	SecurityID    string `json:"securityId,omitempty"`
+	Multiplier    string `json:"multiplier,omitempty"`
+	Expiry        string `json:"expiry,omitempty"`
+	PutCall       string `json:"putCall,omitempty"`
+	Strike        string `json:"strike,omitempty"`
+}
+
+type ratesRecord struct {
+	From  string                 `json:"from"`
+	To    string                 `json:"to"`
+	Rates map[string]json.Number `json:"rates"`
+}
+
+// jsonNumber converts an amount to a JSON number, blank amounts are left out.
+func jsonNumber(amount string) json.Number {
+	if amount == "" {
+		return ""
+	}
+	return json.Number(strconv.FormatFloat(parseAmount(amount), 'f', -1, 64))
+}
+
+func (t Transaction) record() transactionRecord {
+	record := transactionRecord{
+		Date:               t.date,
+		Account:            t.account,
+		AccountID:          t.accountID,
+		Action:             t.action,
+		ActionModified:     t.actionModified,
+		Ticker:             t.ticker,
+		OptionContract:     t.optionContract,
+		BuySell:            t.buySell,
+		OptionContracts:    jsonNumber(t.optionContracts),
+		Shares:             jsonNumber(t.shares),
+		Price:              jsonNumber(t.price),
+		Proceeds:           jsonNumber(t.proceeds),
+		CostBasisShare:     jsonNumber(t.costBasisShare),
+		CostBasisBuyOrOpt:  jsonNumber(t.costBasisBuyOrOption),
+		CostBasisTotal:     jsonNumber(t.costBasisTotal),
+		RealizedPL:         jsonNumber(t.realizedPL),
+		Commission:         jsonNumber(t.commission),
+		CommissionCurrency: t.commissionCurrency,
+		Dividend:           jsonNumber(t.dividend),
+		DividendType:       t.dividendType,
+		Fee:                jsonNumber(t.fee),
+		Currency:           t.currency,
+		FxRateToBase:       jsonNumber(t.fxRateToBase),
+		ForexBuyCurrency:   t.forexBuyCurrency,
+		ForexBuyAmount:     jsonNumber(t.forexBuyAmount),
+		ForexSellCurrency:  t.forexSellCurrency,
+		ForexSellAmount:    jsonNumber(t.forexSellAmount),
+		ForexRate:          jsonNumber(t.forexRate),
+		Multiplier:         jsonNumber(t.multiplier),
+		AccruedInterest:    jsonNumber(t.accruedInterest),
+		MtmPL:              jsonNumber(t.mtmPL),
+		Section1256:        t.section1256,
+		Value:              jsonNumber(t.value),
+		AcquiredDate:       t.acquiredDate,
+		Notes:              t.notes,
+		Codes:              t.codes,
+		OrderID:            t.orderID,
+		Strategy:           t.strategy,
+		NetDebitCredit:     jsonNumber(t.netDebitCredit),
+	}
+	for _, fill := range t.fills {
+		record.Fills = append(record.Fills, fill.record())
+	}
+	return record
+}
+
+func (l Lot) record() lotRecord {
+	record := lotRecord{
+		Account:    l.account,
+		Symbol:     l.symbol,
+		Ticker:     l.ticker,
+		Date:       l.date,
+		Quantity:   l.quantity,
+		CostBasis:  l.costBasis,
+		Multiplier: l.multiplier,
+		CloseDate:  l.closeDate,
+	}
+	if l.closeDate != "" {
+		proceeds, realizedPL := l.proceeds, l.realizedPL
+		record.Proceeds, record.RealizedPL = &proceeds, &realizedPL
+	}
+	return record
+}
+
+func (p Position) record() positionRecord {
+	record := positionRecord{
+		Account:    p.account,
+		Symbol:     p.symbol,
+		Ticker:     p.ticker,
+		OpenDate:   p.openDate,
+		Quantity:   p.quantity,
+		CostBasis:  p.costBasis,
+		Multiplier: p.multiplier,
+		Lots:       p.lots,
+	}
+	if p.quantity != 0 && p.multiplier != 0 {
+		record.CostBasisPerShare = p.costBasis / (p.quantity * p.multiplier)
+	}
+	return record
+}
+
+func (c Campaign) record() campaignRecord {
+	return campaignRecord{
+		Account:    c.account,
+		Ticker:     c.ticker,
+		StartDate:  c.startDate,
+		EndDate:    c.endDate,
+		Open:       c.endDate == "",
+		Symbols:    c.symbols,
+		RealizedPL: c.realizedPL,
+		Dividends:  c.dividends,
+		Fees:       c.fees,
+		NetPL:      c.realizedPL + c.dividends + c.fees,
+	}
+}
+
+func (a Account) record() accountRecord {
+	return accountRecord{
+		ID:           a.id,
+		Alias:        a.alias,
+		Name:         a.name,
+		CustomerType: a.customerType,
+		BaseCurrency: a.baseCurrency,
+		Capabilities: a.capabilities,
+	}
+}
+
+func (r accountRecord) account() Account {
+	return Account{
+		id:           r.ID,
+		alias:        r.Alias,
+		name:         r.Name,
+		customerType: r.CustomerType,
+		baseCurrency: r.BaseCurrency,
+		capabilities: r.Capabilities,
+	}
+}
+
+func (i instrument) record() instrumentRecord {
+	return instrumentRecord{
+		Symbol:        i.symbol,
+		Description:   i.description,
+		AssetCategory: i.assetCategory,
+		Conid:         i.conid,
+		SecurityID:    i.securityID,
+		Multiplier:    i.multiplier,
+		Expiry:        i.expiry,
+		PutCall:       i.putCall,
+		Strike:        i.strike,
+	}
+}
+
+func (r instrumentRecord) instrument() instrument {
+	return instrument{
+		symbol:        r.Symbol,
+		description:   r.Description,
+		assetCategory: r.AssetCategory,
+		conid:         r.Conid,
+		securityID:    r.SecurityID,
+		multiplier:    r.Multiplier,
+		expiry:        r.Expiry,
+		putCall:       r.PutCall,
+		strike:        r.Strike,
+	}
+}
+
+func (s statementRates) record() ratesRecord {
+	record := ratesRecord{From: s.from, To: s.to, Rates: make(map[string]json.Number)}
+	for currency, rate := range s.rates {
+		record.Rates[currency] = jsonNumber(rate)
+	}
+	return record
+}
+
+func (r ratesRecord) statementRates() statementRates {
+	rates := statementRates{from: r.From, to: r.To, rates: make(map[string]string)}
+	for currency, rate := range r.Rates {
+		rates.rates[currency] = rate.String()
+	}
+	return rates
+}
+
+func (t Transaction) MarshalJSON() ([]byte, error) { return json.Marshal(t.record()) }
+func (l Lot) MarshalJSON() ([]byte, error)         { return json.Marshal(l.record()) }
+func (p Position) MarshalJSON() ([]byte, error)    { return json.Marshal(p.record()) }
+func (c Campaign) MarshalJSON() ([]byte, error)    { return json.Marshal(c.record()) }
+
+// WriteJson writes the export as a single JSON document.
+// e.g. {"schemaVersion": 1, "transactions": [...], "lots": [...], "closedLots": [...], "positions": [...], "campaigns": [...]}
+func WriteJson(w io.Writer, export Export) {
+	document := struct {
+		SchemaVersion int           `json:"schemaVersion"`
+		Transactions  []Transaction `json:"transactions"`
+		Lots          []Lot         `json:"lots"`
+		ClosedLots    []Lot         `json:"closedLots"`
+		Positions     []Position    `json:"positions"`
+		Campaigns     []Campaign    `json:"campaigns"`
+	}{
+		SchemaVersion: JsonSchemaVersion,
+		Transactions:  nonNil(export.Transactions),
+		Lots:          nonNil(export.Lots),
+		ClosedLots:    nonNil(export.ClosedLots),
+		Positions:     nonNil(export.Positions),
+		Campaigns:     nonNil(export.Campaigns),
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// WriteNdjson writes the export with one record per line, each with its type and the schema version.
+// e.g. {"schemaVersion":1,"type":"transaction","date":"2023-06-05",...}
+func WriteNdjson(w io.Writer, export Export) {
+	encoder := json.NewEncoder(w)
+	write := func(recordType string, record any) {
+		writeNdjsonRecord(encoder, recordType, record)
+	}
+
+	for _, transaction := range export.Transactions {
+		write("transaction", transaction.record())
+	}
+	for _, lot := range export.Lots {
+		write("lot", lot.record())
+	}
+	for _, lot := range export.ClosedLots {
+		write("closedLot", lot.record())
+	}
+	for _, position := range export.Positions {
+		write("position", position.record())
+	}
+	for _, campaign := range export.Campaigns {
+		write("campaign", campaign.record())
+	}
+}
+
+// writeNdjsonRecord writes the record as a line with its type and the schema version.
+func writeNdjsonRecord(encoder *json.Encoder, recordType string, record any) {
+	line := struct {
+		SchemaVersion int    `json:"schemaVersion"`
+		Type          string `json:"type"`
+	}{JsonSchemaVersion, recordType}
+
+	// merge the header into the record so each line is a flat object
+	header, err := json.Marshal(line)
+	if err != nil {
+		log.Fatal(err)
+	}
+	body, err := json.Marshal(record)
+	if err != nil {
+		log.Fatal(err)
+	}
+	merged := append(header[:len(header)-1], ',')
+	merged = append(merged, body[1:]...)
+	if err := encoder.Encode(json.RawMessage(merged)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// nonNil writes empty lists as [] instead of null.
+func nonNil[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+	return values
+}
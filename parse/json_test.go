@@ -0,0 +1,55 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteJson(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/2-dividend.csv")
+	ledger := NewLedger()
+	ledger.Apply(transactions)
+
+	var output bytes.Buffer
+	WriteJson(&output, NewExport(transactions, ledger))
+
+	var document struct {
+		SchemaVersion int                      `json:"schemaVersion"`
+		Transactions  []map[string]interface{} `json:"transactions"`
+		Lots          []map[string]interface{} `json:"lots"`
+		ClosedLots    []map[string]interface{} `json:"closedLots"`
+	}
+	require.NoError(t, json.Unmarshal(output.Bytes(), &document))
+	require.Equal(t, JsonSchemaVersion, document.SchemaVersion)
+	require.Len(t, document.Transactions, len(transactions))
+	require.NotNil(t, document.ClosedLots)
+	for _, transaction := range document.Transactions {
+		require.Equal(t, "Dividend", transaction["action"])
+		// amounts are numbers, blank amounts are left out
+		require.IsType(t, float64(0), transaction["dividend"])
+		require.NotContains(t, transaction, "proceeds")
+	}
+}
+
+func TestWriteNdjson(t *testing.T) {
+	export := Export{
+		Transactions: []Transaction{{date: "2023-06-05", account: "TFSA", accountID: "U1234567", action: "Trade", ticker: "TECK", shares: "100", proceeds: "-4607.00", currency: "USD"}},
+		Lots:         []Lot{{account: "U1234567", symbol: "TECK", ticker: "TECK", date: "2023-06-05", quantity: 100, costBasis: 4608, multiplier: 1}},
+		Campaigns:    []Campaign{{account: "U1234567", ticker: "TECK", startDate: "2023-06-05", symbols: []string{"TECK"}}},
+	}
+
+	var output bytes.Buffer
+	WriteNdjson(&output, export)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Equal(t, []string{
+		`{"schemaVersion":1,"type":"transaction","date":"2023-06-05","account":"TFSA","accountId":"U1234567","action":"Trade","ticker":"TECK","shares":100,"proceeds":-4607,"currency":"USD"}`,
+		`{"schemaVersion":1,"type":"lot","account":"U1234567","symbol":"TECK","ticker":"TECK","date":"2023-06-05","quantity":100,"costBasis":4608,"multiplier":1}`,
+		`{"schemaVersion":1,"type":"campaign","account":"U1234567","ticker":"TECK","startDate":"2023-06-05","open":true,"symbols":["TECK"],"realizedPL":0,"dividends":0,"fees":0,"netPL":0}`,
+	}, lines)
+}
@@ -0,0 +1,376 @@
+package parse
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Layout defines the columns of the journal written by ToCsv.
+// e.g.
+//
+//	{
+//	  "header": true,
+//	  "columns": [
+//	    {"name": "Date", "field": "date"},
+//	    {"name": "Net", "expression": "proceeds + commission", "format": "%.2f"},
+//	    {"name": "Net in base", "expression": "toBase(proceeds + commission)", "format": "%.2f"}
+//	  ]
+//	}
+type Layout struct {
+	Header  bool     `json:"header"`  // write the column names as the first row
+	Columns []Column `json:"columns"` // in the order they're written
+}
+
+// Column is filled from a Transaction field (e.g. proceeds), a computed field (e.g. proceedsInBase) or an expression
+// of fields (e.g. proceeds + commission). A column without a field or expression is left blank.
+type Column struct {
+	Name       string `json:"name"`
+	Field      string `json:"field,omitempty"`
+	Expression string `json:"expression,omitempty"`
+	Format     string `json:"format,omitempty"` // printf format for numbers e.g. %.2f, blank values stay blank
+	Type       string `json:"type,omitempty"`   // cell type in XLSX: date, number, currency, perShare or text by default
+}
+
+//go:embed layouts/default.json
+var defaultLayout []byte
+
+// computedFields are the fields that aren't stored on the Transaction.
+var computedFields = map[string]func(Transaction) string{
+	"proceedsInBase":   func(t Transaction) string { return t.toBase(t.proceeds) },
+	"commissionInBase": func(t Transaction) string { return t.commissionToBase() },
+	"dividendInBase":   func(t Transaction) string { return t.toBase(t.dividend) },
+	"feeInBase":        func(t Transaction) string { return t.toBase(t.fee) },
+}
+
+// numberFields are the Transaction fields holding numbers, the rest are text (e.g. ticker, date) and can't be
+// formatted or used in expressions. Computed fields are all numbers.
+var numberFields = map[string]bool{
+	"commission": true, "price": true, "fxRateToBase": true, "optionContracts": true, "shares": true,
+	"proceeds": true, "costBasisShare": true, "costBasisBuyOrOption": true, "costBasisTotal": true, "realizedPL": true,
+	"forexBuyAmount": true, "forexSellAmount": true, "forexRate": true, "multiplier": true, "accruedInterest": true,
+	"mtmPL": true, "value": true, "dividend": true, "fee": true, "netDebitCredit": true,
+}
+
+// DefaultLayout returns the layout of the trading journal spreadsheet, without a header row.
+func DefaultLayout() Layout {
+	var layout Layout
+	if err := json.Unmarshal(defaultLayout, &layout); err != nil {
+		panic(err)
+	}
+	return layout
+}
+
+// LoadLayout reads a layout from a JSON file. Fields, expressions, formats and types are checked so a bad layout
+// fails when it's loaded instead of when the journal is written.
+func LoadLayout(path string) Layout {
+	layout, err := readLayout(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return layout
+}
+
+func readLayout(path string) (Layout, error) {
+	var layout Layout
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return layout, err
+	}
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return layout, fmt.Errorf("invalid layout %s: %v", path, err)
+	}
+	if err := layout.validate(); err != nil {
+		return layout, fmt.Errorf("invalid layout %s: %v", path, err)
+	}
+	return layout, nil
+}
+
+// validate checks the columns of the layout.
+func (l Layout) validate() error {
+	for _, column := range l.Columns {
+		if column.Field != "" && !isField(column.Field) {
+			return fmt.Errorf("unknown field %s in column %s", column.Field, column.Name)
+		}
+		if column.Expression != "" {
+			if err := checkExpression(column.Expression); err != nil {
+				return fmt.Errorf("%v in column %s", err, column.Name)
+			}
+		}
+		if column.Format != "" {
+			if column.Field != "" && !isNumberField(column.Field) {
+				return fmt.Errorf("format %s on text field %s in column %s", column.Format, column.Field, column.Name)
+			}
+			if err := checkFormat(column.Format); err != nil {
+				return fmt.Errorf("%v in column %s", err, column.Name)
+			}
+		}
+		if _, ok := cellStyles[column.Type]; !ok {
+			return fmt.Errorf("unknown type %s in column %s", column.Type, column.Name)
+		}
+	}
+	return nil
+}
+
+// checkExpression parses the expression with a blank transaction, which finds syntax errors, unknown fields and text
+// fields.
+func checkExpression(text string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	newExpression(text, Transaction{}).evaluate()
+	return nil
+}
+
+// checkFormat checks that the format has a single float verb e.g. %.2f, the values are always numbers.
+func checkFormat(format string) error {
+	verbs := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			continue
+		}
+		// flags, width and precision
+		for i < len(format) && strings.ContainsRune("+-# 0123456789.", rune(format[i])) {
+			i++
+		}
+		if i == len(format) || !strings.ContainsRune("eEfFgG", rune(format[i])) {
+			return fmt.Errorf("format %s isn't a number format like %%.2f", format)
+		}
+		verbs++
+	}
+	if verbs != 1 {
+		return fmt.Errorf("format %s needs a single number verb like %%.2f", format)
+	}
+	return nil
+}
+
+// SetLayout sets the columns ToCsv writes, the default layout is used until it's set.
+func (j *Journal) SetLayout(layout Layout) {
+	j.layout = &layout
+}
+
+// journalLayout is the layout set with SetLayout or the default layout.
+func (j *Journal) journalLayout() Layout {
+	if j.layout != nil {
+		return *j.layout
+	}
+	return DefaultLayout()
+}
+
+// rows converts the transactions to rows of the layout, starting with the header row when the layout has one.
+func (l Layout) rows(transactions []Transaction) [][]string {
+	var rows [][]string
+	if l.Header {
+		var header []string
+		for _, column := range l.Columns {
+			header = append(header, column.Name)
+		}
+		rows = append(rows, header)
+	}
+	for _, transaction := range transactions {
+		var row []string
+		for _, column := range l.Columns {
+			row = append(row, column.value(transaction))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (c Column) value(transaction Transaction) string {
+	var value string
+	switch {
+	case c.Expression != "":
+		result, ok := newExpression(c.Expression, transaction).evaluate()
+		if !ok {
+			return ""
+		}
+		value = strconv.FormatFloat(result, 'f', -1, 64)
+	case c.Field != "":
+		value = field(transaction, c.Field)
+	}
+
+	if c.Format == "" || value == "" {
+		return value
+	}
+	return fmt.Sprintf(c.Format, parseAmount(value))
+}
+
+// field returns the value of a Transaction field or computed field by name e.g. costBasisTotal, proceedsInBase.
+func field(transaction Transaction, name string) string {
+	if computed, ok := computedFields[name]; ok {
+		return computed(transaction)
+	}
+	value := reflect.ValueOf(transaction).FieldByName(name)
+	if !value.IsValid() || value.Kind() != reflect.String {
+		panic(fmt.Sprintf("unknown field %s", name))
+	}
+	return value.String()
+}
+
+func isField(name string) bool {
+	if _, ok := computedFields[name]; ok {
+		return true
+	}
+	f, ok := reflect.TypeOf(Transaction{}).FieldByName(name)
+	return ok && f.Type.Kind() == reflect.String
+}
+
+func isNumberField(name string) bool {
+	_, computed := computedFields[name]
+	return computed || numberFields[name]
+}
+
+// expression evaluates arithmetic of Transaction fields e.g. "toBase(proceeds + commission) * -1".
+// Supports + - * /, parentheses, numbers and the functions toBase(x) and abs(x). Blank fields are 0, but when every
+// field in the expression is blank the expression is blank too.
+type expression struct {
+	tokens      []string
+	position    int
+	transaction Transaction
+	hasValue    bool // at least one field isn't blank
+}
+
+func newExpression(text string, transaction Transaction) *expression {
+	return &expression{tokens: tokenize(text), transaction: transaction}
+}
+
+func tokenize(text string) []string {
+	var tokens []string
+	for i := 0; i < len(text); {
+		r := rune(text[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("+-*/()", r):
+			tokens = append(tokens, string(r))
+			i++
+		default:
+			start := i
+			for i < len(text) && (unicode.IsLetter(rune(text[i])) || unicode.IsDigit(rune(text[i])) || text[i] == '.' || text[i] == '_') {
+				i++
+			}
+			if start == i {
+				panic(fmt.Sprintf("invalid character %q in expression %s", r, text))
+			}
+			tokens = append(tokens, text[start:i])
+		}
+	}
+	return tokens
+}
+
+func (e *expression) evaluate() (float64, bool) {
+	value := e.sum()
+	if e.position != len(e.tokens) {
+		panic(fmt.Sprintf("unexpected %s in expression %s", e.tokens[e.position], strings.Join(e.tokens, " ")))
+	}
+	return value, e.hasValue
+}
+
+func (e *expression) peek() string {
+	if e.position < len(e.tokens) {
+		return e.tokens[e.position]
+	}
+	return ""
+}
+
+func (e *expression) next() string {
+	token := e.peek()
+	e.position++
+	return token
+}
+
+func (e *expression) sum() float64 {
+	value := e.product()
+	for e.peek() == "+" || e.peek() == "-" {
+		if e.next() == "+" {
+			value += e.product()
+		} else {
+			value -= e.product()
+		}
+	}
+	return value
+}
+
+func (e *expression) product() float64 {
+	value := e.unary()
+	for e.peek() == "*" || e.peek() == "/" {
+		if e.next() == "*" {
+			value *= e.unary()
+		} else {
+			value /= e.unary()
+		}
+	}
+	return value
+}
+
+func (e *expression) unary() float64 {
+	if e.peek() == "-" {
+		e.next()
+		return -e.unary()
+	}
+	return e.operand()
+}
+
+func (e *expression) operand() float64 {
+	token := e.next()
+	switch {
+	case token == "(":
+		value := e.sum()
+		e.expect(")")
+		return value
+
+	case token == "toBase" || token == "abs":
+		e.expect("(")
+		value := e.sum()
+		e.expect(")")
+		if token == "abs" {
+			if value < 0 {
+				return -value
+			}
+			return value
+		}
+		if e.transaction.fxRateToBase == "" {
+			// amounts can't be converted without the exchange rate
+			e.hasValue = false
+			return 0
+		}
+		return value * parseAmount(e.transaction.fxRateToBase)
+
+	case token != "" && (unicode.IsDigit(rune(token[0])) || token[0] == '.'):
+		value, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			panic(err)
+		}
+		return value
+
+	case token != "":
+		value := field(e.transaction, token)
+		if !isNumberField(token) {
+			panic(fmt.Sprintf("text field %s in expression %s", token, strings.Join(e.tokens, " ")))
+		}
+		if value != "" {
+			e.hasValue = true
+		}
+		return parseAmount(value)
+	}
+	panic("unexpected end of expression")
+}
+
+func (e *expression) expect(token string) {
+	if next := e.next(); next != token {
+		panic(fmt.Sprintf("expected %s but got %q in expression %s", token, next, strings.Join(e.tokens, " ")))
+	}
+}
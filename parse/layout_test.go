@@ -0,0 +1,126 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultLayout(t *testing.T) {
+	transaction := Transaction{
+		date:         "2023-06-05",
+		account:      "TFSA",
+		action:       "Trade",
+		ticker:       "TECK",
+		buySell:      "Buy",
+		shares:       "100",
+		price:        "46.07",
+		proceeds:     "-4607.00",
+		commission:   "-1",
+		currency:     "USD",
+		fxRateToBase: "1.3448",
+	}
+
+	rows := DefaultLayout().rows([]Transaction{transaction})
+	require.Len(t, rows, 1)
+	require.Len(t, rows[0], 52)
+	require.Equal(t, []string{"2023-06-05", "TFSA", "", "Trade", "", "", "TECK"}, rows[0][:7])
+	require.Equal(t, []string{"Buy", "", "100", "46.07", "-4607.00"}, rows[0][10:15])
+	require.Equal(t, "-1", rows[0][21])
+	require.Equal(t, []string{"USD", "1.3448", "-6195.49", "-1.34", "", ""}, rows[0][38:44])
+}
+
+func TestLoadLayout(t *testing.T) {
+	layout := LoadLayout("../testdata/layouts/summary.json")
+
+	transactions := []Transaction{
+		{
+			date:         "2023-06-05",
+			ticker:       "TECK",
+			action:       "Trade",
+			price:        "46.07",
+			proceeds:     "-4607",
+			commission:   "-1",
+			fxRateToBase: "1.3448",
+		},
+		{
+			// no exchange rate so amounts can't be converted, no proceeds or commission so there's no net amount
+			date:   "2023-06-06",
+			ticker: "TECK",
+			action: "Dividend",
+		},
+	}
+
+	require.Equal(t, [][]string{
+		{"Date", "Ticker", "Action", "Price", "Net", "Net in Base", "Commission in Base", "Notes"},
+		{"2023-06-05", "TECK", "Trade", "46.07", "-4608.00", "-6196.84", "-1.34", ""},
+		{"2023-06-06", "TECK", "Dividend", "", "", "", "", ""},
+	}, layout.rows(transactions))
+}
+
+func TestLoadLayoutTextFields(t *testing.T) {
+	// text fields pass for a blank transaction but can't be parsed as numbers when the journal is written
+	layouts := map[string]string{
+		"format.json":     `{"columns": [{"name": "Ticker", "field": "ticker", "format": "%.2f"}]}`,
+		"expression.json": `{"columns": [{"name": "Net", "expression": "ticker + 1"}]}`,
+	}
+	for name, layout := range layouts {
+		path := filepath.Join(t.TempDir(), name)
+		require.NoError(t, os.WriteFile(path, []byte(layout), 0644))
+
+		_, err := readLayout(path)
+		require.Error(t, err, name)
+		require.Contains(t, err.Error(), "text field ticker", name)
+	}
+}
+
+func TestLayoutValidate(t *testing.T) {
+	require.NoError(t, DefaultLayout().validate())
+
+	invalid := map[string]Column{
+		"unknown field shares2 in column Shares":                                {Name: "Shares", Field: "shares2"},
+		"unknown field proceeeds in column Net":                                 {Name: "Net", Expression: "proceeeds + commission"},
+		"expected ) but got \"\" in expression toBase ( proceeds in column Net": {Name: "Net", Expression: "toBase(proceeds"},
+		"unexpected end of expression in column Net":                            {Name: "Net", Expression: "proceeds +"},
+		"invalid character '$' in expression $proceeds in column Net":           {Name: "Net", Expression: "$proceeds"},
+		"format %d isn't a number format like %.2f in column Net":               {Name: "Net", Field: "proceeds", Format: "%d"},
+		"format %s isn't a number format like %.2f in column Net":               {Name: "Net", Field: "proceeds", Format: "%s"},
+		"format %.2f %.2f needs a single number verb like %.2f in column Net":   {Name: "Net", Field: "proceeds", Format: "%.2f %.2f"},
+		"format USD needs a single number verb like %.2f in column Net":         {Name: "Net", Field: "proceeds", Format: "USD"},
+		"unknown type money in column Net":                                      {Name: "Net", Field: "proceeds", Type: "money"},
+		"format %.2f on text field ticker in column Ticker":                     {Name: "Ticker", Field: "ticker", Format: "%.2f"},
+		"text field ticker in expression ticker + 1 in column Net":              {Name: "Net", Expression: "ticker + 1"},
+	}
+	for message, column := range invalid {
+		require.EqualError(t, Layout{Columns: []Column{column}}.validate(), message)
+	}
+
+	require.NoError(t, Layout{Columns: []Column{{Name: "Net", Expression: "abs(proceeds) * -1", Format: "%+.2f%%"}}}.validate())
+}
+
+func TestExpression(t *testing.T) {
+	transaction := Transaction{proceeds: "1000", commission: "-1.5", fee: "", fxRateToBase: "1.25"}
+
+	tests := []struct {
+		expression string
+		value      float64
+		hasValue   bool
+	}{
+		{"proceeds + commission", 998.5, true},
+		{"-proceeds * 2 / 4", -500, true},
+		{"(proceeds + commission) * fxRateToBase", 1248.125, true},
+		{"toBase(commission)", -1.875, true},
+		{"abs(commission) + 1", 2.5, true},
+		{"fee * 2", 0, false},
+	}
+	for _, test := range tests {
+		value, hasValue := newExpression(test.expression, transaction).evaluate()
+		require.InDelta(t, test.value, value, 1e-9, test.expression)
+		require.Equal(t, test.hasValue, hasValue, test.expression)
+	}
+
+	require.Panics(t, func() { newExpression("proceeds +", transaction).evaluate() })
+	require.Panics(t, func() { newExpression("unknown", transaction).evaluate() })
+}
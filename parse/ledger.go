@@ -0,0 +1,610 @@
+package parse
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Ledger keeps the open lots of every stock and option position so the cost basis can follow the positions through
+// closing trades, option expiry and corporate actions (e.g. splits, mergers).
+type Ledger struct {
+	// open lots by account ID and symbol, oldest first
+	lots map[string]map[string][]*Lot
+
+	// closed lots (or parts of lots) with their realized P/L
+	closed []Lot
+
+	// lots transferred out of an account that haven't been transferred in to another account yet
+	transfers []Lot
+
+	// fraction of the parent's cost basis allocated to a spin-off by ticker of the spin-off, e.g. 0.0881
+	spinOffAllocations map[string]float64
+}
+
+// Lot is a quantity of a stock or option acquired (or sold short) on the same date at the same cost.
+type Lot struct {
+	account    string  // account ID
+	symbol     string  // e.g. TECK or TECK 21JUL23 38 C
+	ticker     string  // underlying e.g. TECK
+	date       string  // date the lot was opened
+	quantity   float64 // negative for short lots
+	costBasis  float64 // cash paid to open the lot including commission, negative for short lots
+	multiplier float64 // shares per unit e.g. 100 for options
+
+	// set when the lot was closed
+	closeDate  string
+	proceeds   float64
+	realizedPL float64
+}
+
+func NewLedger() *Ledger {
+	return &Ledger{
+		lots:               make(map[string]map[string][]*Lot),
+		spinOffAllocations: make(map[string]float64),
+	}
+}
+
+// SetSpinOffAllocation sets the fraction of the parent's cost basis that moves to the spin-off shares, as published
+// by the company. Without an allocation the spin-off shares have no cost basis.
+func (l *Ledger) SetSpinOffAllocation(ticker string, fraction float64) {
+	l.spinOffAllocations[ticker] = fraction
+}
+
+// Apply applies the trades and corporate actions to the open lots in the order they happened.
+// Corporate action transactions are updated in place with the cost basis and realized P/L they resulted in.
+func (l *Ledger) Apply(transactions []Transaction) {
+	order := ledgerOrder(transactions)
+
+	var mergers []*Transaction
+	for i, index := range order {
+		transaction := &transactions[index]
+		l.Expire(transaction.date)
+
+		switch {
+		case transaction.action == "Corporate Action - Merger":
+			// all legs of a merger (shares removed, shares and cash received) are applied together
+			mergers = append(mergers, transaction)
+			next := i + 1
+			if next < len(order) && sameMerger(*transaction, transactions[order[next]]) {
+				continue
+			}
+			l.merger(mergers)
+			mergers = nil
+		case isCorporateAction(*transaction):
+			l.corporateAction(transaction)
+		case transaction.action == "Transfer":
+			l.transfer(transaction)
+		case transaction.shares != "" || transaction.optionContracts != "":
+			l.trade(*transaction)
+		}
+	}
+}
+
+// ledgerOrder returns the indexes of the transactions in the order they're applied to the lots.
+func ledgerOrder(transactions []Transaction) []int {
+	order := make([]int, len(transactions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ta, tb := transactions[order[a]], transactions[order[b]]
+		if ta.date != tb.date {
+			return ta.date < tb.date
+		}
+		if applyOrder(ta) != applyOrder(tb) {
+			return applyOrder(ta) < applyOrder(tb)
+		}
+		// legs of the same corporate action are kept together
+		if isCorporateAction(ta) && ta.action != tb.action {
+			return ta.action < tb.action
+		}
+		return ta.orderID < tb.orderID
+	})
+	return order
+}
+
+// sameMerger checks whether the transaction is another leg of the merger.
+func sameMerger(merger Transaction, transaction Transaction) bool {
+	return merger.action == "Corporate Action - Merger" &&
+		transaction.action == merger.action &&
+		transaction.accountID == merger.accountID &&
+		transaction.date == merger.date
+}
+
+// applyOrder orders the transactions of the same day: trades, then shares transferred out so they can be
+// transferred in to another account, then corporate actions.
+func applyOrder(transaction Transaction) int {
+	switch {
+	case isCorporateAction(transaction):
+		return 3
+	case transaction.action == "Transfer" && parseAmount(transaction.shares) > 0:
+		return 2
+	case transaction.action == "Transfer":
+		return 1
+	}
+	return 0
+}
+
+func isCorporateAction(transaction Transaction) bool {
+	return strings.HasPrefix(transaction.action, "Corporate Action")
+}
+
+// trade opens a lot or closes the oldest lots in the opposite direction (FIFO).
+func (l *Ledger) trade(transaction Transaction) {
+	cash := parseAmount(transaction.proceeds) + parseAmount(transaction.commission)
+
+	if transaction.shares != "" && transaction.optionContract != "" {
+		// stock trade from an option assignment / exercise, the option's premium becomes part of the stock's cost so
+		// the option is closed without a realized P/L
+		option := transaction.ticker + " " + transaction.optionContract
+		contracts := math.Abs(parseAmount(transaction.shares)) / 100
+		for _, lot := range l.take(transaction.accountID, option, contracts) {
+			lot.closeDate, lot.proceeds, lot.realizedPL = transaction.date, lot.costBasis, 0
+			l.closed = append(l.closed, lot)
+			cash -= lot.costBasis
+		}
+	}
+
+	symbol, quantity, multiplier := transaction.ticker, parseAmount(transaction.shares), 1.0
+	if transaction.multiplier != "" {
+		// futures, bonds and mutual funds
+		multiplier = parseAmount(transaction.multiplier)
+	}
+	if transaction.shares == "" {
+		symbol = transaction.ticker + " " + transaction.optionContract
+		quantity, multiplier = parseAmount(transaction.optionContracts), 100
+	}
+
+	// close lots in the opposite direction first
+	open := l.openLots(transaction.accountID, symbol)
+	closing := 0.0
+	for _, lot := range open {
+		if lot.quantity*quantity < 0 {
+			closing += math.Abs(lot.quantity)
+		}
+	}
+	closing = math.Min(closing, math.Abs(quantity))
+	if closing > 0 {
+		l.close(transaction.accountID, symbol, transaction.date, closing, cash*closing/math.Abs(quantity))
+	}
+
+	remaining := math.Abs(quantity) - closing
+	if remaining <= 0 {
+		return
+	}
+	direction := 1.0
+	if quantity < 0 {
+		direction = -1
+	}
+	l.open(&Lot{
+		account:    transaction.accountID,
+		symbol:     symbol,
+		ticker:     transaction.ticker,
+		date:       transaction.date,
+		quantity:   remaining * direction,
+		costBasis:  -cash * remaining / math.Abs(quantity),
+		multiplier: multiplier,
+	})
+}
+
+func (l *Ledger) openLots(accountID string, symbol string) []*Lot {
+	return l.lots[accountID][symbol]
+}
+
+func (l *Ledger) open(lot *Lot) {
+	if l.lots[lot.account] == nil {
+		l.lots[lot.account] = make(map[string][]*Lot)
+	}
+	l.lots[lot.account][lot.symbol] = append(l.lots[lot.account][lot.symbol], lot)
+}
+
+// close closes the quantity of the oldest open lots for the proceeds. The closed parts of the lots are returned.
+func (l *Ledger) close(accountID string, symbol string, date string, quantity float64, proceeds float64) []Lot {
+	closed := l.take(accountID, symbol, quantity)
+	for i := range closed {
+		closed[i].closeDate = date
+		closed[i].proceeds = proceeds * math.Abs(closed[i].quantity) / quantity
+		closed[i].realizedPL = closed[i].proceeds - closed[i].costBasis
+	}
+	l.closed = append(l.closed, closed...)
+	return closed
+}
+
+// take removes the quantity from the oldest open lots, splitting the last lot when only part of it is taken.
+// The parts of the lots taken are returned.
+func (l *Ledger) take(accountID string, symbol string, quantity float64) []Lot {
+	var taken []Lot
+	remaining := quantity
+	lots := l.openLots(accountID, symbol)
+	for len(lots) > 0 && remaining > 1e-9 {
+		lot := lots[0]
+		closing := math.Min(remaining, math.Abs(lot.quantity))
+		fraction := closing / math.Abs(lot.quantity)
+
+		part := *lot
+		part.quantity = lot.quantity * fraction
+		part.costBasis = lot.costBasis * fraction
+		taken = append(taken, part)
+
+		lot.quantity -= part.quantity
+		lot.costBasis -= part.costBasis
+		if math.Abs(lot.quantity) < 1e-9 {
+			lots = lots[1:]
+		}
+		remaining -= closing
+	}
+	l.setLots(accountID, symbol, lots)
+	return taken
+}
+
+// transfer moves lots between accounts without realizing a gain or loss.
+// Shares transferred out are kept until they're transferred in to another account (e.g. internal transfer between
+// IBKR accounts) with their original cost basis and acquisition date. Shares transferred in from another broker
+// (e.g. ACATS) open a lot with the cost basis and acquisition date reported with the transfer, or the market value
+// on the transfer date when the cost basis isn't known.
+func (l *Ledger) transfer(transaction *Transaction) {
+	quantity := parseAmount(transaction.shares)
+
+	if quantity < 0 {
+		lots := l.take(transaction.accountID, transaction.ticker, -quantity)
+		l.transfers = append(l.transfers, lots...)
+		setTransferred(transaction, lots, 1)
+		return
+	}
+
+	// lots transferred out of another account, oldest first
+	var lots []Lot
+	remaining := quantity
+	for i := 0; i < len(l.transfers) && remaining > 1e-9; i++ {
+		lot := &l.transfers[i]
+		if lot.symbol != transaction.ticker || lot.account == transaction.accountID || lot.quantity <= 0 {
+			continue
+		}
+		part := *lot
+		if lot.quantity > remaining {
+			part.quantity = remaining
+			part.costBasis = lot.costBasis * remaining / lot.quantity
+		}
+		lot.quantity -= part.quantity
+		lot.costBasis -= part.costBasis
+		remaining -= part.quantity
+
+		part.account = transaction.accountID
+		lots = append(lots, part)
+	}
+
+	if remaining > 1e-9 {
+		costBasis := -parseAmount(transaction.costBasisTotal)
+		if transaction.costBasisTotal == "" {
+			costBasis = parseAmount(transaction.value)
+		}
+		date := transaction.acquiredDate
+		if date == "" {
+			date = transaction.date
+		}
+		lots = append(lots, Lot{
+			account:    transaction.accountID,
+			symbol:     transaction.ticker,
+			ticker:     transaction.ticker,
+			date:       date,
+			quantity:   remaining,
+			costBasis:  costBasis * remaining / quantity,
+			multiplier: 1,
+		})
+	}
+
+	for i := range lots {
+		lot := lots[i]
+		l.open(&lot)
+	}
+	setTransferred(transaction, lots, -1)
+}
+
+// setTransferred sets the cost basis and earliest acquisition date of the lots transferred on the transfer.
+// The cost basis follows the sign of trades: negative for shares transferred in like a buy, positive for shares
+// transferred out like a sale.
+func setTransferred(transaction *Transaction, lots []Lot, sign float64) {
+	if len(lots) == 0 {
+		return
+	}
+	costBasis := 0.0
+	acquiredDate := lots[0].date
+	for _, lot := range lots {
+		costBasis += lot.costBasis
+		if lot.date < acquiredDate {
+			acquiredDate = lot.date
+		}
+	}
+	transaction.costBasisTotal = fmt.Sprintf("%.2f", costBasis*sign)
+	transaction.acquiredDate = acquiredDate
+}
+
+func (l *Ledger) setLots(accountID string, symbol string, lots []*Lot) {
+	if len(lots) == 0 {
+		delete(l.lots[accountID], symbol)
+		return
+	}
+	l.lots[accountID][symbol] = lots
+}
+
+// Expire closes the option lots that expired before the date without a closing trade (e.g. lapsed out of the money).
+func (l *Ledger) Expire(date string) {
+	for _, lot := range l.Lots() {
+		expiry := optionExpiry(lot.symbol)
+		if expiry == "" || expiry >= date {
+			continue
+		}
+		l.close(lot.account, lot.symbol, expiry, math.Abs(lot.quantity), 0)
+	}
+}
+
+// optionExpiry returns the expiry date of an option symbol, or blank for other symbols.
+// e.g. TECK 21JUL23 38 C will return 2023-07-21
+func optionExpiry(symbol string) string {
+	parts := strings.Split(symbol, " ")
+	if len(parts) != 4 {
+		return ""
+	}
+	expiry, err := time.Parse("02Jan06", parts[1])
+	if err != nil {
+		return ""
+	}
+	return expiry.Format("2006-01-02")
+}
+
+// corporateAction applies a split, symbol change or spin-off to the open lots.
+func (l *Ledger) corporateAction(transaction *Transaction) {
+	ticker, other := corporateActionTickers(transaction.notes)
+
+	switch transaction.action {
+	case "Corporate Action - Split":
+		// reverse splits list the removed shares under the old ticker (e.g. XYZ.OLD), the split is applied once
+		if strings.HasSuffix(ticker, ".OLD") {
+			return
+		}
+		ratio := splitRatio(transaction.notes)
+		costBasis := 0.0
+		for symbol, lots := range l.lots[transaction.accountID] {
+			for _, lot := range lots {
+				if lot.ticker != ticker {
+					continue
+				}
+				if symbol == ticker {
+					// same cost basis spread over more (or fewer) shares
+					lot.quantity *= ratio
+					costBasis += lot.costBasis
+				} else {
+					// option deliverable is adjusted to the new number of shares
+					lot.multiplier *= ratio
+				}
+			}
+		}
+		transaction.costBasisTotal = fmt.Sprintf("%.2f", costBasis)
+
+	case "Corporate Action - Symbol Change":
+		// the shares are removed under the old ticker and added under the new ticker, the lots are renamed once
+		// e.g. "META(US30303M1027) Change of Symbol (FB, META PLATFORMS INC-CLASS A, US30303M1027)"
+		if parseAmount(transaction.shares) < 0 {
+			return
+		}
+		from, to := other, ticker
+		costBasis := 0.0
+		for symbol, lots := range l.lots[transaction.accountID] {
+			if lots[0].ticker != from {
+				continue
+			}
+			renamed := to + strings.TrimPrefix(symbol, from)
+			for _, lot := range lots {
+				lot.ticker = to
+				lot.symbol = renamed
+				if symbol == from {
+					costBasis += lot.costBasis
+				}
+			}
+			delete(l.lots[transaction.accountID], symbol)
+			l.lots[transaction.accountID][renamed] = lots
+		}
+		transaction.costBasisTotal = fmt.Sprintf("%.2f", costBasis)
+
+	case "Corporate Action - Spin-off":
+		// the parent is the ticker with open lots, the other ticker is the spin-off
+		parent, spinOff := other, ticker
+		if len(l.lots[transaction.accountID][parent]) == 0 {
+			parent, spinOff = ticker, other
+		}
+		parentLots := l.lots[transaction.accountID][parent]
+		parentQuantity := 0.0
+		for _, lot := range parentLots {
+			parentQuantity += lot.quantity
+		}
+		if parentQuantity == 0 {
+			return
+		}
+
+		// spin-off shares keep the acquisition date of the parent shares they were received for
+		allocation := l.spinOffAllocations[spinOff]
+		quantity := parseAmount(transaction.shares)
+		costBasis := 0.0
+		for _, lot := range parentLots {
+			allocated := lot.costBasis * allocation
+			lot.costBasis -= allocated
+			costBasis += allocated
+			l.open(&Lot{
+				account:    transaction.accountID,
+				symbol:     spinOff,
+				ticker:     spinOff,
+				date:       lot.date,
+				quantity:   quantity * lot.quantity / parentQuantity,
+				costBasis:  allocated,
+				multiplier: 1,
+			})
+		}
+		transaction.costBasisTotal = fmt.Sprintf("%.2f", costBasis)
+	}
+}
+
+// merger closes the lots of the acquired company and opens lots of the acquiring company's shares received.
+// The cost basis is allocated between the cash and the shares received by their value, so only the cash part
+// realizes a gain or loss.
+func (l *Ledger) merger(legs []*Transaction) {
+	cash, value := 0.0, 0.0
+	for _, leg := range legs {
+		cash += parseAmount(leg.proceeds)
+		if parseAmount(leg.shares) > 0 {
+			value += parseAmount(leg.value)
+		}
+	}
+	stockFraction := 1.0
+	if cash+value != 0 {
+		stockFraction = value / (cash + value)
+	}
+
+	// shares removed
+	var acquired []Lot
+	costBasis := 0.0
+	for _, leg := range legs {
+		if parseAmount(leg.shares) >= 0 {
+			continue
+		}
+		ticker, _ := corporateActionTickers(leg.notes)
+		open := l.openLots(leg.accountID, ticker)
+		for _, lot := range open {
+			acquired = append(acquired, *lot)
+			costBasis += lot.costBasis
+		}
+		// only the cash part of the cost basis is closed against the cash received
+		start := len(l.closed)
+		l.close(leg.accountID, ticker, leg.date, math.Abs(parseAmount(leg.shares)), cash)
+		realizedPL := 0.0
+		for i := start; i < len(l.closed); i++ {
+			l.closed[i].costBasis *= 1 - stockFraction
+			l.closed[i].realizedPL = l.closed[i].proceeds - l.closed[i].costBasis
+			realizedPL += l.closed[i].realizedPL
+		}
+		leg.costBasisTotal = fmt.Sprintf("%.2f", costBasis)
+		leg.realizedPL = fmt.Sprintf("%.2f", realizedPL)
+	}
+
+	// shares received keep the acquisition date of the shares they replaced
+	acquiredQuantity := 0.0
+	for _, lot := range acquired {
+		acquiredQuantity += lot.quantity
+	}
+	for _, leg := range legs {
+		quantity := parseAmount(leg.shares)
+		if quantity <= 0 || acquiredQuantity == 0 {
+			continue
+		}
+		ticker, _ := corporateActionTickers(leg.notes)
+		for _, lot := range acquired {
+			l.open(&Lot{
+				account:    leg.accountID,
+				symbol:     ticker,
+				ticker:     ticker,
+				date:       lot.date,
+				quantity:   quantity * lot.quantity / acquiredQuantity,
+				costBasis:  lot.costBasis * stockFraction,
+				multiplier: 1,
+			})
+		}
+		leg.costBasisTotal = fmt.Sprintf("%.2f", costBasis*stockFraction)
+	}
+}
+
+// corporateActionTickers returns the ticker the corporate action row is for and the other ticker in the description.
+// e.g. "GOOGL(US02079K3059) Split 20 for 1 (GOOGL, ALPHABET INC-CL A, US02079K3059)" will return GOOGL, GOOGL
+// e.g. "IBM(US4592001014) Spinoff 1 for 5 (KD, KYNDRYL HOLDINGS INC, US50155Q1004)" will return IBM, KD
+func corporateActionTickers(description string) (string, string) {
+	ticker := strings.Split(description, "(")[0]
+	other := ticker
+	if i := strings.LastIndex(description, "("); i != -1 {
+		other = strings.TrimSpace(strings.Split(description[i+1:], ",")[0])
+	}
+	return ticker, other
+}
+
+// splitRatio returns the number of new shares for each old share.
+// e.g. "Split 20 for 1" will return 20, "Split 1 for 10" will return 0.1
+func splitRatio(description string) float64 {
+	var newShares, oldShares float64
+	i := strings.Index(description, "Split ")
+	if i == -1 {
+		panic(fmt.Sprintf("no split ratio in %s", description))
+	}
+	if _, err := fmt.Sscanf(description[i:], "Split %g for %g", &newShares, &oldShares); err != nil {
+		panic(err)
+	}
+	return newShares / oldShares
+}
+
+// corporateActionType classifies a corporate action from its description.
+func corporateActionType(description string) string {
+	switch {
+	case strings.Contains(description, " Split "):
+		return "Split"
+	case strings.Contains(description, "Merged") || strings.Contains(description, "Merger"):
+		return "Merger"
+	case strings.Contains(description, "Spinoff") || strings.Contains(description, "Spin-off"):
+		return "Spin-off"
+	case strings.Contains(description, "Change of Symbol") || strings.Contains(description, "Change of Listing"):
+		return "Symbol Change"
+	}
+	return "Other"
+}
+
+// Lots returns the open lots sorted by account, symbol and date.
+func (l *Ledger) Lots() []Lot {
+	var lots []Lot
+	for _, symbols := range l.lots {
+		for _, symbolLots := range symbols {
+			for _, lot := range symbolLots {
+				lots = append(lots, *lot)
+			}
+		}
+	}
+	sort.SliceStable(lots, func(a, b int) bool {
+		if lots[a].account != lots[b].account {
+			return lots[a].account < lots[b].account
+		}
+		if lots[a].symbol != lots[b].symbol {
+			return lots[a].symbol < lots[b].symbol
+		}
+		return lots[a].date < lots[b].date
+	})
+	return lots
+}
+
+// Closed returns the closed lots with their realized P/L in the order they were closed.
+func (l *Ledger) Closed() []Lot {
+	return l.closed
+}
+
+// ToCsv writes the open lots to a CSV file.
+func (l *Ledger) ToCsv(csvPath string) {
+	rows := [][]string{{"Account", "Symbol", "Date", "Quantity", "Cost Basis", "Cost Basis Per Share"}}
+	for _, lot := range l.Lots() {
+		rows = append(rows, []string{
+			lot.account,
+			lot.symbol,
+			lot.date,
+			fmt.Sprint(lot.quantity),
+			fmt.Sprintf("%.2f", lot.costBasis),
+			fmt.Sprintf("%.8f", lot.costBasis/(lot.quantity*lot.multiplier)),
+		})
+	}
+
+	f, err := os.Create(csvPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	writer := csv.NewWriter(f)
+	writer.WriteAll(rows)
+}
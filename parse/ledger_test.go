@@ -0,0 +1,194 @@
+package parse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedgerCorporateActions(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/20-corporate-actions.csv")
+
+	ledger := NewLedger()
+	ledger.SetSpinOffAllocation("KD", 0.1)
+	ledger.Apply(transactions)
+
+	lot := func(symbol string, ticker string, date string, quantity float64, costBasis float64, multiplier float64) Lot {
+		return Lot{
+			account:    "U1234567",
+			symbol:     symbol,
+			ticker:     ticker,
+			date:       date,
+			quantity:   quantity,
+			costBasis:  costBasis,
+			multiplier: multiplier,
+		}
+	}
+
+	lots := ledger.Lots()
+	require.Len(t, lots, 5)
+	// 2 for 1 split and then GOOGL changed to GOOG, the option deliverable doubled to 200 shares
+	require.Equal(t, lot("GOOG", "GOOG", "2023-06-01", 200, 12001, 1), lots[0])
+	require.Equal(t, lot("GOOG 21JUL23 130 C", "GOOG", "2023-06-02", 1, 201, 200), lots[1])
+	// 10% of the IBM cost basis allocated to the KD spin-off
+	require.Equal(t, "IBM", lots[2].symbol)
+	require.InDelta(t, 11700.90, lots[2].costBasis, 1e-6)
+	require.Equal(t, "KD", lots[3].symbol)
+	require.Equal(t, "2023-06-01", lots[3].date)
+	require.InDelta(t, 20, lots[3].quantity, 1e-9)
+	require.InDelta(t, 1300.10, lots[3].costBasis, 1e-6)
+	// ATVI acquired for cash and MSFT shares, cost basis split by the value of each
+	require.Equal(t, "MSFT", lots[4].symbol)
+	require.Equal(t, "2023-06-01", lots[4].date)
+	require.InDelta(t, 40, lots[4].quantity, 1e-9)
+	require.InDelta(t, 10241.95, lots[4].costBasis, 0.005)
+
+	closed := ledger.Closed()
+	require.Len(t, closed, 2)
+	// lapsed option
+	require.Equal(t, "IBM 16JUN23 140 C", closed[0].symbol)
+	require.Equal(t, "2023-06-16", closed[0].closeDate)
+	require.InDelta(t, -101, closed[0].realizedPL, 1e-9)
+	// cash part of the merger
+	require.Equal(t, "ATVI", closed[1].symbol)
+	require.InDelta(t, 10000, closed[1].proceeds, 1e-9)
+	require.InDelta(t, 2240.95, closed[1].realizedPL, 0.005)
+
+	// corporate action rows have the cost basis from the ledger
+	costBasis := make(map[string]string)
+	realizedPL := make(map[string]string)
+	for _, transaction := range transactions {
+		if isCorporateAction(transaction) && transaction.costBasisTotal != "" {
+			costBasis[transaction.action+" "+transaction.ticker] = transaction.costBasisTotal
+			realizedPL[transaction.action+" "+transaction.ticker] = transaction.realizedPL
+		}
+	}
+	require.Equal(t, map[string]string{
+		"Corporate Action - Split GOOGL":        "12001.00",
+		"Corporate Action - Symbol Change GOOG": "12001.00",
+		"Corporate Action - Merger ATVI":        "18001.00",
+		"Corporate Action - Merger MSFT":        "10241.95",
+		"Corporate Action - Spin-off KD":        "1300.10",
+	}, costBasis)
+	require.Equal(t, "2240.95", realizedPL["Corporate Action - Merger ATVI"])
+}
+
+func TestLedgerMultipleTrades(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/13-multiple-trades-same-ticker.csv")
+
+	ledger := NewLedger()
+	ledger.Apply(transactions)
+
+	var symbols []string
+	quantities := make(map[string]float64)
+	for _, lot := range ledger.Lots() {
+		symbols = append(symbols, lot.symbol)
+		quantities[lot.symbol] += lot.quantity
+	}
+	// BBWI stock sold and bought back the same day, FDX bought and then called away
+	require.Equal(t, []string{
+		"BBWI 16JUN23 35 C",
+		"PR", "PR",
+		"XOM", "XOM",
+		"XOM 21JUL23 110 C",
+		"XOM 21JUL23 115 C",
+	}, symbols)
+	require.Equal(t, 500.0, quantities["PR"])
+	require.Equal(t, -1.0, quantities["XOM 21JUL23 110 C"])
+
+	closed := ledger.Closed()
+	require.Len(t, closed, 2)
+	require.Equal(t, "BBWI", closed[0].symbol)
+	require.Equal(t, "FDX", closed[1].symbol)
+	require.InDelta(t, 15500-0.1385-22001, closed[1].realizedPL, 1e-6)
+}
+
+func TestLedgerTransfers(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/21-transfers.csv")
+
+	ledger := NewLedger()
+	ledger.Apply(transactions)
+
+	lots := ledger.Lots()
+	require.Len(t, lots, 4)
+	// ACATS without a cost basis is valued at the market value on the transfer date
+	require.Equal(t, Lot{account: "U1237792", symbol: "KO", ticker: "KO", date: "2023-06-12", quantity: 50, costBasis: 3100, multiplier: 1}, lots[0])
+	// ACATS with the cost basis and acquisition date from the other broker
+	require.Equal(t, Lot{account: "U1237792", symbol: "MSFT", ticker: "MSFT", date: "2021-03-15", quantity: 10, costBasis: 2500, multiplier: 1}, lots[1])
+	// internal transfer keeps the original acquisition date and cost basis
+	require.Equal(t, "U1237792", lots[2].account)
+	require.Equal(t, "2023-06-01", lots[2].date)
+	require.InDelta(t, 60, lots[2].quantity, 1e-9)
+	require.InDelta(t, 600.60, lots[2].costBasis, 1e-9)
+	require.Equal(t, "U2084273", lots[3].account)
+	require.InDelta(t, 40, lots[3].quantity, 1e-9)
+	require.InDelta(t, 400.40, lots[3].costBasis, 1e-9)
+
+	// transfers don't realize a gain or loss
+	require.Empty(t, ledger.Closed())
+
+	transfers := make(map[string]Transaction)
+	for _, transaction := range transactions {
+		if transaction.action == "Transfer" {
+			transfers[transaction.accountID+" "+transaction.ticker] = transaction
+		}
+	}
+	require.Len(t, transfers, 4)
+
+	out := transfers["U2084273 PR"]
+	require.Equal(t, "Transfer", out.buySell)
+	require.Equal(t, "-60", out.shares)
+	require.Equal(t, "600.60", out.costBasisTotal)
+	require.Equal(t, "2023-06-01", out.acquiredDate)
+	require.Equal(t, "internal transfer out to U1237792", out.notes)
+
+	in := transfers["U1237792 PR"]
+	require.Equal(t, "60", in.shares)
+	require.Equal(t, "-600.60", in.costBasisTotal)
+	require.Equal(t, "2023-06-01", in.acquiredDate)
+	require.Equal(t, "internal transfer in from U2084273", in.notes)
+
+	acats := transfers["U1237792 MSFT"]
+	require.Equal(t, "-2500.00", acats.costBasisTotal)
+	require.Equal(t, "2021-03-15", acats.acquiredDate)
+	require.Equal(t, "ACATS transfer in from Questrade 12345678", acats.notes)
+}
+
+func TestOptionExpiry(t *testing.T) {
+	require.Equal(t, "2023-07-21", optionExpiry("TECK 21JUL23 38 C"))
+	require.Equal(t, "", optionExpiry("TECK"))
+}
+
+func TestSplitRatio(t *testing.T) {
+	require.Equal(t, 20.0, splitRatio("GOOGL(US02079K3059) Split 20 for 1 (GOOGL, ALPHABET INC-CL A, US02079K3059)"))
+	require.Equal(t, 0.1, splitRatio("XYZ(US0000000001) Split 1 for 10 (XYZ.OLD, XYZ CORP, US0000000002)"))
+}
+
+func TestLedgerAssignmentPnl(t *testing.T) {
+	stock := Transaction{date: "2023-06-01", accountID: "U1234567", action: "Trade", ticker: "XOM", buySell: "Buy", shares: "100", proceeds: "-10000", commission: "-1"}
+	call := Transaction{date: "2023-06-01", accountID: "U1234567", action: "Trade - Option", ticker: "XOM", optionContract: "16JUN23 105 C",
+		buySell: "Sell", optionContracts: "-1", proceeds: "500", commission: "-1"}
+	assignment := Transaction{date: "2023-06-16", accountID: "U1234567", action: "Trade - Option - Assignment", ticker: "XOM",
+		optionContract: "16JUN23 105 C", buySell: "Sell", shares: "-100", proceeds: "10500", commission: "0"}
+
+	ledger := NewLedger()
+	ledger.Apply([]Transaction{stock, call, assignment})
+	require.Empty(t, ledger.Lots())
+
+	// the premium is realized once, with the stock
+	closed := ledger.Closed()
+	require.Len(t, closed, 2)
+	require.Equal(t, "XOM 16JUN23 105 C", closed[0].symbol)
+	require.Equal(t, 0.0, closed[0].realizedPL)
+	require.Equal(t, "XOM", closed[1].symbol)
+	require.InDelta(t, 998, closed[1].realizedPL, 1e-9)
+
+	total := 0.0
+	for _, lot := range ledger.ClosedBetween("", "") {
+		total += lot.realizedPL
+	}
+	require.InDelta(t, 998, total, 1e-9)
+}
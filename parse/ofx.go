@@ -0,0 +1,372 @@
+package parse
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ToOfx writes the transactions as an OFX 2.2 investment statement (INVSTMTRS) for each account, followed by the list
+// of securities from the statements' "Financial Instrument Information".
+// Totals have the sign of the cash moved: negative for buys, fees and withholding tax, positive for sells and income.
+func (j *Journal) ToOfx(txs []Transaction, ofxPath string) {
+	var out strings.Builder
+	out.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+`)
+	dates := func(txs []Transaction) (string, string) {
+		start, end := "", ""
+		for _, tx := range txs {
+			if start == "" || tx.date < start {
+				start = tx.date
+			}
+			if tx.date > end {
+				end = tx.date
+			}
+		}
+		return ofxDate(start), ofxDate(end)
+	}
+	_, asOf := dates(txs)
+
+	out.WriteString("<OFX>\n")
+	out.WriteString("<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>")
+	out.WriteString(fmt.Sprintf("<DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>\n", asOf))
+
+	out.WriteString("<INVSTMTMSGSRSV1>\n")
+	fitIDs := make(map[string]bool)
+	for i, account := range transactionAccounts(txs) {
+		accountTxs := FilterAccount(txs, account)
+		sortTransactions(accountTxs)
+		start, end := dates(accountTxs)
+		baseCurrency := j.findAccount(account).baseCurrency
+		if baseCurrency == "" {
+			baseCurrency = accountTxs[0].currency
+		}
+
+		out.WriteString(fmt.Sprintf("<INVSTMTTRNRS><TRNUID>%d</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n", i+1))
+		out.WriteString("<INVSTMTRS>")
+		out.WriteString(ofxTag("DTASOF", end) + ofxTag("CURDEF", baseCurrency))
+		out.WriteString("<INVACCTFROM>" + ofxTag("BROKERID", "interactivebrokers.com") + ofxTag("ACCTID", account) + "</INVACCTFROM>\n")
+		out.WriteString("<INVTRANLIST>" + ofxTag("DTSTART", start) + ofxTag("DTEND", end) + "\n")
+		for _, tx := range accountTxs {
+			for _, transaction := range j.ofxTransactions(tx, baseCurrency, fitIDs) {
+				out.WriteString(transaction + "\n")
+			}
+		}
+		out.WriteString("</INVTRANLIST>\n</INVSTMTRS>\n</INVSTMTTRNRS>\n")
+	}
+	out.WriteString("</INVSTMTMSGSRSV1>\n")
+
+	out.WriteString("<SECLISTMSGSRSV1><SECLIST>\n")
+	for _, security := range j.securities(txs) {
+		out.WriteString(ofxSecurity(security) + "\n")
+	}
+	out.WriteString("</SECLIST></SECLISTMSGSRSV1>\n</OFX>\n")
+
+	writeText(ofxPath, out.String())
+}
+
+// ofxTransactions converts a transaction to OFX investment transactions, e.g. a dividend with withholding tax is
+// income and an expense.
+func (j *Journal) ofxTransactions(t Transaction, baseCurrency string, fitIDs map[string]bool) []string {
+	currency := ""
+	if t.currency != "" && t.currency != baseCurrency && t.fxRateToBase != "" {
+		currency = ofxCurrency(t.fxRateToBase, t.currency)
+	}
+	invtran := func(suffix string) string {
+		return "<INVTRAN>" + ofxTag("FITID", fitID(t, suffix, fitIDs)) + ofxTag("DTTRADE", ofxDate(t.date)) +
+			ofxTag("MEMO", narration(t)) + "</INVTRAN>"
+	}
+	security := j.instrument(securitySymbol(t))
+	secID := ofxSecID(security)
+	cashAccounts := ofxTag("SUBACCTSEC", "CASH") + ofxTag("SUBACCTFUND", "CASH")
+	bank := func(suffix string, trnType string, amount float64, currency string) string {
+		return "<INVBANKTRAN><STMTTRN>" + ofxTag("TRNTYPE", trnType) + ofxTag("DTPOSTED", ofxDate(t.date)) +
+			ofxTag("TRNAMT", plainNumber(amount)) + ofxTag("FITID", fitID(t, suffix, fitIDs)) +
+			ofxTag("NAME", firstChars(narration(t), 32)) + ofxTag("MEMO", narration(t)) + currency +
+			"</STMTTRN>" + ofxTag("SUBACCTFUND", "CASH") + "</INVBANKTRAN>"
+	}
+	expense := func(suffix string, amount float64) string {
+		if secID == "" {
+			return bank(suffix, "FEE", amount, currency)
+		}
+		return "<INVEXPENSE>" + invtran(suffix) + secID + ofxTag("TOTAL", plainNumber(amount)) + cashAccounts + currency +
+			"</INVEXPENSE>"
+	}
+
+	commission := parseAmount(t.commission)
+	var transactions []string
+	switch {
+	case t.action == "Forex":
+		bought, sold := parseAmount(t.forexBuyAmount), parseAmount(t.forexSellAmount)
+		transactions = append(transactions,
+			bank("buy", "CREDIT", bought, j.ofxForexCurrency(t.date, t.forexBuyCurrency, baseCurrency)),
+			bank("sell", "DEBIT", sold, j.ofxForexCurrency(t.date, t.forexSellCurrency, baseCurrency)),
+		)
+		if commission != 0 {
+			commissionCurrency := t.currency
+			if t.commissionCurrency != "" {
+				commissionCurrency = t.commissionCurrency
+			}
+			transactions = append(transactions,
+				bank("commission", "FEE", commission, j.ofxForexCurrency(t.date, commissionCurrency, baseCurrency)))
+		}
+
+	case strings.HasPrefix(t.action, "Trade"):
+		_, quantity := tradedSymbol(t)
+		if quantity == 0 {
+			return nil
+		}
+		proceeds, accrued := parseAmount(t.proceeds), parseAmount(t.accruedInterest)
+		// accrued interest of bonds isn't included in the total
+		total := proceeds + commission
+		if t.action == "Trade - Future" {
+			total = parseAmount(t.mtmPL) + commission
+		}
+		price := parseAmount(t.price)
+		if price == 0 && proceeds != 0 {
+			price = math.Abs(proceeds / quantity)
+			if security.isOption() {
+				price /= 100
+			}
+		}
+		codes := strings.Split(t.codes, ";")
+		buy := quantity > 0
+		closing := isClosingTrade(t)
+		trade := invtran("")
+
+		if security.isOption() && proceeds == 0 && (contains(codes, "Ep") || contains(codes, "A") || contains(codes, "Ex")) {
+			action := "EXPIRE"
+			if contains(codes, "A") {
+				action = "ASSIGN"
+			} else if contains(codes, "Ex") {
+				action = "EXERCISE"
+			}
+			transactions = append(transactions, "<CLOSUREOPT>"+trade+secID+ofxTag("OPTACTION", action)+
+				ofxTag("UNITS", plainNumber(quantity))+ofxTag("SHPERCTRCT", multiplierOr(security.multiplier, "100"))+
+				ofxTag("SUBACCTSEC", "CASH")+"</CLOSUREOPT>")
+			break
+		}
+
+		aggregate := ofxTag("UNITS", plainNumber(quantity)) + ofxTag("UNITPRICE", plainNumber(math.Abs(price))) +
+			ofxTag("COMMISSION", plainNumber(-commission)) + ofxTag("TOTAL", plainNumber(total)) + currency + cashAccounts
+		invbuy := "<INVBUY>" + trade + secID + aggregate + "</INVBUY>"
+		invsell := "<INVSELL>" + trade + secID + aggregate + "</INVSELL>"
+
+		switch {
+		case security.isOption():
+			shares := ofxTag("SHPERCTRCT", multiplierOr(security.multiplier, "100"))
+			if buy {
+				transactions = append(transactions, "<BUYOPT>"+invbuy+ofxTag("OPTBUYTYPE", choose(closing, "BUYTOCLOSE", "BUYTOOPEN"))+shares+"</BUYOPT>")
+			} else {
+				transactions = append(transactions, "<SELLOPT>"+invsell+ofxTag("OPTSELLTYPE", choose(closing, "SELLTOCLOSE", "SELLTOOPEN"))+shares+"</SELLOPT>")
+			}
+		case t.action == "Trade - Bond":
+			interest := ofxTag("ACCRDINT", plainNumber(accrued))
+			if buy {
+				transactions = append(transactions, "<BUYDEBT>"+invbuy+interest+"</BUYDEBT>")
+			} else {
+				transactions = append(transactions, "<SELLDEBT>"+invsell+ofxTag("SELLREASON", "SELL")+interest+"</SELLDEBT>")
+			}
+		case t.action == "Trade - Mutual Fund":
+			if buy {
+				transactions = append(transactions, "<BUYMF>"+invbuy+ofxTag("BUYTYPE", "BUY")+"</BUYMF>")
+			} else {
+				transactions = append(transactions, "<SELLMF>"+invsell+ofxTag("SELLTYPE", "SELL")+"</SELLMF>")
+			}
+		case t.action == "Trade - Future":
+			if buy {
+				transactions = append(transactions, "<BUYOTHER>"+invbuy+"</BUYOTHER>")
+			} else {
+				transactions = append(transactions, "<SELLOTHER>"+invsell+"</SELLOTHER>")
+			}
+		default:
+			if buy {
+				transactions = append(transactions, "<BUYSTOCK>"+invbuy+ofxTag("BUYTYPE", choose(t.action == "Trade - Cover", "BUYTOCOVER", "BUY"))+"</BUYSTOCK>")
+			} else {
+				transactions = append(transactions, "<SELLSTOCK>"+invsell+ofxTag("SELLTYPE", choose(t.action == "Trade - Short", "SELLSHORT", "SELL"))+"</SELLSTOCK>")
+			}
+		}
+
+	case t.action == "Transfer" || strings.HasPrefix(t.action, "Corporate Action"):
+		quantity := parseAmount(t.shares)
+		if quantity != 0 {
+			transfer := "<TRANSFER>" + invtran("") + secID + ofxTag("SUBACCTSEC", "CASH") +
+				ofxTag("UNITS", plainNumber(quantity)) + ofxTag("TFERACTION", choose(quantity > 0, "IN", "OUT")) +
+				ofxTag("POSTYPE", "LONG")
+			if t.costBasisTotal != "" {
+				transfer += ofxTag("AVGCOSTBASIS", plainNumber(math.Abs(parseAmount(t.costBasisTotal)/quantity)))
+			}
+			if t.price != "" {
+				transfer += ofxTag("UNITPRICE", plainNumber(parseAmount(t.price)))
+			}
+			if t.acquiredDate != "" {
+				transfer += ofxTag("DTPURCHASE", ofxDate(t.acquiredDate))
+			}
+			transactions = append(transactions, transfer+"</TRANSFER>")
+		}
+		// cash received in a merger
+		if proceeds := parseAmount(t.proceeds); proceeds != 0 {
+			transactions = append(transactions, bank("cash", choose(proceeds > 0, "CREDIT", "DEBIT"), proceeds, currency))
+		}
+
+	case t.action == "Dividend":
+		dividend := parseAmount(t.dividend)
+		switch {
+		case t.dividendType == "Return of Capital":
+			transactions = append(transactions, "<RETOFCAP>"+invtran("")+secID+ofxTag("TOTAL", plainNumber(dividend))+
+				cashAccounts+currency+"</RETOFCAP>")
+		case t.dividendType == "Payment in Lieu Charged":
+			transactions = append(transactions, expense("", dividend))
+		case dividend != 0:
+			transactions = append(transactions, "<INCOME>"+invtran("")+secID+ofxTag("INCOMETYPE", "DIV")+
+				ofxTag("TOTAL", plainNumber(dividend))+cashAccounts+currency+"</INCOME>")
+		}
+		if fee := parseAmount(t.fee); fee != 0 {
+			transactions = append(transactions, expense("tax", fee))
+		}
+
+	case t.action == "Fee" || t.action == "Withholding Tax":
+		transactions = append(transactions, expense("", parseAmount(t.fee)))
+
+	case t.action == "Interest":
+		interest := parseAmount(t.dividend)
+		transactions = append(transactions, bank("", choose(interest > 0, "INT", "DEBIT"), interest, currency))
+	}
+	return transactions
+}
+
+// ofxSecurity writes the security's information for the security list.
+func ofxSecurity(security instrument) string {
+	info := "<SECINFO>" + ofxSecID(security) + ofxTag("SECNAME", firstChars(security.description, 120)) +
+		ofxTag("TICKER", firstChars(security.symbol, 32)) + "</SECINFO>"
+	switch {
+	case security.isOption():
+		optionType := choose(security.putCall == "P", "PUT", "CALL")
+		return "<OPTINFO>" + info + ofxTag("OPTTYPE", optionType) + ofxTag("STRIKEPRICE", security.strike) +
+			ofxTag("DTEXPIRE", ofxDate(security.expiry)) + ofxTag("SHPERCTRCT", multiplierOr(security.multiplier, "100")) +
+			"</OPTINFO>"
+	case strings.Contains(security.assetCategory, "Bond"):
+		return "<DEBTINFO>" + info + ofxTag("PARVALUE", "1000") + ofxTag("DEBTTYPE", "COUPON") + "</DEBTINFO>"
+	case strings.Contains(security.assetCategory, "Mutual Fund"):
+		return "<MFINFO>" + info + "</MFINFO>"
+	case strings.Contains(security.assetCategory, "Future"):
+		return "<OTHERINFO>" + info + ofxTag("TYPEDESC", "Future") + "</OTHERINFO>"
+	}
+	return "<STOCKINFO>" + info + "</STOCKINFO>"
+}
+
+// ofxSecID identifies the security by CUSIP for US and Canadian securities (from the ISIN), then by ISIN, IBKR
+// contract ID or ticker. Blank for transactions without a security e.g. market data fees.
+func ofxSecID(security instrument) string {
+	if security.symbol == "" {
+		return ""
+	}
+	id, idType := security.symbol, "TICKER"
+	switch {
+	case len(security.securityID) == 12 && (strings.HasPrefix(security.securityID, "US") || strings.HasPrefix(security.securityID, "CA")):
+		id, idType = security.securityID[2:11], "CUSIP"
+	case security.securityID != "":
+		id, idType = security.securityID, "ISIN"
+	case security.conid != "":
+		id, idType = security.conid, "CONID"
+	}
+	return "<SECID>" + ofxTag("UNIQUEID", id) + ofxTag("UNIQUEIDTYPE", idType) + "</SECID>"
+}
+
+// ofxCurrency is the currency of the amounts when it's not the account's base currency, with the exchange rate from
+// the currency to the base currency.
+func ofxCurrency(rate string, currency string) string {
+	return "<CURRENCY>" + ofxTag("CURRATE", rate) + ofxTag("CURSYM", currency) + "</CURRENCY>"
+}
+
+func (j *Journal) ofxForexCurrency(date string, currency string, baseCurrency string) string {
+	if currency == baseCurrency {
+		return ""
+	}
+	rate := j.fxRate(date, currency)
+	if rate == "" {
+		return ""
+	}
+	return ofxCurrency(rate, currency)
+}
+
+func ofxTag(name string, value string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(value))
+	return "<" + name + ">" + escaped.String() + "</" + name + ">"
+}
+
+// ofxDate converts 2006-01-02 to 20060102.
+func ofxDate(date string) string {
+	return strings.ReplaceAll(date, "-", "")
+}
+
+// fitID is a unique ID of the transaction that stays the same when the statement is exported again, so finance
+// software skips transactions it already imported. Identical transactions get a sequence number.
+func fitID(t Transaction, suffix string, used map[string]bool) string {
+	key := strings.Join([]string{t.accountID, t.date, t.action, t.ticker, t.optionContract, t.orderID, t.shares,
+		t.optionContracts, t.proceeds, t.dividend, t.fee, t.forexBuyAmount, t.notes, suffix}, "|")
+	hash := sha1.Sum([]byte(key))
+	id := hex.EncodeToString(hash[:])[:20]
+	unique := id
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", id, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// transactionAccounts returns the account IDs of the transactions, sorted.
+func transactionAccounts(txs []Transaction) []string {
+	var accounts []string
+	for _, tx := range txs {
+		if !contains(accounts, tx.accountID) {
+			accounts = append(accounts, tx.accountID)
+		}
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// sortTransactions sorts the transactions by date, order, account and ticker.
+func sortTransactions(txs []Transaction) {
+	sort.SliceStable(txs, func(a, b int) bool {
+		switch {
+		case txs[a].date != txs[b].date:
+			return txs[a].date < txs[b].date
+		case txs[a].orderID != txs[b].orderID:
+			return txs[a].orderID < txs[b].orderID
+		case txs[a].accountID != txs[b].accountID:
+			return txs[a].accountID < txs[b].accountID
+		}
+		return txs[a].ticker < txs[b].ticker
+	})
+}
+
+func multiplierOr(multiplier string, defaultMultiplier string) string {
+	if multiplier == "" {
+		return defaultMultiplier
+	}
+	return multiplier
+}
+
+func choose(condition bool, yes string, no string) string {
+	if condition {
+		return yes
+	}
+	return no
+}
+
+func firstChars(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return text
+}
@@ -0,0 +1,127 @@
+package parse
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToOfx(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/1-dmc.csv")
+	path := filepath.Join(t.TempDir(), "transactions.ofx")
+	journal.ToOfx(transactions, path)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var ofx struct {
+		Statements []struct {
+			Currency string `xml:"INVSTMTRS>CURDEF"`
+			Account  string `xml:"INVSTMTRS>INVACCTFROM>ACCTID"`
+			Start    string `xml:"INVSTMTRS>INVTRANLIST>DTSTART"`
+			Buys     []struct {
+				Units string `xml:"INVBUY>UNITS"`
+				Total string `xml:"INVBUY>TOTAL"`
+			} `xml:"INVSTMTRS>INVTRANLIST>BUYSTOCK"`
+			OptionSells []struct {
+				Units string `xml:"INVSELL>UNITS"`
+				Type  string `xml:"OPTSELLTYPE"`
+			} `xml:"INVSTMTRS>INVTRANLIST>SELLOPT"`
+			OptionBuys []struct {
+				Type string `xml:"OPTBUYTYPE"`
+			} `xml:"INVSTMTRS>INVTRANLIST>BUYOPT"`
+		} `xml:"INVSTMTMSGSRSV1>INVSTMTTRNRS"`
+		Stocks []struct {
+			ID     string `xml:"SECINFO>SECID>UNIQUEID"`
+			IDType string `xml:"SECINFO>SECID>UNIQUEIDTYPE"`
+			Name   string `xml:"SECINFO>SECNAME"`
+		} `xml:"SECLISTMSGSRSV1>SECLIST>STOCKINFO"`
+		Options []struct {
+			Ticker string `xml:"SECINFO>TICKER"`
+			Type   string `xml:"OPTTYPE"`
+			Strike string `xml:"STRIKEPRICE"`
+			Expiry string `xml:"DTEXPIRE"`
+		} `xml:"SECLISTMSGSRSV1>SECLIST>OPTINFO"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &ofx))
+
+	require.Len(t, ofx.Statements, 1)
+	statement := ofx.Statements[0]
+	require.Equal(t, "USD", statement.Currency)
+	require.Equal(t, "U1237792", statement.Account)
+	require.Equal(t, "20221125", statement.Start)
+	require.Len(t, statement.Buys, 1)
+	require.Equal(t, "600", statement.Buys[0].Units)
+	require.Equal(t, "-6356", statement.Buys[0].Total)
+	require.Len(t, statement.OptionSells, 1)
+	require.Equal(t, "-6", statement.OptionSells[0].Units)
+	require.Equal(t, "SELLTOOPEN", statement.OptionSells[0].Type)
+	require.Len(t, statement.OptionBuys, 1)
+	require.Equal(t, "BUYTOOPEN", statement.OptionBuys[0].Type)
+
+	// CUSIP from the ISIN US71424F1057
+	require.Len(t, ofx.Stocks, 1)
+	require.Equal(t, "71424F105", ofx.Stocks[0].ID)
+	require.Equal(t, "CUSIP", ofx.Stocks[0].IDType)
+	require.Equal(t, "PERMIAN RESOURCES CORP", ofx.Stocks[0].Name)
+	require.Len(t, ofx.Options, 2)
+	require.Equal(t, "PR 20JAN23 5 P", ofx.Options[0].Ticker)
+	require.Equal(t, "PUT", ofx.Options[0].Type)
+	require.Equal(t, "5", ofx.Options[0].Strike)
+	require.Equal(t, "20230120", ofx.Options[0].Expiry)
+	require.Equal(t, "CALL", ofx.Options[1].Type)
+}
+
+func TestOfxFitIDs(t *testing.T) {
+	files, err := filepath.Glob("../testdata/input/*.csv")
+	require.NoError(t, err)
+
+	for _, file := range files {
+		journal := NewJournal()
+		transactions := journal.ReadTransactions(file)
+		path := filepath.Join(t.TempDir(), "transactions.ofx")
+		journal.ToOfx(transactions, path)
+		first, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		// valid XML with unique IDs that don't change when exported again
+		decoder := xml.NewDecoder(strings.NewReader(string(first)))
+		fitIDs := make(map[string]bool)
+		inFitID := false
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				require.Equal(t, "EOF", err.Error(), file)
+				break
+			}
+			switch token := token.(type) {
+			case xml.StartElement:
+				inFitID = token.Name.Local == "FITID"
+			case xml.CharData:
+				if inFitID {
+					require.False(t, fitIDs[string(token)], "%s %s", file, token)
+					fitIDs[string(token)] = true
+				}
+			case xml.EndElement:
+				inFitID = false
+			}
+		}
+
+		journal.ToOfx(transactions, path)
+		second, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, string(first), string(second), file)
+	}
+}
+
+func TestOfxSecID(t *testing.T) {
+	require.Equal(t, "", ofxSecID(instrument{}))
+	require.Contains(t, ofxSecID(instrument{symbol: "TECK", securityID: "CA8787422044"}), "<UNIQUEID>878742204</UNIQUEID><UNIQUEIDTYPE>CUSIP</UNIQUEIDTYPE>")
+	require.Contains(t, ofxSecID(instrument{symbol: "STNG", securityID: "MHY7542C1306"}), "<UNIQUEID>MHY7542C1306</UNIQUEID><UNIQUEIDTYPE>ISIN</UNIQUEIDTYPE>")
+	require.Contains(t, ofxSecID(instrument{symbol: "TECK 21JUL23 38 C", conid: "625408463"}), "<UNIQUEID>625408463</UNIQUEID><UNIQUEIDTYPE>CONID</UNIQUEIDTYPE>")
+	require.Contains(t, ofxSecID(instrument{symbol: "VFIAX"}), "<UNIQUEID>VFIAX</UNIQUEID><UNIQUEIDTYPE>TICKER</UNIQUEIDTYPE>")
+}
@@ -0,0 +1,210 @@
+package parse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// orderID builds the ID shared by all legs of a single order.
+// IBKR reports every leg of a combo order (e.g. stock, short call, long put) with the same timestamp, so legs
+// for the same account and underlying at the same time are treated as one order.
+// e.g. TFSA, PR, "2022-11-25, 11:18:50" will return TFSA-PR-20221125111850
+func orderID(account string, underlying string, dateTime string) string {
+	timestamp := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, dateTime)
+	return fmt.Sprintf("%s-%s-%s", account, underlying, timestamp)
+}
+
+// orderTime is the time of the order from its ID, e.g. TFSA-PR-20221125111850 will return 2022-11-25 11:18:50.
+func orderTime(orderID string) time.Time {
+	t, _ := time.Parse("20060102150405", orderID[strings.LastIndex(orderID, "-")+1:])
+	return t
+}
+
+// hasCode checks if the IBKR trade codes (e.g. "C;CP;P") contain the code.
+func hasCode(codes string, code string) bool {
+	for _, c := range strings.Split(codes, ";") {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// groupOrders finds trades with more than one leg in the same order, recognizes the strategy and calculates the
+// net debit / credit of the whole order.
+func (j *Journal) groupOrders() {
+	orders := make(map[string][]*Transaction)
+	for ticker := range j.trades {
+		for i := range j.trades[ticker] {
+			transaction := &j.trades[ticker][i]
+			if transaction.orderID == "" || (transaction.shares == "" && transaction.optionContracts == "") {
+				continue
+			}
+			orders[transaction.orderID] = append(orders[transaction.orderID], transaction)
+		}
+	}
+
+	for _, legs := range orders {
+		if len(legs) < 2 {
+			continue
+		}
+
+		strategy := orderStrategy(legs)
+
+		netDebitCredit := 0.0
+		for _, leg := range legs {
+			proceeds, err := strconv.ParseFloat(leg.proceeds, 64)
+			if err != nil {
+				panic(err)
+			}
+			commission, err := strconv.ParseFloat(leg.commission, 64)
+			if err != nil {
+				panic(err)
+			}
+			netDebitCredit += proceeds + commission
+		}
+
+		for _, leg := range legs {
+			leg.strategy = strategy
+			leg.netDebitCredit = fmt.Sprintf("%.2f", netDebitCredit)
+		}
+	}
+}
+
+// orderStrategy recognizes the strategy of a multi-leg order.
+// When all legs are closing trades, the strategy is recognized from the position being closed (e.g. selling stock
+// and buying back the call closes a covered call).
+func orderStrategy(legs []*Transaction) string {
+	opening, closing := 0, 0
+	for _, leg := range legs {
+		if hasCode(leg.codes, "C") {
+			closing++
+		} else {
+			opening++
+		}
+	}
+
+	// direction of the position each leg is part of: 1 for long, -1 for short
+	direction := func(leg *Transaction) int {
+		quantity := leg.shares
+		if leg.optionContracts != "" {
+			quantity = leg.optionContracts
+		}
+		d := 1
+		if strings.HasPrefix(quantity, "-") {
+			d = -1
+		}
+		if opening == 0 {
+			// closing trades are in the opposite direction of the position
+			d *= -1
+		}
+		return d
+	}
+
+	var stocks, calls, puts []*Transaction
+	for _, leg := range legs {
+		if leg.optionContracts == "" {
+			stocks = append(stocks, leg)
+			continue
+		}
+		// e.g. 20JAN23 9 C will extract C
+		switch leg.optionContract[len(leg.optionContract)-1:] {
+		case "C":
+			calls = append(calls, leg)
+		case "P":
+			puts = append(puts, leg)
+		}
+	}
+
+	strategy := "combo"
+	switch {
+	case len(stocks) == 0 && len(legs) == 2 && opening == 1 && closing == 1 && (len(calls) == 2 || len(puts) == 2):
+		// closing one option and opening another of the same type at the same time
+		return "roll"
+
+	case len(stocks) == 1 && direction(stocks[0]) == 1:
+		shortCall := len(calls) == 1 && direction(calls[0]) == -1
+		longPut := len(puts) == 1 && direction(puts[0]) == 1
+		if shortCall && longPut {
+			strategy = "collar"
+		} else if shortCall && len(puts) == 0 {
+			strategy = "covered call"
+		} else if longPut && len(calls) == 0 {
+			strategy = "married put"
+		}
+
+	case len(stocks) == 0 && len(legs) == 2 && (len(calls) == 2 || len(puts) == 2):
+		// e.g. 21JUL23 44 C and 21JUL23 46 C
+		first := strings.Split(legs[0].optionContract, " ")
+		second := strings.Split(legs[1].optionContract, " ")
+		if first[0] == second[0] && first[1] != second[1] && direction(legs[0]) != direction(legs[1]) {
+			strategy = "vertical"
+		}
+	}
+
+	if strategy != "combo" && opening == 0 {
+		strategy += " - close"
+	}
+	return strategy
+}
+
+// findAssignedStockTrade finds the stock trade that resulted from an option assignment or exercise.
+// The stock trade is for the same account and date, at the strike price and for 100 shares per contract.
+// When there are several stock trades that match, the earliest one that hasn't been matched yet is returned.
+func (j *Journal) findAssignedStockTrade(option Transaction, strike string) *Transaction {
+	contracts := parseAmount(option.optionContracts)
+
+	// closing a short call (buy) or a long call (sell) delivers stock in the opposite direction of the option trade
+	// e.g. short call assignment: +1 contract will sell 100 shares, long put exercise: -1 contract will sell 100 shares
+	shares := -100 * contracts
+	if strings.HasSuffix(option.optionContract, "P") {
+		shares = 100 * contracts
+	}
+
+	for i := range j.trades[option.ticker] {
+		transaction := &j.trades[option.ticker][i]
+		if transaction.action == "Trade" &&
+			transaction.account == option.account &&
+			transaction.date == option.date &&
+			parseAmount(transaction.price) == parseAmount(strike) &&
+			parseAmount(transaction.shares) == shares {
+			return transaction
+		}
+	}
+	return nil
+}
+
+// findClosedStockTrade finds the stock sale that was closed together with buying back a short call
+// (e.g. covered call that hit the GTC target).
+// A stock sale in the same order is preferred, otherwise the earliest stock sale for the same account, date and
+// number of shares is returned.
+func (j *Journal) findClosedStockTrade(option Transaction) *Transaction {
+	shares := -100 * parseAmount(option.optionContracts)
+
+	var matchedTransaction *Transaction
+	for i := range j.trades[option.ticker] {
+		transaction := &j.trades[option.ticker][i]
+		if transaction.action != "Trade" ||
+			transaction.account != option.account ||
+			transaction.date != option.date ||
+			parseAmount(transaction.shares) != shares ||
+			hasCode(transaction.codes, "O") {
+			continue
+		}
+		if transaction.orderID == option.orderID {
+			return transaction
+		}
+		if matchedTransaction == nil {
+			matchedTransaction = transaction
+		}
+	}
+	return matchedTransaction
+}
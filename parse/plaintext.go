@@ -0,0 +1,778 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PlainTextAccounts are the plain-text accounting account names the postings of an IBKR account are booked to.
+type PlainTextAccounts struct {
+	Cash           string `json:"cash"`           // e.g. Assets:IBKR:TFSA:Cash
+	Positions      string `json:"positions"`      // stocks, options, bonds and funds held at cost
+	Commissions    string `json:"commissions"`    // e.g. Expenses:IBKR:TFSA:Commissions
+	Fees           string `json:"fees"`           // e.g. market data, borrow fees
+	Dividends      string `json:"dividends"`      // e.g. Income:IBKR:TFSA:Dividends
+	Interest       string `json:"interest"`       // bond accrued interest
+	WithholdingTax string `json:"withholdingTax"` // e.g. Expenses:Taxes:TFSA:Withholding
+	Gains          string `json:"gains"`          // realized P/L
+	Equity         string `json:"equity"`         // other side of transfers and corporate actions
+}
+
+// PlainTextConfig has the account names of each IBKR account by alias (e.g. TFSA) or account ID.
+// e.g.
+//
+//	{
+//	  "accounts": {
+//	    "TFSA": {"cash": "Assets:Investments:TFSA:Cash", "positions": "Assets:Investments:TFSA"}
+//	  }
+//	}
+//
+// Account names that aren't configured default to Assets:IBKR:<alias>:Cash, Expenses:IBKR:<alias>:Commissions etc.
+type PlainTextConfig struct {
+	Accounts map[string]PlainTextAccounts `json:"accounts"`
+}
+
+// LoadPlainTextConfig reads the plain-text accounting account names from a JSON file.
+func LoadPlainTextConfig(path string) PlainTextConfig {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var config PlainTextConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		log.Fatal(fmt.Sprintf("invalid accounts %s: %v", path, err))
+	}
+	return config
+}
+
+// accounts returns the configured account names of the IBKR account with defaults for the ones not configured.
+func (c PlainTextConfig) accounts(transaction Transaction) PlainTextAccounts {
+	alias := accountComponent(transaction.account)
+	accounts := PlainTextAccounts{
+		Cash:           "Assets:IBKR:" + alias + ":Cash",
+		Positions:      "Assets:IBKR:" + alias + ":Positions",
+		Commissions:    "Expenses:IBKR:" + alias + ":Commissions",
+		Fees:           "Expenses:IBKR:" + alias + ":Fees",
+		Dividends:      "Income:IBKR:" + alias + ":Dividends",
+		Interest:       "Income:IBKR:" + alias + ":Interest",
+		WithholdingTax: "Expenses:IBKR:" + alias + ":WithholdingTax",
+		Gains:          "Income:IBKR:" + alias + ":Gains",
+		Equity:         "Equity:IBKR:" + alias + ":Transfers",
+	}
+	configured, ok := c.Accounts[transaction.account]
+	if !ok {
+		configured = c.Accounts[transaction.accountID]
+	}
+	set := func(account *string, name string) {
+		if name != "" {
+			*account = name
+		}
+	}
+	set(&accounts.Cash, configured.Cash)
+	set(&accounts.Positions, configured.Positions)
+	set(&accounts.Commissions, configured.Commissions)
+	set(&accounts.Fees, configured.Fees)
+	set(&accounts.Dividends, configured.Dividends)
+	set(&accounts.Interest, configured.Interest)
+	set(&accounts.WithholdingTax, configured.WithholdingTax)
+	set(&accounts.Gains, configured.Gains)
+	set(&accounts.Equity, configured.Equity)
+	return accounts
+}
+
+// plainTextEntry is a transaction with its postings, written as Beancount or Ledger.
+type plainTextEntry struct {
+	date      string
+	narration string
+	orderID   string
+	postings  []posting
+}
+
+// posting moves an amount of a commodity (e.g. 100 TECK, -4608 USD) in or out of an account.
+// A posting without an amount is balanced by the others.
+type posting struct {
+	account   string
+	amount    float64
+	commodity string
+	noAmount  bool
+	symbol    string // traded symbol of positions e.g. TECK 21JUL23 38 C
+	gain      bool   // balances the gain or loss of reduced lots
+	premium   bool   // option closed by an assignment / exercise, its cost is rolled into the stock
+
+	// lots held at cost e.g. {46.07 USD, 2023-06-05}, reduced lots take the cost of the lots they close
+	cost         float64
+	costCurrency string
+	costDate     string
+	reduce       bool // closing position without lots to close, booked at its price
+
+	// conversion price e.g. @ 50.00 USD, or total price with @@
+	price         float64
+	priceCurrency string
+	totalPrice    bool
+}
+
+func (p posting) hasCost() bool {
+	return p.costCurrency != ""
+}
+
+// plainTextEntries converts the transactions to entries in the order they're applied to the lots.
+func plainTextEntries(txs []Transaction, config PlainTextConfig) []plainTextEntry {
+	books := newPlainTextBooks(config)
+	order := ledgerOrder(txs)
+
+	var entries []plainTextEntry
+	for i := 0; i < len(order); {
+		// legs of a merger are applied to the lots together
+		group := []Transaction{txs[order[i]]}
+		for i++; i < len(order) && sameMerger(group[0], txs[order[i]]); i++ {
+			group = append(group, txs[order[i]])
+		}
+		entries = append(entries, books.expire(group[0].date)...)
+		entries = append(entries, books.book(group)...)
+	}
+	return entries
+}
+
+// plainTextBooks books the positions of the entries with the lots of a Ledger, so lots are reduced first in first
+// out and follow splits, symbol changes and the other corporate actions the same way as the cost basis.
+// The lots are kept at the price they were traded at, commissions are booked to the commissions account.
+type plainTextBooks struct {
+	ledger     *Ledger
+	config     PlainTextConfig
+	accounts   map[string]PlainTextAccounts // by account ID, for the entries of expired lots
+	currencies map[string]string            // currency of the open lots by account ID and symbol
+}
+
+func newPlainTextBooks(config PlainTextConfig) *plainTextBooks {
+	return &plainTextBooks{
+		ledger:     NewLedger(),
+		config:     config,
+		accounts:   make(map[string]PlainTextAccounts),
+		currencies: make(map[string]string),
+	}
+}
+
+// lotSnapshot is an open lot with its values before transactions were applied.
+type lotSnapshot struct {
+	lot      *Lot
+	previous Lot
+}
+
+// lotChange is a lot (or part of a lot) opened or reduced by a transaction.
+type lotChange struct {
+	account  string // account ID
+	symbol   string
+	quantity float64 // reductions have the opposite sign of the lot
+	cost     float64 // per share / contract
+	date     string
+	reduce   bool
+}
+
+func lotKey(account string, symbol string) string {
+	return account + " " + symbol
+}
+
+// unitCost is the cost of the lot per share / contract.
+func unitCost(lot Lot) float64 {
+	if lot.quantity == 0 {
+		return 0
+	}
+	return lot.costBasis / lot.quantity
+}
+
+// book applies the transactions to the lots and books the lots they opened and reduced as the positions of their
+// entries. The gain or loss of the reduced lots is booked with an explicit amount so it doesn't depend on the
+// Beancount / Ledger booking.
+// Reductions of lots opened before the transactions (e.g. exported from a later date) are booked at the price they
+// were closed at with no gain for that part, the options of assignments and exercises without lots are left out.
+func (b *plainTextBooks) book(group []Transaction) []plainTextEntry {
+	entries := make([]plainTextEntry, len(group))
+	ok := make([]bool, len(group))
+	var applied []Transaction
+	before := make(map[string][]lotSnapshot)
+	for i, t := range group {
+		b.accounts[t.accountID] = b.config.accounts(t)
+		entries[i], ok[i] = plainTextEntryOf(t, b.accounts[t.accountID])
+		if t.action == "Trade - Future" {
+			// futures have no position, only the mark-to-market P/L is booked
+			continue
+		}
+		t.commission = ""
+		applied = append(applied, t)
+		if _, ok := before[t.accountID]; !ok {
+			before[t.accountID] = []lotSnapshot{}
+			for _, lot := range b.accountLots(t.accountID) {
+				before[t.accountID] = append(before[t.accountID], lotSnapshot{lot, *lot})
+			}
+		}
+	}
+	b.ledger.Apply(applied)
+
+	changes := make([][]lotChange, len(group))
+	for account, lots := range before {
+		for _, change := range b.lotChanges(account, lots) {
+			i := changedEntry(group, entries, change)
+			changes[i] = append(changes[i], change)
+		}
+	}
+
+	var booked []plainTextEntry
+	for i := range group {
+		if !ok[i] {
+			continue
+		}
+		b.post(&entries[i], group[i], changes[i])
+		if len(entries[i].postings) > 0 {
+			booked = append(booked, entries[i])
+		}
+	}
+	return booked
+}
+
+// accountLots returns the open lots of the account by symbol, oldest first.
+func (b *plainTextBooks) accountLots(account string) []*Lot {
+	var symbols []string
+	for symbol := range b.ledger.lots[account] {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	var lots []*Lot
+	for _, symbol := range symbols {
+		lots = append(lots, b.ledger.lots[account][symbol]...)
+	}
+	return lots
+}
+
+// lotChanges compares the open lots of the account with the lots before the transactions were applied.
+// Lots whose symbol or cost per share changed (e.g. symbol change, split, spin-off) are reduced and opened again.
+func (b *plainTextBooks) lotChanges(account string, before []lotSnapshot) []lotChange {
+	after := b.accountLots(account)
+	open := make(map[*Lot]bool)
+	for _, lot := range after {
+		open[lot] = true
+	}
+	existing := make(map[*Lot]bool)
+	for _, snapshot := range before {
+		existing[snapshot.lot] = true
+	}
+
+	var reduced, opened []lotChange
+	reduce := func(lot Lot, quantity float64) {
+		if math.Abs(quantity) > 1e-9 {
+			reduced = append(reduced, lotChange{account, lot.symbol, quantity, unitCost(lot), lot.date, true})
+		}
+	}
+	for _, snapshot := range before {
+		previous, current := snapshot.previous, *snapshot.lot
+		switch {
+		case !open[snapshot.lot]:
+			reduce(previous, -previous.quantity)
+		case current.symbol == previous.symbol && math.Abs(unitCost(current)-unitCost(previous)) < 1e-9:
+			reduce(previous, current.quantity-previous.quantity)
+		default:
+			reduce(previous, -previous.quantity)
+			opened = append(opened, lotChange{account, current.symbol, current.quantity, unitCost(current), current.date, false})
+		}
+	}
+	for _, lot := range after {
+		if !existing[lot] {
+			opened = append(opened, lotChange{account, lot.symbol, lot.quantity, unitCost(*lot), lot.date, false})
+		}
+	}
+	return append(reduced, opened...)
+}
+
+// changedEntry returns the index of the transaction the lot change is booked with: the one with a position in the
+// symbol, or the first one of the account e.g. the parent lots of a spin-off.
+func changedEntry(group []Transaction, entries []plainTextEntry, change lotChange) int {
+	first := -1
+	for i, t := range group {
+		if t.accountID != change.account {
+			continue
+		}
+		for _, p := range entries[i].postings {
+			if p.symbol == change.symbol {
+				return i
+			}
+		}
+		if first == -1 {
+			first = i
+		}
+	}
+	return first
+}
+
+// post replaces the positions of the entry with the lots the transaction changed and books the gain or loss.
+func (b *plainTextBooks) post(entry *plainTextEntry, t Transaction, changes []lotChange) {
+	templates := make(map[string]posting)
+	rank := make(map[string]int)
+	for _, p := range entry.postings {
+		if _, ok := templates[p.symbol]; p.symbol != "" && !ok {
+			templates[p.symbol] = p
+			rank[p.symbol] = len(rank)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return symbolRank(rank, changes[i].symbol) < symbolRank(rank, changes[j].symbol)
+	})
+
+	var positions []posting
+	for _, change := range changes {
+		p, ok := templates[change.symbol]
+		if !ok {
+			p = posting{
+				account:      b.accounts[change.account].Positions,
+				commodity:    commodity(change.symbol),
+				symbol:       change.symbol,
+				costCurrency: t.currency,
+			}
+		}
+		p.amount = change.quantity
+		switch {
+		case change.reduce:
+			p.cost, p.costDate, p.reduce = change.cost, change.date, false
+		case p.reduce:
+			// closing trade without lots to close, the lot opened in the other direction is taken out again
+			b.ledger.take(change.account, change.symbol, math.Abs(change.quantity))
+		default:
+			p.cost, p.costDate = change.cost, change.date
+			p.price, p.priceCurrency = 0, ""
+			b.currencies[lotKey(change.account, change.symbol)] = p.costCurrency
+		}
+		positions = append(positions, p)
+	}
+
+	var postings []posting
+	for _, p := range entry.postings {
+		if p.symbol == "" {
+			postings = append(postings, p)
+			continue
+		}
+		if positions != nil {
+			postings = append(postings, positions...)
+			positions = nil
+		}
+	}
+	postings = append(positions, postings...)
+
+	entry.postings = nil
+	for _, p := range postings {
+		switch {
+		case p.gain:
+			p.amount, p.noAmount = -entryWeight(postings, p.commodity), false
+			if math.Abs(p.amount) < 5e-9 {
+				continue
+			}
+		case p.noAmount && isBalanced(postings):
+			// nothing left to balance e.g. the lots of a split
+			continue
+		}
+		entry.postings = append(entry.postings, p)
+	}
+}
+
+func symbolRank(rank map[string]int, symbol string) int {
+	if r, ok := rank[symbol]; ok {
+		return r
+	}
+	return len(rank)
+}
+
+// isBalanced checks whether the postings with amounts weigh nothing in every currency.
+func isBalanced(postings []posting) bool {
+	for _, p := range postings {
+		for _, currency := range []string{p.commodity, p.costCurrency, p.priceCurrency} {
+			if currency != "" && math.Abs(entryWeight(postings, currency)) > 5e-9 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// expire closes the option lots that expired before the date without a closing trade (e.g. lapsed out of the money),
+// booking their cost as the gain or loss.
+func (b *plainTextBooks) expire(date string) []plainTextEntry {
+	closed := len(b.ledger.closed)
+	b.ledger.Expire(date)
+
+	var entries []plainTextEntry
+	for _, lot := range b.ledger.closed[closed:] {
+		accounts, currency := b.accounts[lot.account], b.currencies[lotKey(lot.account, lot.symbol)]
+		entries = append(entries, plainTextEntry{
+			date:      lot.closeDate,
+			narration: "Expired " + lot.symbol,
+			postings: []posting{
+				{
+					account:      accounts.Positions,
+					amount:       -lot.quantity,
+					commodity:    commodity(lot.symbol),
+					symbol:       lot.symbol,
+					cost:         unitCost(lot),
+					costCurrency: currency,
+					costDate:     lot.date,
+				},
+				{account: accounts.Gains, amount: lot.costBasis, commodity: currency},
+			},
+		})
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		if entries[a].date != entries[b].date {
+			return entries[a].date < entries[b].date
+		}
+		return entries[a].narration < entries[b].narration
+	})
+	return entries
+}
+
+// entryWeight sums the amounts the postings weigh in the currency: lots held at cost weigh their cost, conversions
+// their price.
+func entryWeight(postings []posting, currency string) float64 {
+	weight := 0.0
+	for _, p := range postings {
+		switch {
+		case p.noAmount || p.gain:
+		case p.hasCost() && !p.reduce:
+			if p.costCurrency == currency {
+				weight += p.amount * p.cost
+			}
+		case p.totalPrice:
+			if p.priceCurrency == currency {
+				weight += math.Copysign(p.price, p.amount)
+			}
+		case p.priceCurrency != "":
+			if p.priceCurrency == currency {
+				weight += p.amount * p.price
+			}
+		case p.commodity == currency:
+			weight += p.amount
+		}
+	}
+	return weight
+}
+
+func plainTextEntryOf(t Transaction, accounts PlainTextAccounts) (plainTextEntry, bool) {
+	entry := plainTextEntry{
+		date:      t.date,
+		narration: narration(t),
+		orderID:   t.orderID,
+	}
+	cash := func(amount float64, currency string) {
+		if amount != 0 {
+			entry.postings = append(entry.postings, posting{account: accounts.Cash, amount: amount, commodity: currency})
+		}
+	}
+	other := func(account string, amount float64, currency string) {
+		if amount != 0 {
+			entry.postings = append(entry.postings, posting{account: account, amount: amount, commodity: currency})
+		}
+	}
+	commission := parseAmount(t.commission)
+
+	switch {
+	case t.action == "Forex":
+		bought, sold := parseAmount(t.forexBuyAmount), parseAmount(t.forexSellAmount)
+		entry.postings = append(entry.postings,
+			posting{
+				account:       accounts.Cash,
+				amount:        bought,
+				commodity:     t.forexBuyCurrency,
+				price:         math.Abs(sold),
+				priceCurrency: t.forexSellCurrency,
+				totalPrice:    true,
+			},
+			posting{account: accounts.Cash, amount: sold, commodity: t.forexSellCurrency},
+		)
+		commissionCurrency := t.currency
+		if t.commissionCurrency != "" {
+			commissionCurrency = t.commissionCurrency
+		}
+		other(accounts.Commissions, -commission, commissionCurrency)
+		cash(commission, commissionCurrency)
+
+	case t.action == "Trade - Future":
+		// only the mark-to-market P/L is settled in cash, the contract value isn't exchanged
+		mtm := parseAmount(t.mtmPL)
+		cash(mtm+commission, t.currency)
+		other(accounts.Commissions, -commission, t.currency)
+		other(accounts.Gains, -mtm, t.currency)
+
+	case strings.HasPrefix(t.action, "Trade"):
+		symbol, quantity := tradedSymbol(t)
+		if quantity == 0 {
+			return entry, false
+		}
+		proceeds := parseAmount(t.proceeds)
+		accrued := parseAmount(t.accruedInterest)
+		// the lots opened and closed are booked with the trade, the price is kept for the lots it closes
+		entry.postings = append(entry.postings, posting{
+			account:       accounts.Positions,
+			amount:        quantity,
+			commodity:     commodity(symbol),
+			symbol:        symbol,
+			costCurrency:  t.currency,
+			price:         math.Abs(proceeds / quantity),
+			priceCurrency: t.currency,
+			reduce:        isClosingTrade(t),
+		})
+		if t.shares != "" && t.optionContract != "" {
+			// stock trade from an option assignment / exercise also closes the option: short options are assigned,
+			// long options exercised
+			contracts := math.Abs(quantity) / 100
+			if strings.HasSuffix(t.action, "Exercise") {
+				contracts = -contracts
+			}
+			option := t.ticker + " " + t.optionContract
+			entry.postings = append(entry.postings, posting{
+				account:      accounts.Positions,
+				amount:       contracts,
+				commodity:    commodity(option),
+				symbol:       option,
+				costCurrency: t.currency,
+				reduce:       true,
+				premium:      true,
+			})
+		}
+		cash(proceeds+commission+accrued, t.currency)
+		other(accounts.Commissions, -commission, t.currency)
+		other(accounts.Interest, -accrued, t.currency)
+		entry.postings = append(entry.postings, posting{account: accounts.Gains, commodity: t.currency, noAmount: true, gain: true})
+
+	case t.action == "Transfer" || strings.HasPrefix(t.action, "Corporate Action"):
+		quantity := parseAmount(t.shares)
+		if quantity == 0 {
+			return entry, false
+		}
+		position := posting{
+			account:      accounts.Positions,
+			amount:       quantity,
+			commodity:    commodity(t.ticker),
+			symbol:       t.ticker,
+			costCurrency: t.currency,
+		}
+		entry.postings = append(entry.postings, position)
+		cash(parseAmount(t.proceeds), t.currency)
+		entry.postings = append(entry.postings, posting{account: accounts.Equity, noAmount: true})
+
+	case t.action == "Dividend":
+		dividend, fee := parseAmount(t.dividend), parseAmount(t.fee)
+		cash(dividend+fee, t.currency)
+		other(accounts.Dividends, -dividend, t.currency)
+		other(accounts.WithholdingTax, -fee, t.currency)
+
+	case t.action == "Withholding Tax":
+		fee := parseAmount(t.fee)
+		cash(fee, t.currency)
+		other(accounts.WithholdingTax, -fee, t.currency)
+
+	case t.action == "Fee":
+		fee := parseAmount(t.fee)
+		cash(fee, t.currency)
+		other(accounts.Fees, -fee, t.currency)
+
+	case t.action == "Interest":
+		interest := parseAmount(t.dividend)
+		cash(interest, t.currency)
+		other(accounts.Interest, -interest, t.currency)
+
+	default:
+		return entry, false
+	}
+	return entry, len(entry.postings) > 0
+}
+
+// tradedSymbol returns the stock, option contract etc. traded and the quantity, negative when sold.
+func tradedSymbol(t Transaction) (string, float64) {
+	if t.optionContracts != "" {
+		return t.ticker + " " + t.optionContract, parseAmount(t.optionContracts)
+	}
+	return t.ticker, parseAmount(t.shares)
+}
+
+// isClosingTrade checks the IBKR codes for whether the trade closed a position, e.g. C (closing), Ep (expired).
+func isClosingTrade(t Transaction) bool {
+	switch t.action {
+	case "Trade - Cover":
+		return true
+	case "Trade - Short":
+		return false
+	}
+	codes := strings.Split(t.codes, ";")
+	if contains(codes, "O") {
+		return false
+	}
+	return contains(codes, "C") || contains(codes, "Ep") || contains(codes, "Ex") || contains(codes, "A")
+}
+
+func narration(t Transaction) string {
+	var parts []string
+	for _, part := range []string{t.action, t.ticker, t.optionContract} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if t.notes != "" {
+		parts = append(parts, "-", strings.ReplaceAll(t.notes, "\n", "; "))
+	}
+	return strings.Join(parts, " ")
+}
+
+var (
+	invalidCommodity = regexp.MustCompile(`[^A-Z0-9'._-]+`)
+	invalidAccount   = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+)
+
+// commodity converts a symbol to a Beancount commodity: capital letters, digits and '._- up to 24 characters,
+// e.g. TECK 21JUL23 38 C: TECK-21JUL23-38-C
+func commodity(symbol string) string {
+	name := invalidCommodity.ReplaceAllString(strings.ToUpper(strings.TrimSpace(symbol)), "-")
+	name = strings.Trim(name, "'._-")
+	if name == "" || name[0] < 'A' || name[0] > 'Z' {
+		name = "X" + name
+	}
+	if len(name) > 24 {
+		name = strings.TrimRight(name[:24], "'._-")
+	}
+	return name
+}
+
+// accountComponent converts an account alias to a valid part of an account name e.g. "Joint Margin": Joint-Margin
+func accountComponent(alias string) string {
+	name := strings.Trim(invalidAccount.ReplaceAllString(alias, "-"), "-")
+	if name == "" {
+		return "Unknown"
+	}
+	if first := name[0]; first >= 'a' && first <= 'z' {
+		name = strings.ToUpper(name[:1]) + name[1:]
+	}
+	return name
+}
+
+// plainNumber formats the amount without trailing zeros, rounded to 8 decimals.
+func plainNumber(amount float64) string {
+	rounded := math.Round(amount*1e8) / 1e8
+	if rounded == 0 {
+		rounded = 0 // no -0
+	}
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+func quoted(text string) string {
+	return `"` + strings.ReplaceAll(strings.ReplaceAll(text, `\`, `\\`), `"`, `\"`) + `"`
+}
+
+// ToBeancount writes the transactions as Beancount entries, with open directives for every account used.
+// Lots are reduced first in first out at their cost and the gain or loss is booked to the gains account.
+func (j *Journal) ToBeancount(txs []Transaction, beancountPath string, config PlainTextConfig) {
+	entries := plainTextEntries(txs, config)
+
+	var out strings.Builder
+	out.WriteString("option \"booking_method\" \"FIFO\"\n\n")
+
+	// accounts are opened on the date they're first used
+	opened := make(map[string]string)
+	var accounts []string
+	for _, entry := range entries {
+		for _, p := range entry.postings {
+			if _, ok := opened[p.account]; !ok {
+				opened[p.account] = entry.date
+				accounts = append(accounts, p.account)
+			}
+		}
+	}
+	sort.Strings(accounts)
+	for _, account := range accounts {
+		out.WriteString(fmt.Sprintf("%s open %s\n", opened[account], account))
+	}
+
+	for _, entry := range entries {
+		out.WriteString(fmt.Sprintf("\n%s * %s\n", entry.date, quoted(entry.narration)))
+		if entry.orderID != "" {
+			out.WriteString(fmt.Sprintf("  order_id: %s\n", quoted(entry.orderID)))
+		}
+		for _, p := range entry.postings {
+			out.WriteString("  " + p.account)
+			if !p.noAmount {
+				out.WriteString(fmt.Sprintf("  %s %s", plainNumber(p.amount), p.commodity))
+			}
+			switch {
+			case p.reduce:
+				out.WriteString(" {}")
+			case p.hasCost():
+				out.WriteString(fmt.Sprintf(" {%s %s, %s}", plainNumber(p.cost), p.costCurrency, p.costDate))
+			}
+			out.WriteString(priceAnnotation(p))
+			out.WriteString("\n")
+		}
+	}
+
+	writeText(beancountPath, out.String())
+}
+
+// ToLedger writes the transactions as Ledger / hledger entries.
+// Lots are opened and closed with their cost and date e.g. 100 TECK {46.07 USD} [2023-06-05] and the gain or loss of
+// the lots closed is booked to the gains account.
+func (j *Journal) ToLedger(txs []Transaction, ledgerPath string, config PlainTextConfig) {
+	var out strings.Builder
+	for i, entry := range plainTextEntries(txs, config) {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString(fmt.Sprintf("%s * %s\n", entry.date, entry.narration))
+		if entry.orderID != "" {
+			out.WriteString(fmt.Sprintf("    ; order: %s\n", entry.orderID))
+		}
+		for _, p := range entry.postings {
+			out.WriteString("    " + p.account)
+			if p.noAmount {
+				out.WriteString("\n")
+				continue
+			}
+			c := ledgerCommodity(p.commodity)
+			out.WriteString(fmt.Sprintf("  %s %s", plainNumber(p.amount), c))
+			if p.hasCost() && !p.reduce {
+				// balanced at the lot's cost, the gain or loss is booked separately
+				out.WriteString(fmt.Sprintf(" {%s %s} [%s]", plainNumber(p.cost), p.costCurrency, p.costDate))
+				out.WriteString(fmt.Sprintf(" @ %s %s", plainNumber(p.cost), p.costCurrency))
+			} else {
+				out.WriteString(priceAnnotation(p))
+			}
+			out.WriteString("\n")
+		}
+	}
+
+	writeText(ledgerPath, out.String())
+}
+
+func priceAnnotation(p posting) string {
+	if p.priceCurrency == "" {
+		return ""
+	}
+	if p.totalPrice {
+		return fmt.Sprintf(" @@ %s %s", plainNumber(p.price), p.priceCurrency)
+	}
+	return fmt.Sprintf(" @ %s %s", plainNumber(p.price), p.priceCurrency)
+}
+
+// ledgerCommodity quotes commodities that aren't only letters e.g. "TECK-21JUL23-38-C"
+func ledgerCommodity(commodity string) string {
+	for _, r := range commodity {
+		if r < 'A' || r > 'Z' {
+			return quoted(commodity)
+		}
+	}
+	return commodity
+}
+
+func writeText(path string, text string) {
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
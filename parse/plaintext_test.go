@@ -0,0 +1,242 @@
+package parse
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlainTextEntriesBalance(t *testing.T) {
+	files, err := filepath.Glob("../testdata/input/*.csv")
+	require.NoError(t, err)
+
+	for _, file := range files {
+		journal := NewJournal()
+		transactions := journal.ReadTransactions(file)
+		ledger := NewLedger()
+		ledger.Apply(transactions)
+
+		for _, entry := range plainTextEntries(transactions, PlainTextConfig{}) {
+			require.NotEmpty(t, entry.postings, file)
+			weights := make(map[string]float64)
+			balanced := false
+			for _, p := range entry.postings {
+				switch {
+				case p.noAmount:
+					// balanced by the posting without an amount
+					balanced = true
+				case p.hasCost() && !p.reduce:
+					weights[p.costCurrency] += p.amount * p.cost
+				case p.totalPrice:
+					weights[p.priceCurrency] += math.Copysign(p.price, p.amount)
+				case p.priceCurrency != "":
+					weights[p.priceCurrency] += p.amount * p.price
+				default:
+					weights[p.commodity] += p.amount
+				}
+			}
+			if balanced {
+				continue
+			}
+			for currency, weight := range weights {
+				require.InDelta(t, 0, weight, 1e-6, "%s %s %s", file, entry.narration, currency)
+			}
+		}
+	}
+}
+
+func TestToBeancount(t *testing.T) {
+	transactions := []Transaction{
+		{date: "2023-06-05", account: "TFSA", accountID: "U1234567", action: "Trade", ticker: "TECK", shares: "100", proceeds: "-4607", commission: "-1", currency: "USD", codes: "O", orderID: "TFSA-TECK-20230605111759"},
+		{date: "2023-06-07", account: "TFSA", accountID: "U1234567", action: "Trade - Option", ticker: "TECK", optionContract: "21JUL23 50 C", optionContracts: "-1", proceeds: "150", commission: "-1.05", currency: "USD", codes: "O"},
+		{date: "2023-06-08", account: "TFSA", accountID: "U1234567", action: "Dividend", ticker: "TECK", dividend: "12.5", fee: "-1.88", currency: "USD", notes: "TECK Cash Dividend USD 0.125 per Share\n15% tax withdrawn"},
+		{date: "2023-06-09", account: "TFSA", accountID: "U1234567", action: "Trade", ticker: "TECK", shares: "-100", proceeds: "5000", commission: "-1", currency: "USD", codes: "C"},
+		{date: "2023-06-09", account: "TFSA", accountID: "U1234567", action: "Forex", forexBuyCurrency: "CAD", forexBuyAmount: "1343.3", forexSellCurrency: "USD", forexSellAmount: "-1000", commission: "-2", commissionCurrency: "USD", currency: "CAD"},
+	}
+	config := PlainTextConfig{Accounts: map[string]PlainTextAccounts{
+		"TFSA": {Cash: "Assets:Investments:TFSA:Cash", WithholdingTax: "Expenses:Taxes:Withholding"},
+	}}
+
+	journal := NewJournal()
+	path := filepath.Join(t.TempDir(), "transactions.beancount")
+	journal.ToBeancount(transactions, path, config)
+	beancount, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `option "booking_method" "FIFO"
+
+2023-06-05 open Assets:IBKR:TFSA:Positions
+2023-06-05 open Assets:Investments:TFSA:Cash
+2023-06-05 open Expenses:IBKR:TFSA:Commissions
+2023-06-08 open Expenses:Taxes:Withholding
+2023-06-08 open Income:IBKR:TFSA:Dividends
+2023-06-09 open Income:IBKR:TFSA:Gains
+
+2023-06-05 * "Trade TECK"
+  order_id: "TFSA-TECK-20230605111759"
+  Assets:IBKR:TFSA:Positions  100 TECK {46.07 USD, 2023-06-05}
+  Assets:Investments:TFSA:Cash  -4608 USD
+  Expenses:IBKR:TFSA:Commissions  1 USD
+
+2023-06-07 * "Trade - Option TECK 21JUL23 50 C"
+  Assets:IBKR:TFSA:Positions  -1 TECK-21JUL23-50-C {150 USD, 2023-06-07}
+  Assets:Investments:TFSA:Cash  148.95 USD
+  Expenses:IBKR:TFSA:Commissions  1.05 USD
+
+2023-06-08 * "Dividend TECK - TECK Cash Dividend USD 0.125 per Share; 15% tax withdrawn"
+  Assets:Investments:TFSA:Cash  10.62 USD
+  Income:IBKR:TFSA:Dividends  -12.5 USD
+  Expenses:Taxes:Withholding  1.88 USD
+
+2023-06-09 * "Trade TECK"
+  Assets:IBKR:TFSA:Positions  -100 TECK {46.07 USD, 2023-06-05} @ 50 USD
+  Assets:Investments:TFSA:Cash  4999 USD
+  Expenses:IBKR:TFSA:Commissions  1 USD
+  Income:IBKR:TFSA:Gains  -393 USD
+
+2023-06-09 * "Forex"
+  Assets:Investments:TFSA:Cash  1343.3 CAD @@ 1000 USD
+  Assets:Investments:TFSA:Cash  -1000 USD
+  Expenses:IBKR:TFSA:Commissions  2 USD
+  Assets:Investments:TFSA:Cash  -2 USD
+`, string(beancount))
+
+	path = filepath.Join(t.TempDir(), "transactions.ledger")
+	journal.ToLedger(transactions[:2], path, PlainTextConfig{})
+	ledger, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `2023-06-05 * Trade TECK
+    ; order: TFSA-TECK-20230605111759
+    Assets:IBKR:TFSA:Positions  100 TECK {46.07 USD} [2023-06-05] @ 46.07 USD
+    Assets:IBKR:TFSA:Cash  -4608 USD
+    Expenses:IBKR:TFSA:Commissions  1 USD
+
+2023-06-07 * Trade - Option TECK 21JUL23 50 C
+    Assets:IBKR:TFSA:Positions  -1 "TECK-21JUL23-50-C" {150 USD} [2023-06-07] @ 150 USD
+    Assets:IBKR:TFSA:Cash  148.95 USD
+    Expenses:IBKR:TFSA:Commissions  1.05 USD
+`, string(ledger))
+}
+
+func TestToLedgerOptions(t *testing.T) {
+	transactions := []Transaction{
+		{date: "2023-06-05", account: "TFSA", action: "Trade", ticker: "TECK", shares: "100", proceeds: "-4607", commission: "-1", currency: "USD", codes: "O"},
+		{date: "2023-06-07", account: "TFSA", action: "Trade - Option", ticker: "TECK", optionContract: "21JUL23 50 C", optionContracts: "-1", proceeds: "150", commission: "-1.05", currency: "USD", codes: "O"},
+		{date: "2023-06-07", account: "TFSA", action: "Trade - Option", ticker: "TECK", optionContract: "21JUL23 40 P", optionContracts: "-1", proceeds: "80", commission: "-1.05", currency: "USD", codes: "O"},
+		{date: "2023-07-03", account: "TFSA", action: "Trade - Option", ticker: "FDX", optionContract: "21JUL23 230 P", optionContracts: "1", proceeds: "-250", commission: "-1", currency: "USD", codes: "O"},
+		{date: "2023-07-21", account: "TFSA", action: "Trade - Option - Assignment", ticker: "TECK", optionContract: "21JUL23 50 C", shares: "-100", proceeds: "5000", currency: "USD", codes: "A;C"},
+		{date: "2023-07-21", account: "TFSA", action: "Trade - Option - Exercise", ticker: "FDX", optionContract: "21JUL23 230 P", shares: "-100", proceeds: "23000", currency: "USD", codes: "C;Ex"},
+		{date: "2023-07-24", account: "TFSA", action: "Interest", dividend: "1.5", currency: "USD"},
+	}
+
+	journal := NewJournal()
+	path := filepath.Join(t.TempDir(), "transactions.ledger")
+	journal.ToLedger(transactions[1:], path, PlainTextConfig{})
+	ledger, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(ledger), `2023-07-21 * Trade - Option - Assignment TECK 21JUL23 50 C
+    Assets:IBKR:TFSA:Positions  -100 TECK @ 50 USD
+    Assets:IBKR:TFSA:Positions  1 "TECK-21JUL23-50-C" {150 USD} [2023-06-07] @ 150 USD
+    Assets:IBKR:TFSA:Cash  5000 USD
+    Income:IBKR:TFSA:Gains  -150 USD
+`, "stock lots opened before the transactions are closed at the price they were sold at")
+
+	journal.ToLedger(transactions, path, PlainTextConfig{})
+	ledger, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `2023-06-05 * Trade TECK
+    Assets:IBKR:TFSA:Positions  100 TECK {46.07 USD} [2023-06-05] @ 46.07 USD
+    Assets:IBKR:TFSA:Cash  -4608 USD
+    Expenses:IBKR:TFSA:Commissions  1 USD
+
+2023-06-07 * Trade - Option TECK 21JUL23 50 C
+    Assets:IBKR:TFSA:Positions  -1 "TECK-21JUL23-50-C" {150 USD} [2023-06-07] @ 150 USD
+    Assets:IBKR:TFSA:Cash  148.95 USD
+    Expenses:IBKR:TFSA:Commissions  1.05 USD
+
+2023-06-07 * Trade - Option TECK 21JUL23 40 P
+    Assets:IBKR:TFSA:Positions  -1 "TECK-21JUL23-40-P" {80 USD} [2023-06-07] @ 80 USD
+    Assets:IBKR:TFSA:Cash  78.95 USD
+    Expenses:IBKR:TFSA:Commissions  1.05 USD
+
+2023-07-03 * Trade - Option FDX 21JUL23 230 P
+    Assets:IBKR:TFSA:Positions  1 "FDX-21JUL23-230-P" {250 USD} [2023-07-03] @ 250 USD
+    Assets:IBKR:TFSA:Cash  -251 USD
+    Expenses:IBKR:TFSA:Commissions  1 USD
+
+2023-07-21 * Trade - Option - Assignment TECK 21JUL23 50 C
+    Assets:IBKR:TFSA:Positions  -100 TECK {46.07 USD} [2023-06-05] @ 46.07 USD
+    Assets:IBKR:TFSA:Positions  1 "TECK-21JUL23-50-C" {150 USD} [2023-06-07] @ 150 USD
+    Assets:IBKR:TFSA:Cash  5000 USD
+    Income:IBKR:TFSA:Gains  -543 USD
+
+2023-07-21 * Trade - Option - Exercise FDX 21JUL23 230 P
+    Assets:IBKR:TFSA:Positions  -100 FDX @ 230 USD
+    Assets:IBKR:TFSA:Positions  -1 "FDX-21JUL23-230-P" {250 USD} [2023-07-03] @ 250 USD
+    Assets:IBKR:TFSA:Cash  23000 USD
+    Income:IBKR:TFSA:Gains  250 USD
+
+2023-07-21 * Expired TECK 21JUL23 40 P
+    Assets:IBKR:TFSA:Positions  1 "TECK-21JUL23-40-P" {80 USD} [2023-06-07] @ 80 USD
+    Income:IBKR:TFSA:Gains  -80 USD
+
+2023-07-24 * Interest
+    Assets:IBKR:TFSA:Cash  1.5 USD
+    Income:IBKR:TFSA:Interest  -1.5 USD
+`, string(ledger))
+}
+
+func TestPlainTextAssignedPut(t *testing.T) {
+	transactions := []Transaction{
+		{date: "2023-06-07", account: "TFSA", action: "Trade - Option", ticker: "TECK", optionContract: "21JUL23 40 P", optionContracts: "-1", proceeds: "80", commission: "-1", currency: "USD", codes: "O"},
+		{date: "2023-07-21", account: "TFSA", action: "Trade - Option - Assignment", ticker: "TECK", optionContract: "21JUL23 40 P", shares: "100", proceeds: "-4000", currency: "USD", codes: "A;O"},
+	}
+
+	entries := plainTextEntries(transactions, PlainTextConfig{})
+	require.Len(t, entries, 2)
+	require.Equal(t, []posting{
+		{account: "Assets:IBKR:TFSA:Positions", amount: 100, commodity: "TECK", symbol: "TECK", cost: 39.2, costCurrency: "USD", costDate: "2023-07-21"},
+		{account: "Assets:IBKR:TFSA:Positions", amount: 1, commodity: "TECK-21JUL23-40-P", symbol: "TECK 21JUL23 40 P", cost: 80, costCurrency: "USD", costDate: "2023-06-07", premium: true},
+		{account: "Assets:IBKR:TFSA:Cash", amount: -4000, commodity: "USD"},
+	}, entries[1].postings, "the premium of the assigned put lowers the cost of the shares")
+}
+
+func TestToLedgerSplit(t *testing.T) {
+	transactions := []Transaction{
+		{date: "2023-06-01", account: "Margin", accountID: "U1234567", action: "Trade", ticker: "GOOGL", shares: "100", proceeds: "-12000", commission: "-1", currency: "USD", codes: "O"},
+		{date: "2023-06-15", account: "Margin", accountID: "U1234567", action: "Corporate Action - Split", ticker: "GOOGL", shares: "100", proceeds: "0", currency: "USD", notes: "GOOGL(US02079K3059) Split 2 for 1 (GOOGL, ALPHABET INC-CL A, US02079K3059)"},
+		{date: "2023-06-20", account: "Margin", accountID: "U1234567", action: "Trade", ticker: "GOOGL", shares: "-50", proceeds: "3250", commission: "-1", currency: "USD", codes: "C"},
+	}
+
+	journal := NewJournal()
+	path := filepath.Join(t.TempDir(), "transactions.ledger")
+	journal.ToLedger(transactions, path, PlainTextConfig{})
+	ledger, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `2023-06-01 * Trade GOOGL
+    Assets:IBKR:Margin:Positions  100 GOOGL {120 USD} [2023-06-01] @ 120 USD
+    Assets:IBKR:Margin:Cash  -12001 USD
+    Expenses:IBKR:Margin:Commissions  1 USD
+
+2023-06-15 * Corporate Action - Split GOOGL - GOOGL(US02079K3059) Split 2 for 1 (GOOGL, ALPHABET INC-CL A, US02079K3059)
+    Assets:IBKR:Margin:Positions  -100 GOOGL {120 USD} [2023-06-01] @ 120 USD
+    Assets:IBKR:Margin:Positions  200 GOOGL {60 USD} [2023-06-01] @ 60 USD
+
+2023-06-20 * Trade GOOGL
+    Assets:IBKR:Margin:Positions  -50 GOOGL {60 USD} [2023-06-01] @ 60 USD
+    Assets:IBKR:Margin:Cash  3249 USD
+    Expenses:IBKR:Margin:Commissions  1 USD
+    Income:IBKR:Margin:Gains  -250 USD
+`, string(ledger), "the split shares keep the cost of the lot, sales after the split are booked at the cost per share after the split")
+}
+
+func TestCommodity(t *testing.T) {
+	require.Equal(t, "TECK", commodity("TECK"))
+	require.Equal(t, "BRK.B", commodity("BRK.B"))
+	require.Equal(t, "TECK-21JUL23-38-C", commodity("TECK 21JUL23 38 C"))
+	require.Equal(t, "T-3-1-2-02-15-33", commodity("T 3 1/2 02/15/33"))
+	require.Equal(t, "X1COV", commodity("1COV"))
+	require.Equal(t, "Joint-margin", accountComponent("joint margin"))
+}
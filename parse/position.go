@@ -0,0 +1,118 @@
+package parse
+
+import (
+	"sort"
+)
+
+// Position is all the open lots of a stock or option in an account.
+type Position struct {
+	account    string  // account ID
+	symbol     string  // e.g. TECK or TECK 21JUL23 38 C
+	ticker     string  // underlying e.g. TECK
+	openDate   string  // date the oldest lot was opened
+	quantity   float64 // negative for short positions
+	costBasis  float64 // negative for short positions
+	multiplier float64
+	lots       int
+}
+
+// Campaign is all the trading of a ticker (stock and options) in an account from when the first lot is opened until
+// every lot is closed, e.g. selling puts, getting assigned, selling covered calls and getting called away.
+type Campaign struct {
+	account    string // account ID
+	ticker     string
+	startDate  string
+	endDate    string   // blank while the campaign is still open
+	symbols    []string // stocks and options traded, sorted
+	realizedPL float64  // of the closed lots
+	dividends  float64  // received while holding the ticker
+	fees       float64  // e.g. withholding tax, borrow fees, negative
+}
+
+// Positions returns the open lots summed up by account and symbol, sorted by account and symbol.
+func (l *Ledger) Positions() []Position {
+	var positions []Position
+	for _, lot := range l.Lots() {
+		last := len(positions) - 1
+		if last < 0 || positions[last].account != lot.account || positions[last].symbol != lot.symbol {
+			positions = append(positions, Position{
+				account:    lot.account,
+				symbol:     lot.symbol,
+				ticker:     lot.ticker,
+				openDate:   lot.date,
+				multiplier: lot.multiplier,
+			})
+			last++
+		}
+		positions[last].quantity += lot.quantity
+		positions[last].costBasis += lot.costBasis
+		positions[last].lots++
+	}
+	return positions
+}
+
+// Campaigns groups the closed and open lots of each ticker into campaigns, a campaign ends when there are no open lots
+// of the ticker left in the account. The dividends and fees of the transactions are added to the campaign of the
+// ticker that was held on their date.
+// Campaigns are sorted by account, ticker and start date.
+func (l *Ledger) Campaigns(transactions []Transaction) []Campaign {
+	lots := append(append([]Lot{}, l.closed...), l.Lots()...)
+	sort.SliceStable(lots, func(a, b int) bool {
+		if lots[a].account != lots[b].account {
+			return lots[a].account < lots[b].account
+		}
+		if lots[a].ticker != lots[b].ticker {
+			return lots[a].ticker < lots[b].ticker
+		}
+		return lots[a].date < lots[b].date
+	})
+
+	var campaigns []Campaign
+	for _, lot := range lots {
+		last := len(campaigns) - 1
+		// lots opened before the campaign's last lot was closed (or on the same day) belong to the same campaign
+		if last < 0 ||
+			campaigns[last].account != lot.account ||
+			campaigns[last].ticker != lot.ticker ||
+			(campaigns[last].endDate != "" && lot.date > campaigns[last].endDate) {
+			campaigns = append(campaigns, Campaign{
+				account:   lot.account,
+				ticker:    lot.ticker,
+				startDate: lot.date,
+				endDate:   lot.closeDate,
+			})
+			last++
+		}
+
+		campaign := &campaigns[last]
+		if campaign.endDate != "" && (lot.closeDate == "" || lot.closeDate > campaign.endDate) {
+			campaign.endDate = lot.closeDate
+		}
+		if !contains(campaign.symbols, lot.symbol) {
+			campaign.symbols = append(campaign.symbols, lot.symbol)
+		}
+		campaign.realizedPL += lot.realizedPL
+	}
+
+	for _, transaction := range transactions {
+		if transaction.dividend == "" && transaction.fee == "" {
+			continue
+		}
+		for i := range campaigns {
+			campaign := &campaigns[i]
+			if campaign.account == transaction.accountID &&
+				campaign.ticker == transaction.ticker &&
+				transaction.date >= campaign.startDate &&
+				(campaign.endDate == "" || transaction.date <= campaign.endDate) {
+				campaign.dividends += parseAmount(transaction.dividend)
+				campaign.fees += parseAmount(transaction.fee)
+				break
+			}
+		}
+	}
+
+	for i := range campaigns {
+		sort.Strings(campaigns[i].symbols)
+	}
+	return campaigns
+}
@@ -0,0 +1,57 @@
+package parse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPositions(t *testing.T) {
+	ledger := NewLedger()
+	ledger.open(&Lot{account: "U1234567", symbol: "TECK", ticker: "TECK", date: "2023-06-05", quantity: 100, costBasis: 4608, multiplier: 1})
+	ledger.open(&Lot{account: "U1234567", symbol: "TECK", ticker: "TECK", date: "2023-06-07", quantity: 100, costBasis: 4500, multiplier: 1})
+	ledger.open(&Lot{account: "U1234567", symbol: "TECK 21JUL23 50 C", ticker: "TECK", date: "2023-06-07", quantity: -2, costBasis: -300, multiplier: 100})
+
+	require.Equal(t, []Position{
+		{account: "U1234567", symbol: "TECK", ticker: "TECK", openDate: "2023-06-05", quantity: 200, costBasis: 9108, multiplier: 1, lots: 2},
+		{account: "U1234567", symbol: "TECK 21JUL23 50 C", ticker: "TECK", openDate: "2023-06-07", quantity: -2, costBasis: -300, multiplier: 100, lots: 1},
+	}, ledger.Positions())
+}
+
+func TestCampaigns(t *testing.T) {
+	ledger := NewLedger()
+	// put sold and assigned, then the shares were called away
+	ledger.closed = []Lot{
+		{account: "U1234567", symbol: "PR 16JUN23 10 P", ticker: "PR", date: "2023-05-01", closeDate: "2023-06-16", realizedPL: 50},
+		{account: "U1234567", symbol: "PR", ticker: "PR", date: "2023-06-16", closeDate: "2023-07-21", realizedPL: 100},
+		{account: "U1234567", symbol: "PR 21JUL23 11 C", ticker: "PR", date: "2023-06-20", closeDate: "2023-07-21", realizedPL: 30},
+	}
+	// bought again later, still open
+	ledger.open(&Lot{account: "U1234567", symbol: "PR", ticker: "PR", date: "2023-08-01", quantity: 100, costBasis: 1000, multiplier: 1})
+
+	transactions := []Transaction{
+		{accountID: "U1234567", ticker: "PR", date: "2023-06-30", action: "Dividend", dividend: "10", fee: "-1.5"},
+		{accountID: "U1234567", ticker: "PR", date: "2023-09-30", action: "Dividend", dividend: "12"},
+		{accountID: "U1234567", ticker: "PR", date: "2023-06-16", action: "Trade", proceeds: "-1000"},
+	}
+
+	require.Equal(t, []Campaign{
+		{
+			account:    "U1234567",
+			ticker:     "PR",
+			startDate:  "2023-05-01",
+			endDate:    "2023-07-21",
+			symbols:    []string{"PR", "PR 16JUN23 10 P", "PR 21JUL23 11 C"},
+			realizedPL: 180,
+			dividends:  10,
+			fees:       -1.5,
+		},
+		{
+			account:   "U1234567",
+			ticker:    "PR",
+			startDate: "2023-08-01",
+			symbols:   []string{"PR"},
+			dividends: 12,
+		},
+	}, ledger.Campaigns(transactions))
+}
@@ -0,0 +1,204 @@
+package parse
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ToQif writes the transactions as QIF investment accounts (!Type:Invst), one for each account, after the list of
+// securities (!Type:Security) they refer to.
+// QIF has no currencies, amounts are in the transaction's currency.
+func (j *Journal) ToQif(txs []Transaction, qifPath string) {
+	var out strings.Builder
+	names := make(map[string]string) // symbol -> security name, transactions refer to securities by name
+	for _, security := range j.securities(txs) {
+		names[security.symbol] = security.description
+		out.WriteString("!Type:Security\n")
+		out.WriteString("N" + security.description + "\n")
+		out.WriteString("S" + security.symbol + "\n")
+		out.WriteString("T" + qifSecurityType(security) + "\n")
+		out.WriteString("^\n")
+	}
+
+	out.WriteString("!Option:AutoSwitch\n")
+	for _, account := range transactionAccounts(txs) {
+		accountTxs := FilterAccount(txs, account)
+		sortTransactions(accountTxs)
+		name := accountTxs[0].account
+		if name == "" {
+			name = account
+		}
+		out.WriteString("!Account\n")
+		out.WriteString("N" + name + "\n")
+		out.WriteString("TInvst\n")
+		out.WriteString("^\n")
+		out.WriteString("!Type:Invst\n")
+		for _, tx := range accountTxs {
+			for _, entry := range j.qifEntries(tx, names[securitySymbol(tx)]) {
+				out.WriteString(entry)
+			}
+		}
+	}
+	out.WriteString("!Clear:AutoSwitch\n")
+
+	writeText(qifPath, out.String())
+}
+
+// qifEntry is a QIF investment transaction. Amounts are positive, the action tells which way the money went.
+type qifEntry struct {
+	date       string
+	action     string // e.g. Buy, Sell, ShtSell, CvrShrt, Div, IntInc, MiscExp
+	security   string
+	price      float64
+	quantity   float64
+	total      float64
+	commission float64
+	memo       string
+}
+
+func (e qifEntry) String() string {
+	var out strings.Builder
+	out.WriteString("D" + qifDate(e.date) + "\n")
+	out.WriteString("N" + e.action + "\n")
+	if e.security != "" {
+		out.WriteString("Y" + e.security + "\n")
+	}
+	if e.price != 0 {
+		out.WriteString("I" + plainNumber(e.price) + "\n")
+	}
+	if e.quantity != 0 {
+		out.WriteString("Q" + plainNumber(e.quantity) + "\n")
+	}
+	out.WriteString("T" + plainNumber(e.total) + "\n")
+	if e.commission != 0 {
+		out.WriteString("O" + plainNumber(e.commission) + "\n")
+	}
+	if e.memo != "" {
+		out.WriteString("M" + e.memo + "\n")
+	}
+	out.WriteString("^\n")
+	return out.String()
+}
+
+// qifEntries converts a transaction to QIF entries, e.g. a dividend with withholding tax is income and an expense.
+func (j *Journal) qifEntries(t Transaction, security string) []string {
+	memo := narration(t)
+	if !strings.HasPrefix(t.action, "Trade") && t.currency != "" {
+		memo += " (" + t.currency + ")"
+	}
+	// income and expenses are signed amounts
+	cash := func(amount float64, income string, expense string) string {
+		return qifEntry{date: t.date, action: choose(amount >= 0, income, expense), security: security,
+			total: math.Abs(amount), memo: memo}.String()
+	}
+
+	var entries []string
+	switch {
+	case t.action == "Forex":
+		bought, sold := parseAmount(t.forexBuyAmount), parseAmount(t.forexSellAmount)
+		entries = append(entries,
+			qifEntry{date: t.date, action: "XIn", total: math.Abs(bought), memo: fmt.Sprintf("%s - bought %s", memo, t.forexBuyCurrency)}.String(),
+			qifEntry{date: t.date, action: "XOut", total: math.Abs(sold), memo: fmt.Sprintf("%s - sold %s", memo, t.forexSellCurrency)}.String(),
+		)
+		if commission := parseAmount(t.commission); commission != 0 {
+			entries = append(entries, cash(commission, "MiscInc", "MiscExp"))
+		}
+
+	case t.action == "Trade - Future":
+		// futures are marked to market, only the cash settled each day changes hands
+		entries = append(entries, cash(parseAmount(t.mtmPL)+parseAmount(t.commission), "MiscInc", "MiscExp"))
+
+	case strings.HasPrefix(t.action, "Trade"):
+		_, quantity := tradedSymbol(t)
+		if quantity == 0 {
+			break
+		}
+		proceeds, commission := parseAmount(t.proceeds), parseAmount(t.commission)
+		action := "Buy"
+		switch {
+		case quantity > 0 && isClosingTrade(t) && (t.action == "Trade - Cover" || t.optionContracts != ""):
+			action = "CvrShrt"
+		case quantity < 0 && !isClosingTrade(t) && (t.action == "Trade - Short" || t.optionContracts != ""):
+			action = "ShtSell"
+		case quantity < 0:
+			action = "Sell"
+		}
+		entries = append(entries, qifEntry{
+			date:       t.date,
+			action:     action,
+			security:   security,
+			price:      math.Abs(proceeds / quantity),
+			quantity:   math.Abs(quantity),
+			total:      math.Abs(proceeds + commission),
+			commission: math.Abs(commission),
+			memo:       memo,
+		}.String())
+		// bought bonds pay the interest accrued since the last coupon, sold bonds receive it
+		if accrued := parseAmount(t.accruedInterest); accrued != 0 {
+			entries = append(entries, cash(accrued, "IntInc", "MiscExp"))
+		}
+
+	case t.action == "Transfer" || strings.HasPrefix(t.action, "Corporate Action"):
+		if quantity := parseAmount(t.shares); quantity != 0 {
+			price := parseAmount(t.price)
+			if price == 0 && t.costBasisTotal != "" {
+				price = math.Abs(parseAmount(t.costBasisTotal) / quantity)
+			}
+			entries = append(entries, qifEntry{
+				date:     t.date,
+				action:   choose(quantity > 0, "ShrsIn", "ShrsOut"),
+				security: security,
+				price:    price,
+				quantity: math.Abs(quantity),
+				total:    math.Abs(price * quantity),
+				memo:     memo,
+			}.String())
+		}
+		// cash received in a merger
+		if proceeds := parseAmount(t.proceeds); proceeds != 0 {
+			entries = append(entries, cash(proceeds, "MiscInc", "MiscExp"))
+		}
+
+	case t.action == "Dividend":
+		dividend := parseAmount(t.dividend)
+		if t.dividendType == "Return of Capital" && dividend > 0 {
+			entries = append(entries, cash(dividend, "RtrnCap", "MiscExp"))
+		} else if dividend != 0 {
+			entries = append(entries, cash(dividend, "Div", "MiscExp"))
+		}
+		if fee := parseAmount(t.fee); fee != 0 {
+			entries = append(entries, cash(fee, "MiscInc", "MiscExp"))
+		}
+
+	case t.action == "Fee" || t.action == "Withholding Tax":
+		entries = append(entries, cash(parseAmount(t.fee), "MiscInc", "MiscExp"))
+
+	case t.action == "Interest":
+		entries = append(entries, cash(parseAmount(t.dividend), "IntInc", "MiscExp"))
+	}
+	return entries
+}
+
+func qifSecurityType(security instrument) string {
+	switch {
+	case security.isOption():
+		return "Option"
+	case strings.Contains(security.assetCategory, "Bond"):
+		return "Bond"
+	case strings.Contains(security.assetCategory, "Mutual Fund"):
+		return "Mutual Fund"
+	case strings.Contains(security.assetCategory, "Future"):
+		return "Other"
+	}
+	return "Stock"
+}
+
+// qifDate converts 2006-01-02 to 01/02/2006.
+func qifDate(date string) string {
+	parts := strings.Split(date, "-")
+	if len(parts) != 3 {
+		return date
+	}
+	return parts[1] + "/" + parts[2] + "/" + parts[0]
+}
@@ -0,0 +1,76 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToQif(t *testing.T) {
+	transactions := []Transaction{
+		{date: "2023-06-05", account: "TFSA", accountID: "U1234567", action: "Trade", ticker: "TECK", shares: "100", proceeds: "-4607", commission: "-1", currency: "USD", codes: "O"},
+		{date: "2023-06-07", account: "TFSA", accountID: "U1234567", action: "Trade - Option", ticker: "TECK", optionContract: "21JUL23 50 C", optionContracts: "-1", proceeds: "150", commission: "-1.05", currency: "USD", codes: "O"},
+		{date: "2023-06-08", account: "TFSA", accountID: "U1234567", action: "Dividend", ticker: "TECK", dividend: "12.5", fee: "-1.88", currency: "USD", notes: "TECK Cash Dividend USD 0.125 per Share"},
+	}
+
+	journal := NewJournal()
+	path := filepath.Join(t.TempDir(), "transactions.qif")
+	journal.ToQif(transactions, path)
+	qif, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `!Type:Security
+NTECK
+STECK
+TStock
+^
+!Type:Security
+NTECK 21JUL23 50 C
+STECK 21JUL23 50 C
+TOption
+^
+!Option:AutoSwitch
+!Account
+NTFSA
+TInvst
+^
+!Type:Invst
+D06/05/2023
+NBuy
+YTECK
+I46.07
+Q100
+T4608
+O1
+MTrade TECK
+^
+D06/07/2023
+NShtSell
+YTECK 21JUL23 50 C
+I150
+Q1
+T148.95
+O1.05
+MTrade - Option TECK 21JUL23 50 C
+^
+D06/08/2023
+NDiv
+YTECK
+T12.5
+MDividend TECK - TECK Cash Dividend USD 0.125 per Share (USD)
+^
+D06/08/2023
+NMiscExp
+YTECK
+T1.88
+MDividend TECK - TECK Cash Dividend USD 0.125 per Share (USD)
+^
+!Clear:AutoSwitch
+`, string(qif))
+}
+
+func TestQifDate(t *testing.T) {
+	require.Equal(t, "01/20/2023", qifDate("2023-01-20"))
+	require.Equal(t, "", qifDate(""))
+}
@@ -0,0 +1,430 @@
+package parse
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+//go:embed templates/report.html
+var reportTemplate string
+
+// report is the data of the HTML report, everything is rendered into a single file so it can be archived with the
+// statements and opened offline.
+type report struct {
+	Title     string
+	From      string
+	To        string
+	Accounts  []reportAccount
+	Charts    []template.HTML
+	Trades    []reportTrade
+	Options   []reportTrade
+	Dividends []reportDividend
+	Fees      []reportFee
+	Closed    []reportLot
+	Positions []reportPosition
+}
+
+type reportAccount struct {
+	Label        string
+	ID           string
+	Type         string
+	BaseCurrency string
+	Totals       []*reportTotal // by currency
+}
+
+type reportTotal struct {
+	Currency       string
+	Trades         int
+	Commissions    float64
+	Dividends      float64
+	WithholdingTax float64
+	Fees           float64
+	Interest       float64
+	RealizedPL     float64
+}
+
+type reportTrade struct {
+	Date, Account, Action, Symbol, Currency, Notes    string
+	Quantity, Price, Proceeds, Commission, RealizedPL string
+}
+
+type reportDividend struct {
+	Date, Account, Ticker, Type, Currency, Notes string
+	Amount, WithholdingTax                       string
+}
+
+type reportFee struct {
+	Date, Account, Type, Ticker, Currency, Notes string
+	Amount                                       string
+}
+
+type reportLot struct {
+	Account, Symbol, Opened, Closed, Currency string
+	Quantity, CostBasis, Proceeds, RealizedPL float64
+}
+
+type reportPosition struct {
+	Account, Symbol, Opened, Currency      string
+	Quantity, CostBasis, CostBasisPerShare float64
+	Lots                                   int
+}
+
+// ToHtml writes a static HTML report of the transactions from one date to another (inclusive, blank for no limit)
+// with an account summary, trades, option activity, dividends, fees, realized P/L and open positions at the end of
+// the period. Transactions before the period are only used for the cost basis of the lots.
+func (j *Journal) ToHtml(txs []Transaction, htmlPath string, from string, to string) {
+	file, err := os.Create(htmlPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	html := template.Must(template.New("report").Funcs(template.FuncMap{
+		"amount":   func(amount any) template.HTML { return reportCell(amount, 2) },
+		"quantity": func(quantity any) template.HTML { return reportCell(quantity, -1) },
+	}).Parse(reportTemplate))
+	if err := html.Execute(file, j.report(txs, from, to)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (j *Journal) report(txs []Transaction, from string, to string) report {
+	// lots are opened by the transactions up to the end of the period, including those before it
+	ledger := NewLedger()
+	ledger.Apply(FilterPeriod(txs, "", to))
+	periodTxs := FilterPeriod(txs, from, to)
+	sortTransactions(periodTxs)
+
+	r := report{From: from, To: to}
+	if len(periodTxs) > 0 {
+		if r.From == "" {
+			r.From = periodTxs[0].date
+		}
+		if r.To == "" {
+			r.To = periodTxs[len(periodTxs)-1].date
+		}
+	}
+	// accounts are shown as in the journal, the alias if there is one
+	labels := accountLabels(txs)
+	label := func(accountID string) string {
+		if labels[accountID] != "" {
+			return labels[accountID]
+		}
+		return j.findAccount(accountID).label()
+	}
+	r.Title = "Trade Journal"
+	if accounts := transactionAccounts(periodTxs); len(accounts) == 1 {
+		r.Title += " - " + label(accounts[0])
+	}
+
+	accounts := make(map[string]*reportAccount)
+	total := func(accountID string, currency string) *reportTotal {
+		account, ok := accounts[accountID]
+		if !ok {
+			a := j.findAccount(accountID)
+			account = &reportAccount{Label: label(accountID), ID: a.id, Type: a.customerType, BaseCurrency: a.baseCurrency}
+			accounts[accountID] = account
+		}
+		for _, t := range account.Totals {
+			if t.Currency == currency {
+				return t
+			}
+		}
+		t := &reportTotal{Currency: currency}
+		account.Totals = append(account.Totals, t)
+		sort.Slice(account.Totals, func(a, b int) bool { return account.Totals[a].Currency < account.Totals[b].Currency })
+		return t
+	}
+
+	currencies := lotCurrencies(txs)
+
+	for _, tx := range periodTxs {
+		commissionCurrency := tx.currency
+		if tx.commissionCurrency != "" {
+			commissionCurrency = tx.commissionCurrency
+		}
+		if commission := parseAmount(tx.commission); commission != 0 {
+			total(tx.accountID, commissionCurrency).Commissions += commission
+		}
+
+		action := tx.action
+		if tx.actionModified != "" {
+			action = tx.actionModified
+		}
+		switch {
+		case strings.HasPrefix(tx.action, "Trade") || tx.action == "Transfer" || strings.HasPrefix(tx.action, "Corporate Action"):
+			symbol, quantity := tradedSymbol(tx)
+			trade := reportTrade{
+				Date:       tx.date,
+				Account:    tx.account,
+				Action:     action,
+				Symbol:     symbol,
+				Currency:   tx.currency,
+				Notes:      tx.notes,
+				Quantity:   reportNumber(quantity, tx.shares+tx.optionContracts),
+				Price:      tx.price,
+				Proceeds:   tx.proceeds,
+				Commission: tx.commission,
+				RealizedPL: tx.realizedPL,
+			}
+			if tx.optionContracts != "" {
+				r.Options = append(r.Options, trade)
+			} else {
+				r.Trades = append(r.Trades, trade)
+			}
+			if strings.HasPrefix(tx.action, "Trade") {
+				total(tx.accountID, tx.currency).Trades++
+			}
+
+		case tx.action == "Dividend":
+			r.Dividends = append(r.Dividends, reportDividend{
+				Date:           tx.date,
+				Account:        tx.account,
+				Ticker:         tx.ticker,
+				Type:           tx.dividendType,
+				Currency:       tx.currency,
+				Notes:          tx.notes,
+				Amount:         tx.dividend,
+				WithholdingTax: tx.fee,
+			})
+			total(tx.accountID, tx.currency).Dividends += parseAmount(tx.dividend)
+			total(tx.accountID, tx.currency).WithholdingTax += parseAmount(tx.fee)
+
+		case tx.action == "Fee" || tx.action == "Withholding Tax" || tx.action == "Interest":
+			amount := tx.fee
+			if tx.action == "Interest" {
+				amount = tx.dividend
+				total(tx.accountID, tx.currency).Interest += parseAmount(amount)
+			} else if tx.action == "Withholding Tax" {
+				total(tx.accountID, tx.currency).WithholdingTax += parseAmount(amount)
+			} else {
+				total(tx.accountID, tx.currency).Fees += parseAmount(amount)
+			}
+			r.Fees = append(r.Fees, reportFee{
+				Date:     tx.date,
+				Account:  tx.account,
+				Type:     tx.action,
+				Ticker:   tx.ticker,
+				Currency: tx.currency,
+				Notes:    tx.notes,
+				Amount:   amount,
+			})
+		}
+	}
+
+	for _, lot := range ledger.Closed() {
+		if lot.closeDate < r.From || lot.closeDate > r.To {
+			continue
+		}
+		currency := currencies[lot.account+" "+lot.symbol]
+		r.Closed = append(r.Closed, reportLot{
+			Account:    label(lot.account),
+			Symbol:     lot.symbol,
+			Opened:     lot.date,
+			Closed:     lot.closeDate,
+			Currency:   currency,
+			Quantity:   lot.quantity,
+			CostBasis:  lot.costBasis,
+			Proceeds:   lot.proceeds,
+			RealizedPL: lot.realizedPL,
+		})
+		total(lot.account, currency).RealizedPL += lot.realizedPL
+	}
+	sort.SliceStable(r.Closed, func(a, b int) bool { return r.Closed[a].Closed < r.Closed[b].Closed })
+
+	for _, position := range ledger.Positions() {
+		p := reportPosition{
+			Account:   label(position.account),
+			Symbol:    position.symbol,
+			Opened:    position.openDate,
+			Currency:  currencies[position.account+" "+position.symbol],
+			Quantity:  position.quantity,
+			CostBasis: position.costBasis,
+			Lots:      position.lots,
+		}
+		if position.quantity != 0 && position.multiplier != 0 {
+			p.CostBasisPerShare = position.costBasis / (position.quantity * position.multiplier)
+		}
+		r.Positions = append(r.Positions, p)
+	}
+
+	for _, accountID := range transactionAccounts(periodTxs) {
+		if account, ok := accounts[accountID]; ok {
+			r.Accounts = append(r.Accounts, *account)
+		}
+	}
+	r.Charts = reportCharts(r)
+	return r
+}
+
+// reportCharts charts the realized P/L and the dividends (after withholding tax) of each currency, by day for periods
+// of up to a month, otherwise by month.
+func reportCharts(r report) []template.HTML {
+	if len(r.Closed) == 0 && len(r.Dividends) == 0 {
+		return nil
+	}
+	period := func(date string) string {
+		if strings.HasPrefix(r.To, r.From[:7]) {
+			return date
+		}
+		return date[:7]
+	}
+
+	type series map[string]map[string]float64 // currency -> period -> amount
+	add := func(s series, currency string, date string, amount float64) {
+		if s[currency] == nil {
+			s[currency] = make(map[string]float64)
+		}
+		s[currency][period(date)] += amount
+	}
+	realized, dividends := make(series), make(series)
+	for _, lot := range r.Closed {
+		add(realized, lot.Currency, lot.Closed, lot.RealizedPL)
+	}
+	for _, dividend := range r.Dividends {
+		add(dividends, dividend.Currency, dividend.Date, parseAmount(dividend.Amount)+parseAmount(dividend.WithholdingTax))
+	}
+
+	var charts []template.HTML
+	for _, chart := range []struct {
+		title  string
+		series series
+	}{{"Realized P/L", realized}, {"Dividends", dividends}} {
+		var currencies []string
+		for currency := range chart.series {
+			currencies = append(currencies, currency)
+		}
+		sort.Strings(currencies)
+		for _, currency := range currencies {
+			var bars []bar
+			for label, value := range chart.series[currency] {
+				bars = append(bars, bar{label, value})
+			}
+			sort.Slice(bars, func(a, b int) bool { return bars[a].label < bars[b].label })
+			charts = append(charts, barChart(fmt.Sprintf("%s (%s)", chart.title, currency), bars))
+		}
+	}
+	return charts
+}
+
+type bar struct {
+	label string
+	value float64
+}
+
+// barChart draws the bars as an inline SVG, positive bars up and negative bars down from the zero line.
+func barChart(title string, bars []bar) template.HTML {
+	const width, height, top, bottom, side = 480, 220, 30, 40, 10
+	maxValue := 0.0
+	for _, b := range bars {
+		maxValue = math.Max(maxValue, math.Abs(b.value))
+	}
+	hasNegative := false
+	for _, b := range bars {
+		hasNegative = hasNegative || b.value < 0
+	}
+	plotHeight := float64(height - top - bottom)
+	zero := float64(top) + plotHeight
+	scale := 0.0
+	if maxValue > 0 {
+		scale = plotHeight / maxValue
+		if hasNegative {
+			zero = float64(top) + plotHeight/2
+			scale /= 2
+		}
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg width="%d" height="%d" viewBox="0 0 %d %d" role="img">`, width, height, width, height)
+	fmt.Fprintf(&svg, `<text x="%d" y="18" font-weight="bold">%s</text>`, side, template.HTMLEscapeString(title))
+	slot := math.Min(float64(width-2*side)/math.Max(float64(len(bars)), 1), 60)
+	// label every bar when there's room, otherwise some of them
+	every := int(math.Ceil(float64(len(bars)) * 70 / float64(width-2*side)))
+	for i, b := range bars {
+		x := float64(side) + float64(i)*slot + slot*0.15
+		barHeight := math.Abs(b.value) * scale
+		y := zero - barHeight
+		class := "positive"
+		if b.value < 0 {
+			y, class = zero, "negative"
+		}
+		fmt.Fprintf(&svg, `<rect class="%s" x="%.1f" y="%.1f" width="%.1f" height="%.1f"><title>%s: %s</title></rect>`,
+			class, x, y, slot*0.7, barHeight, template.HTMLEscapeString(b.label), formatAmount(b.value, 2))
+		if i%every == 0 {
+			fmt.Fprintf(&svg, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`,
+				x+slot*0.35, height-bottom/2, template.HTMLEscapeString(b.label))
+		}
+	}
+	fmt.Fprintf(&svg, `<line class="axis" x1="%d" y1="%.1f" x2="%d" y2="%.1f"/>`, side, zero, width-side, zero)
+	svg.WriteString("</svg>")
+	return template.HTML(svg.String())
+}
+
+// FilterPeriod returns the transactions from one date to another (inclusive), a blank date has no limit.
+func FilterPeriod(transactions []Transaction, from string, to string) []Transaction {
+	var periodTransactions []Transaction
+	for _, transaction := range transactions {
+		if (from == "" || transaction.date >= from) && (to == "" || transaction.date <= to) {
+			periodTransactions = append(periodTransactions, transaction)
+		}
+	}
+	return periodTransactions
+}
+
+// reportCell is a right aligned table cell, red for negative amounts and empty for blank amounts.
+// Amounts are rounded to the decimals, -1 for as many as needed.
+func reportCell(value any, decimals int) template.HTML {
+	var amount float64
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return `<td class="number"></td>`
+		}
+		amount = parseAmount(v)
+	case float64:
+		amount = v
+	}
+	class := "number"
+	if amount < 0 {
+		class += " negative"
+	}
+	return template.HTML(fmt.Sprintf(`<td class="%s">%s</td>`, class, formatAmount(amount, decimals)))
+}
+
+// formatAmount formats the amount with thousands separators e.g. -1,234.50
+func formatAmount(amount float64, decimals int) string {
+	text := plainNumber(math.Abs(amount))
+	if decimals >= 0 {
+		text = fmt.Sprintf("%.*f", decimals, math.Abs(amount))
+	}
+	whole, fraction, hasFraction := strings.Cut(text, ".")
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	text = grouped.String()
+	if hasFraction {
+		text += "." + fraction
+	}
+	if amount < 0 && strings.Trim(text, "0.,") != "" {
+		text = "-" + text
+	}
+	return text
+}
+
+// reportNumber is the quantity of a trade, blank when the transaction had none.
+func reportNumber(quantity float64, text string) string {
+	if text == "" {
+		return ""
+	}
+	return plainNumber(quantity)
+}
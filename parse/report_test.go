@@ -0,0 +1,81 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToHtml(t *testing.T) {
+	transactions := []Transaction{
+		{date: "2023-05-05", account: "TFSA", accountID: "U1234567", action: "Trade", ticker: "TECK", shares: "100", proceeds: "-4607", commission: "-1", currency: "USD", codes: "O"},
+		{date: "2023-06-07", account: "TFSA", accountID: "U1234567", action: "Trade - Option", ticker: "TECK", optionContract: "21JUL23 50 C", optionContracts: "-1", price: "1.5", proceeds: "150", commission: "-1.05", currency: "USD", codes: "O"},
+		{date: "2023-06-08", account: "TFSA", accountID: "U1234567", action: "Dividend", ticker: "TECK", dividend: "12.5", fee: "-1.88", currency: "USD", notes: "TECK Cash Dividend USD 0.125 per Share"},
+		{date: "2023-06-09", account: "TFSA", accountID: "U1234567", action: "Trade", ticker: "TECK", shares: "-50", price: "50", proceeds: "2500", commission: "-1", currency: "USD", codes: "C"},
+		{date: "2023-06-09", account: "TFSA", accountID: "U1234567", action: "Fee", fee: "-1.5", currency: "USD", notes: "<OPRA> market data"},
+		{date: "2023-07-03", account: "TFSA", accountID: "U1234567", action: "Trade", ticker: "TECK", shares: "-50", proceeds: "2600", commission: "-1", currency: "USD", codes: "C"},
+	}
+
+	journal := NewJournal()
+	path := filepath.Join(t.TempDir(), "report.html")
+	journal.ToHtml(transactions, path, "2023-06-01", "2023-06-30")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	html := string(data)
+
+	require.Contains(t, html, "<h1>Trade Journal - TFSA</h1>")
+	require.Contains(t, html, "2023-06-01 to 2023-06-30")
+	// the trade before the period only opens the lot, the trade after it isn't in the report
+	require.NotContains(t, html, "<td>2023-05-05</td><td>TFSA</td><td>Trade</td>")
+	require.NotContains(t, html, "2023-07-03")
+	require.Contains(t, html, `<td>2023-06-09</td><td>TFSA</td><td>Trade</td><td>TECK</td><td class="number negative">-50</td><td class="number">50</td><td class="number">2,500.00</td>`)
+	require.Contains(t, html, `<td>TECK 21JUL23 50 C</td>`)
+	require.Contains(t, html, `<td class="number">12.50</td><td class="number negative">-1.88</td>`)
+	// closed half of the lot opened before the period, the other half is still open at the end of the period
+	require.Contains(t, html, `<tr><td>TFSA</td><td>TECK</td><td>2023-05-05</td><td>2023-06-09</td><td class="number">50</td><td class="number">2,304.00</td><td class="number">2,499.00</td><td class="number">195.00</td><td>USD</td></tr>`)
+	require.Contains(t, html, `<tr><td>TFSA</td><td>TECK</td><td>2023-05-05</td><td class="number">50</td>`)
+	require.Contains(t, html, "&lt;OPRA&gt; market data")
+	require.Contains(t, html, "<svg")
+	require.Contains(t, html, "Realized P/L (USD)")
+	require.Contains(t, html, "Dividends (USD)")
+
+	// self-contained, nothing is loaded when opened
+	require.NotContains(t, html, "src=")
+	require.NotContains(t, html, "href=")
+	require.NotContains(t, html, "<script")
+}
+
+func TestToHtmlStatements(t *testing.T) {
+	files, err := filepath.Glob("../testdata/input/*.csv")
+	require.NoError(t, err)
+
+	for _, file := range files {
+		journal := NewJournal()
+		transactions := journal.ReadTransactions(file)
+		path := filepath.Join(t.TempDir(), "report.html")
+		journal.ToHtml(transactions, path, "", "")
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.True(t, strings.HasSuffix(string(data), "</html>\n"), file)
+	}
+}
+
+func TestFilterPeriod(t *testing.T) {
+	transactions := []Transaction{{date: "2023-06-01"}, {date: "2023-06-15"}, {date: "2023-07-01"}}
+	require.Len(t, FilterPeriod(transactions, "", ""), 3)
+	require.Len(t, FilterPeriod(transactions, "2023-06-15", ""), 2)
+	require.Len(t, FilterPeriod(transactions, "", "2023-06-15"), 2)
+	require.Equal(t, []Transaction{{date: "2023-06-15"}}, FilterPeriod(transactions, "2023-06-02", "2023-06-30"))
+}
+
+func TestFormatAmount(t *testing.T) {
+	require.Equal(t, "0.00", formatAmount(0, 2))
+	require.Equal(t, "-1,234.50", formatAmount(-1234.5, 2))
+	require.Equal(t, "1,234,567.00", formatAmount(1234567, 2))
+	require.Equal(t, "0.00", formatAmount(-0.001, 2))
+	require.Equal(t, "41.43482091", formatAmount(41.43482091, -1))
+	require.Equal(t, "-100", formatAmount(-100, -1))
+}
@@ -0,0 +1,44 @@
+package parse
+
+import "strings"
+
+// row is a data row of a statement section together with the column names from the section's last header row.
+// IBKR statements add columns to some sections (e.g. consolidated statements have an Account column), so columns
+// are looked up by name instead of position.
+type row struct {
+	header []string
+	rec    []string
+}
+
+// get returns the value of the first column that exists out of the column names, or blank if none exist.
+// e.g. commission is under "Comm/Fee" for stocks and options and under "Comm in USD" for forex
+func (r row) get(names ...string) string {
+	for _, name := range names {
+		for i, column := range r.header {
+			if column == name && i < len(r.rec) {
+				return r.rec[i]
+			}
+		}
+	}
+	return ""
+}
+
+// isFeeSection checks if the statement section lists account charges (e.g. market data subscriptions, advisor fees).
+func isFeeSection(section string) bool {
+	switch section {
+	case "Fees", "Other Fees", "Market Data", "Advisor Fees":
+		return true
+	}
+	return false
+}
+
+// baseCommissionCurrency is the currency of the forex commission column, e.g. CAD for "Comm in CAD". Forex
+// commissions are in the account's base currency.
+func baseCommissionCurrency(header []string) string {
+	for _, column := range header {
+		if strings.HasPrefix(column, "Comm in ") {
+			return strings.TrimPrefix(column, "Comm in ")
+		}
+	}
+	return ""
+}
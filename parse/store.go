@@ -0,0 +1,335 @@
+package parse
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ReadStore reads the transactions of the journal store, an NDJSON file of transaction records (see schema/v1.json)
+// that statements are imported into. The accounts, instruments and exchange rates of the statements imported are
+// added to the journal so the outputs have them as if the statements were read, and its dividends so the withholding
+// tax and reversals of statements read after the store are netted into them. A store that doesn't exist yet has no
+// transactions.
+func (j *Journal) ReadStore(storePath string) ([]Transaction, error) {
+	file, err := os.Open(storePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var transactions []Transaction
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var header struct {
+			SchemaVersion int    `json:"schemaVersion"`
+			Type          string `json:"type"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", storePath, line, err)
+		}
+		if header.SchemaVersion > JsonSchemaVersion {
+			return nil, fmt.Errorf("%s:%d: schema version %d is newer than %d", storePath, line, header.SchemaVersion, JsonSchemaVersion)
+		}
+
+		switch header.Type {
+		case "transaction":
+			var transaction Transaction
+			err = json.Unmarshal(scanner.Bytes(), &transaction)
+			transactions = append(transactions, transaction)
+			if transaction.action == "Dividend" {
+				j.storedDividends = append(j.storedDividends, transaction)
+			}
+		case "account":
+			var record accountRecord
+			err = json.Unmarshal(scanner.Bytes(), &record)
+			j.registerAccount(record.account())
+		case "instrument":
+			var record instrumentRecord
+			err = json.Unmarshal(scanner.Bytes(), &record)
+			if j.instruments == nil {
+				j.instruments = make(map[string]instrument)
+			}
+			j.instruments[record.Symbol] = record.instrument()
+		case "rates":
+			var record ratesRecord
+			err = json.Unmarshal(scanner.Bytes(), &record)
+			j.rates = append(j.rates, record.statementRates())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", storePath, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", storePath, err)
+	}
+	return transactions, nil
+}
+
+// WriteStore replaces the journal store with the accounts, instruments and exchange rates of the journal and the
+// transactions sorted by date. The store is written to a temporary file first so it's never left half written.
+func (j *Journal) WriteStore(storePath string, txs []Transaction) {
+	sorted := sortedTransactions(txs)
+	temp, err := os.CreateTemp(filepath.Dir(storePath), filepath.Base(storePath)+".*")
+	if err != nil {
+		log.Fatal(err)
+	}
+	writer := bufio.NewWriter(temp)
+	encoder := json.NewEncoder(writer)
+	for _, account := range j.Accounts() {
+		writeNdjsonRecord(encoder, "account", account.record())
+	}
+	for _, i := range j.storeInstruments() {
+		writeNdjsonRecord(encoder, "instrument", i.record())
+	}
+	for _, rates := range j.storeRates() {
+		writeNdjsonRecord(encoder, "rates", rates.record())
+	}
+	WriteNdjson(writer, Export{Transactions: sorted})
+	if err := writer.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := temp.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Rename(temp.Name(), storePath); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// storeInstruments returns the instruments sorted by symbol.
+func (j *Journal) storeInstruments() []instrument {
+	var instruments []instrument
+	for _, i := range j.instruments {
+		instruments = append(instruments, i)
+	}
+	sort.Slice(instruments, func(a, b int) bool {
+		return instruments[a].symbol < instruments[b].symbol
+	})
+	return instruments
+}
+
+// storeRates returns the exchange rates sorted by statement period. A statement imported again (e.g. after it was
+// read from the store) only has its latest rates.
+func (j *Journal) storeRates() []statementRates {
+	periods := make(map[string]statementRates)
+	for _, rates := range j.rates {
+		periods[rates.from+" "+rates.to] = rates
+	}
+	var sorted []statementRates
+	for _, rates := range periods {
+		sorted = append(sorted, rates)
+	}
+	sort.Slice(sorted, func(a, b int) bool {
+		if sorted[a].from != sorted[b].from {
+			return sorted[a].from < sorted[b].from
+		}
+		return sorted[a].to < sorted[b].to
+	})
+	return sorted
+}
+
+// MergeTransactions adds the transactions that aren't in the existing transactions yet. Transactions that are there
+// with other amounts or notes, matched by the key fields of appending to the journal CSV, are replaced since a later
+// statement changed them e.g. withholding tax netted into a dividend. It returns all the transactions, the number
+// added and the number replaced.
+func MergeTransactions(existing []Transaction, txs []Transaction) ([]Transaction, int, int) {
+	merged := append([]Transaction{}, existing...)
+	missing := MissingTransactions(existing, txs)
+
+	// transactions matched exactly aren't replaced
+	incoming := make(map[string]int)
+	for _, transaction := range txs {
+		incoming[transactionKey(transaction)]++
+	}
+	changed := make(map[string][]int)
+	for i, transaction := range merged {
+		key := transactionKey(transaction)
+		if incoming[key] > 0 {
+			incoming[key]--
+			continue
+		}
+		changed[identityKey(transaction)] = append(changed[identityKey(transaction)], i)
+	}
+
+	added, replaced := 0, 0
+	for _, transaction := range missing {
+		key := identityKey(transaction)
+		if len(changed[key]) > 0 {
+			merged[changed[key][0]] = transaction
+			changed[key] = changed[key][1:]
+			replaced++
+			continue
+		}
+		merged = append(merged, transaction)
+		added++
+	}
+	return merged, added, replaced
+}
+
+// RemoveReversedDividends removes the dividends and reversals that the journal netted out against each other from the
+// transactions, e.g. a dividend imported before the statement with its reversal. It returns the transactions kept and
+// the number removed.
+func (j *Journal) RemoveReversedDividends(txs []Transaction) ([]Transaction, int) {
+	reversed := make(map[string]int)
+	for _, dividend := range j.reversedDividends {
+		reversed[dividendKey(dividend)]++
+	}
+
+	var kept []Transaction
+	for _, transaction := range txs {
+		key := dividendKey(transaction)
+		if transaction.action == "Dividend" && reversed[key] > 0 {
+			reversed[key]--
+			continue
+		}
+		kept = append(kept, transaction)
+	}
+	return kept, len(txs) - len(kept)
+}
+
+// MissingTransactions returns the transactions that aren't in the existing transactions, or are there with other
+// amounts or notes.
+func MissingTransactions(existing []Transaction, txs []Transaction) []Transaction {
+	// the same transaction can be there more than once e.g. two identical fills, so they're matched by count
+	counts := make(map[string]int)
+	for _, transaction := range existing {
+		counts[transactionKey(transaction)]++
+	}
+
+	var missing []Transaction
+	for _, transaction := range sortedTransactions(txs) {
+		key := transactionKey(transaction)
+		if counts[key] > 0 {
+			counts[key]--
+			continue
+		}
+		missing = append(missing, transaction)
+	}
+	return missing
+}
+
+// transactionKey is the values of all the fields and fills since the store isn't edited by hand, e.g. two market data
+// fees of the same amount on the same day are only told apart by their description.
+func transactionKey(transaction Transaction) string {
+	fields := reflect.ValueOf(transaction)
+	var values []string
+	for i := 0; i < fields.NumField(); i++ {
+		if fields.Field(i).Kind() == reflect.String {
+			values = append(values, keyValue(fields.Field(i).String()))
+		}
+	}
+	for _, fill := range transaction.fills {
+		values = append(values, "("+transactionKey(fill)+")")
+	}
+	return strings.Join(values, "|")
+}
+
+// identityKey is the values of the key fields and the currency, which a later statement doesn't change.
+func identityKey(transaction Transaction) string {
+	return fieldsKey(transaction, "currency")
+}
+
+// dividendKey tells a dividend from its correction on the same date by the amount.
+func dividendKey(transaction Transaction) string {
+	return fieldsKey(transaction, "currency", "dividend")
+}
+
+func fieldsKey(transaction Transaction, fields ...string) string {
+	names := append([]string{}, fields...)
+	for name := range keyFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var values []string
+	for _, name := range names {
+		values = append(values, keyValue(field(transaction, name)))
+	}
+	return strings.Join(values, "|")
+}
+
+// keyValue compares amounts as numbers, e.g. 4838.82 is the same as 4,838.820 since statements have thousands
+// separators in some amounts and the store doesn't.
+func keyValue(value string) string {
+	if isNumber(value) {
+		value = strings.ReplaceAll(value, ",", "")
+	}
+	return normalizeCell(value)
+}
+
+// UnmarshalJSON reads a transaction record, the opposite of MarshalJSON.
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	var record transactionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	if record.Date == "" {
+		return fmt.Errorf("transaction without a date: %s", data)
+	}
+	*t = record.transaction()
+	return nil
+}
+
+func (r transactionRecord) transaction() Transaction {
+	transaction := Transaction{
+		date:                 r.Date,
+		account:              r.Account,
+		accountID:            r.AccountID,
+		action:               r.Action,
+		actionModified:       r.ActionModified,
+		ticker:               r.Ticker,
+		optionContract:       r.OptionContract,
+		buySell:              r.BuySell,
+		optionContracts:      r.OptionContracts.String(),
+		shares:               r.Shares.String(),
+		price:                r.Price.String(),
+		proceeds:             r.Proceeds.String(),
+		costBasisShare:       r.CostBasisShare.String(),
+		costBasisBuyOrOption: r.CostBasisBuyOrOpt.String(),
+		costBasisTotal:       r.CostBasisTotal.String(),
+		realizedPL:           r.RealizedPL.String(),
+		commission:           r.Commission.String(),
+		commissionCurrency:   r.CommissionCurrency,
+		dividend:             r.Dividend.String(),
+		dividendType:         r.DividendType,
+		fee:                  r.Fee.String(),
+		currency:             r.Currency,
+		fxRateToBase:         r.FxRateToBase.String(),
+		forexBuyCurrency:     r.ForexBuyCurrency,
+		forexBuyAmount:       r.ForexBuyAmount.String(),
+		forexSellCurrency:    r.ForexSellCurrency,
+		forexSellAmount:      r.ForexSellAmount.String(),
+		forexRate:            r.ForexRate.String(),
+		multiplier:           r.Multiplier.String(),
+		accruedInterest:      r.AccruedInterest.String(),
+		mtmPL:                r.MtmPL.String(),
+		section1256:          r.Section1256,
+		value:                r.Value.String(),
+		acquiredDate:         r.AcquiredDate,
+		notes:                r.Notes,
+		codes:                r.Codes,
+		orderID:              r.OrderID,
+		strategy:             r.Strategy,
+		netDebitCredit:       r.NetDebitCredit.String(),
+	}
+	for _, fill := range r.Fills {
+		transaction.fills = append(transaction.fills, fill.transaction())
+	}
+	return transaction
+}
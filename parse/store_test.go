@@ -0,0 +1,176 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	statements, err := filepath.Glob("../testdata/input/*.csv")
+	require.NoError(t, err)
+	journal := NewJournal()
+	for _, statement := range statements {
+		journal.ReadTransactions(statement)
+	}
+	transactions := journal.ReadTransactions(statements[0])
+
+	storePath := filepath.Join(t.TempDir(), "journal.ndjson")
+	journal.WriteStore(storePath, transactions)
+	stored, err := journal.ReadStore(storePath)
+	require.NoError(t, err)
+	require.Len(t, stored, len(transactions))
+	require.Empty(t, MissingTransactions(stored, transactions))
+
+	// writing what was read gives the same store
+	written, err := os.ReadFile(storePath)
+	require.NoError(t, err)
+	journal.WriteStore(storePath, stored)
+	rewritten, err := os.ReadFile(storePath)
+	require.NoError(t, err)
+	require.Equal(t, string(written), string(rewritten))
+}
+
+func TestReadStoreMissing(t *testing.T) {
+	journal := NewJournal()
+	transactions, err := journal.ReadStore(filepath.Join(t.TempDir(), "journal.ndjson"))
+	require.NoError(t, err)
+	require.Empty(t, transactions)
+}
+
+func TestReadStoreInvalid(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "journal.ndjson")
+	require.NoError(t, os.WriteFile(storePath, []byte(`{"schemaVersion": 1, "type": "account"}`+"\n{\"type\": \n"), 0644))
+
+	journal := NewJournal()
+	_, err := journal.ReadStore(storePath)
+	require.EqualError(t, err, storePath+":2: unexpected end of JSON input")
+}
+
+func TestStoreStatementData(t *testing.T) {
+	journal := NewJournal()
+	journal.ReadTransactions("../testdata/input/1-dmc.csv")
+	transactions := journal.ReadTransactions("../testdata/input/26-forex-cad-base.csv")
+	storePath := filepath.Join(t.TempDir(), "journal.ndjson")
+	journal.WriteStore(storePath, transactions)
+
+	// the store has what the outputs need from the statements besides the transactions
+	stored := NewJournal()
+	transactions, err := stored.ReadStore(storePath)
+	require.NoError(t, err)
+	require.Equal(t, journal.Accounts(), stored.Accounts())
+	require.Equal(t, "CAD", stored.findAccount("U3045126").baseCurrency)
+	require.Equal(t, journal.instruments, stored.instruments)
+	require.Equal(t, "US71424F1057", stored.instrument("PR").securityID)
+	require.Equal(t, "1.3247", stored.fxRate("2023-06-21", "USD"))
+
+	path := filepath.Join(t.TempDir(), "transactions.ofx")
+	stored.ToOfx(transactions, path)
+	ofx, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(ofx), "<ACCTID>U3045126</ACCTID>")
+	require.Contains(t, string(ofx), "<CURDEF>CAD</CURDEF>")
+	require.Contains(t, string(ofx), "<UNIQUEID>71424F105</UNIQUEID>")
+
+	// importing a statement again doesn't repeat its exchange rates
+	stored.ReadTransactions("../testdata/input/26-forex-cad-base.csv")
+	stored.WriteStore(storePath, transactions)
+	rewritten := NewJournal()
+	_, err = rewritten.ReadStore(storePath)
+	require.NoError(t, err)
+	require.Len(t, rewritten.rates, 2)
+}
+
+func TestMergeTransactions(t *testing.T) {
+	fill := Transaction{date: "2023-06-05", account: "TFSA", action: "Trade", ticker: "TECK", orderID: "1", shares: "100", proceeds: "-4209", currency: "USD"}
+	fee := Transaction{date: "2023-06-05", account: "Margin", action: "Fee", fee: "-1.5", currency: "USD", notes: "NYSE"}
+	otherFee := Transaction{date: "2023-06-05", account: "Margin", action: "Fee", fee: "-1.50", currency: "USD", notes: "OPRA"}
+
+	merged, added, replaced := MergeTransactions([]Transaction{fill, fee}, []Transaction{fill, fill, fee, otherFee})
+	// the second identical fill and the fee with another description are new
+	require.Equal(t, 2, added)
+	require.Equal(t, 0, replaced)
+	require.Equal(t, []Transaction{fill, fee, otherFee, fill}, merged)
+
+	merged, added, replaced = MergeTransactions(merged, []Transaction{fill, fee, otherFee})
+	require.Equal(t, 0, added)
+	require.Equal(t, 0, replaced)
+	require.Len(t, merged, 4)
+
+	// a fee corrected by a later statement replaces the one in the store
+	correctedFee := fee
+	correctedFee.fee = "-1.25"
+	merged, added, replaced = MergeTransactions(merged, []Transaction{correctedFee})
+	require.Equal(t, 0, added)
+	require.Equal(t, 1, replaced)
+	require.Equal(t, []Transaction{fill, correctedFee, otherFee, fill}, merged)
+}
+
+func TestImportStatements(t *testing.T) {
+	first := "../testdata/input/27-dividends-before-withholding.csv"
+	later := "../testdata/input/28-withholding-reversal-later-statement.csv"
+
+	// reads the store and the statements and merges them into the store like the import command
+	storePath := filepath.Join(t.TempDir(), "journal.ndjson")
+	importStatements := func(store []Transaction, statements ...string) ([]Transaction, []int) {
+		journal := NewJournal()
+		journal.WriteStore(storePath, store)
+		store, err := journal.ReadStore(storePath)
+		require.NoError(t, err)
+		var transactions []Transaction
+		for _, statement := range statements {
+			transactions = journal.ReadTransactions(statement)
+		}
+		store, removed := journal.RemoveReversedDividends(store)
+		store, added, replaced := MergeTransactions(store, transactions)
+		return store, []int{added, replaced, removed}
+	}
+	dividends := func(store []Transaction) []string {
+		var rows []string
+		for _, transaction := range sortedTransactions(store) {
+			rows = append(rows, strings.Join([]string{transaction.date, transaction.action, transaction.ticker, transaction.dividend, transaction.fee}, " "))
+		}
+		return rows
+	}
+
+	// the withholding tax of the later statement is netted into the dividend of the first one, the reversed dividend
+	// is netted out against its reversal, each transaction is stored once
+	store, counts := importStatements(nil, first, later)
+	require.Equal(t, []int{2, 0, 0}, counts)
+	require.Equal(t, []string{
+		"2023-06-08 Dividend MSFT 68 -10.2",
+		"2023-06-20 Dividend KO 47 -7.05",
+	}, dividends(store))
+
+	// importing the statements again doesn't change the store
+	store, counts = importStatements(store, first, later)
+	require.Equal(t, []int{0, 0, 0}, counts)
+	require.Len(t, store, 2)
+
+	// the statements imported one at a time: the dividend imported first is refreshed with its withholding tax and
+	// removed when it's reversed
+	store, _ = importStatements(nil, first)
+	require.Equal(t, []string{
+		"2023-06-08 Dividend MSFT 68 ",
+		"2023-06-15 Dividend KO 46 -6.9",
+	}, dividends(store))
+	store, counts = importStatements(store, first, later)
+	require.Equal(t, []int{1, 1, 1}, counts)
+	require.Equal(t, []string{
+		"2023-06-08 Dividend MSFT 68 -10.2",
+		"2023-06-20 Dividend KO 47 -7.05",
+	}, dividends(store))
+
+	// the later statement imported on its own: its withholding tax and reversal are netted into the dividends of the
+	// first statement in the store
+	store, _ = importStatements(nil, first)
+	store, counts = importStatements(store, later)
+	require.Equal(t, []int{1, 1, 1}, counts)
+	require.Equal(t, []string{
+		"2023-06-08 Dividend MSFT 68 -10.2",
+		"2023-06-20 Dividend KO 47 -7.05",
+	}, dividends(store))
+}
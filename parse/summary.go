@@ -0,0 +1,181 @@
+package parse
+
+import (
+	"sort"
+	"strings"
+)
+
+// PositionsTable lists the open positions with the account labels and currencies of the transactions that opened them.
+func PositionsTable(positions []Position, txs []Transaction) Table {
+	labels, currencies := accountLabels(txs), lotCurrencies(txs)
+	table := Table{
+		header:  []string{"Account", "Symbol", "Opened", "Quantity", "Cost Basis", "Cost Basis / Share", "Lots", "Currency"},
+		numbers: []bool{false, false, false, true, true, true, true, false},
+	}
+	for _, p := range positions {
+		costBasisPerShare := ""
+		if p.quantity != 0 && p.multiplier != 0 {
+			costBasisPerShare = formatAmount(p.costBasis/(p.quantity*p.multiplier), 4)
+		}
+		table.rows = append(table.rows, []string{
+			labels.of(p.account),
+			p.symbol,
+			p.openDate,
+			plainNumber(p.quantity),
+			formatAmount(p.costBasis, 2),
+			costBasisPerShare,
+			plainNumber(float64(p.lots)),
+			currencies[p.account+" "+p.symbol],
+		})
+	}
+	return table
+}
+
+// ClosedBetween returns the lots closed from one date to another (inclusive), a blank date has no limit.
+func (l *Ledger) ClosedBetween(from string, to string) []Lot {
+	var closed []Lot
+	for _, lot := range l.closed {
+		if (from == "" || lot.closeDate >= from) && (to == "" || lot.closeDate <= to) {
+			closed = append(closed, lot)
+		}
+	}
+	sort.SliceStable(closed, func(a, b int) bool { return closed[a].closeDate < closed[b].closeDate })
+	return closed
+}
+
+// PnlTable lists the closed lots with their realized P/L, followed by the total of each account and currency.
+func PnlTable(lots []Lot, txs []Transaction) Table {
+	labels, currencies := accountLabels(txs), lotCurrencies(txs)
+	table := Table{
+		header:  []string{"Account", "Symbol", "Opened", "Closed", "Quantity", "Cost Basis", "Proceeds", "Realized P/L", "Currency"},
+		numbers: []bool{false, false, false, false, true, true, true, true, false},
+	}
+	totals := make(summaryTotals)
+	for _, lot := range lots {
+		currency := currencies[lot.account+" "+lot.symbol]
+		table.rows = append(table.rows, []string{
+			labels.of(lot.account),
+			lot.symbol,
+			lot.date,
+			lot.closeDate,
+			plainNumber(lot.quantity),
+			formatAmount(lot.costBasis, 2),
+			formatAmount(lot.proceeds, 2),
+			formatAmount(lot.realizedPL, 2),
+			currency,
+		})
+		table.colours = append(table.colours, []string{7: gainLossColour(plainNumber(lot.realizedPL))})
+		totals.add(labels.of(lot.account), currency, lot.costBasis, lot.proceeds, lot.realizedPL)
+	}
+	for _, total := range totals.sorted() {
+		table.rows = append(table.rows, []string{total.account, "Total", "", "", "",
+			formatAmount(total.amounts[0], 2), formatAmount(total.amounts[1], 2), formatAmount(total.amounts[2], 2), total.currency})
+		table.colours = append(table.colours, []string{7: gainLossColour(plainNumber(total.amounts[2]))})
+	}
+	return table
+}
+
+// Dividends returns the dividends and the withholding tax that didn't match a dividend.
+func Dividends(txs []Transaction) []Transaction {
+	var dividends []Transaction
+	for _, tx := range sortedTransactions(txs) {
+		if tx.action == "Dividend" || tx.action == "Withholding Tax" {
+			dividends = append(dividends, tx)
+		}
+	}
+	return dividends
+}
+
+// DividendsTable lists the dividends with their withholding tax, followed by the total of each account and currency.
+func DividendsTable(txs []Transaction) Table {
+	table := Table{
+		header:  []string{"Date", "Account", "Ticker", "Type", "Dividend", "Withholding Tax", "Net", "Currency"},
+		numbers: []bool{false, false, false, false, true, true, true, false},
+	}
+	totals := make(summaryTotals)
+	for _, tx := range Dividends(txs) {
+		dividendType := tx.dividendType
+		if tx.action == "Withholding Tax" {
+			dividendType = tx.action
+		}
+		dividend, tax := parseAmount(tx.dividend), parseAmount(tx.fee)
+		table.rows = append(table.rows, []string{
+			tx.date,
+			tx.account,
+			tx.ticker,
+			dividendType,
+			formatAmount(dividend, 2),
+			formatAmount(tax, 2),
+			formatAmount(dividend+tax, 2),
+			tx.currency,
+		})
+		totals.add(tx.account, tx.currency, dividend, tax, dividend+tax)
+	}
+	for _, total := range totals.sorted() {
+		table.rows = append(table.rows, []string{"", total.account, "Total", "",
+			formatAmount(total.amounts[0], 2), formatAmount(total.amounts[1], 2), formatAmount(total.amounts[2], 2), total.currency})
+	}
+	return table
+}
+
+// summaryTotals sums up amounts by account and currency.
+type summaryTotals map[string]*summaryTotal
+
+type summaryTotal struct {
+	account  string
+	currency string
+	amounts  [3]float64
+}
+
+func (s summaryTotals) add(account string, currency string, amounts ...float64) {
+	key := account + " " + currency
+	if s[key] == nil {
+		s[key] = &summaryTotal{account: account, currency: currency}
+	}
+	for i, amount := range amounts {
+		s[key].amounts[i] += amount
+	}
+}
+
+func (s summaryTotals) sorted() []*summaryTotal {
+	var totals []*summaryTotal
+	for _, total := range s {
+		totals = append(totals, total)
+	}
+	sort.Slice(totals, func(a, b int) bool {
+		return totals[a].account+" "+totals[a].currency < totals[b].account+" "+totals[b].currency
+	})
+	return totals
+}
+
+// labels are the account aliases by account ID as shown in the journal.
+type labels map[string]string
+
+// accountLabels returns the account labels of the transactions.
+func accountLabels(txs []Transaction) labels {
+	accountLabels := make(labels)
+	for _, tx := range txs {
+		accountLabels[tx.accountID] = tx.account
+	}
+	return accountLabels
+}
+
+// of returns the account's label, the ID when the account isn't in the transactions.
+func (l labels) of(accountID string) string {
+	if l[accountID] != "" {
+		return l[accountID]
+	}
+	return accountID
+}
+
+// lotCurrencies returns the currency each symbol was traded in by account ID and symbol, e.g. "U1234567 TECK": "USD".
+// Lots don't have a currency.
+func lotCurrencies(txs []Transaction) map[string]string {
+	currencies := make(map[string]string)
+	for _, tx := range txs {
+		if symbol := securitySymbol(tx); symbol != "" && strings.HasPrefix(tx.action, "Trade") {
+			currencies[tx.accountID+" "+symbol] = tx.currency
+		}
+	}
+	return currencies
+}
@@ -0,0 +1,38 @@
+package parse
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDividendsTable(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/4-dividend-withholding-tax.csv")
+
+	var out bytes.Buffer
+	DividendsTable(transactions).WriteCsv(&out)
+	require.Equal(t, `Date,Account,Ticker,Type,Dividend,Withholding Tax,Net,Currency
+2023-06-09,Margin,SMG,Payment in Lieu,66.00,-9.90,56.10,USD
+,Margin,Total,,66.00,-9.90,56.10,USD
+`, out.String())
+}
+
+func TestPnlTable(t *testing.T) {
+	journal := NewJournal()
+	journal.ReadTransactions("../testdata/input/1-dmc.csv")
+	// the collar's options expire before the dividend
+	transactions := journal.ReadTransactions("../testdata/input/2-dividend.csv")
+	ledger := NewLedger()
+	ledger.Apply(transactions)
+
+	var out bytes.Buffer
+	PnlTable(ledger.ClosedBetween("2023-01-01", ""), transactions).WriteCsv(&out)
+	require.Equal(t, `Account,Symbol,Opened,Closed,Quantity,Cost Basis,Proceeds,Realized P/L,Currency
+TFSA,PR 20JAN23 5 P,2022-11-25,2023-01-20,6,32.98,0.00,-32.98,USD
+TFSA,PR 20JAN23 9 C,2022-11-25,2023-01-20,-6,"-1,179.98",0.00,"1,179.98",USD
+TFSA,Total,,,,"-1,147.00",0.00,"1,147.00",USD
+`, out.String())
+	require.Empty(t, ledger.ClosedBetween("", "2022-12-31"))
+}
@@ -0,0 +1,243 @@
+package parse
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	green = "\x1b[32m"
+	red   = "\x1b[31m"
+	reset = "\x1b[0m"
+)
+
+// tableColumn is a column of the transaction summary, columns without any values are left out.
+type tableColumn struct {
+	name   string
+	number bool // right aligned, never truncated
+	value  func(t Transaction) string
+	colour func(t Transaction) string // e.g. green for buys and gains, blank for no colour
+}
+
+var tableColumns = []tableColumn{
+	{name: "Date", value: func(t Transaction) string { return t.date }},
+	{name: "Account", value: func(t Transaction) string { return t.account }},
+	{name: "Action", value: func(t Transaction) string {
+		if t.actionModified != "" {
+			return t.actionModified
+		}
+		return t.action
+	}, colour: buySellColour},
+	{name: "Symbol", value: func(t Transaction) string {
+		if t.action == "Forex" {
+			return t.forexBuyCurrency + "." + t.forexSellCurrency
+		}
+		symbol, _ := tradedSymbol(t)
+		return symbol
+	}},
+	{name: "Quantity", number: true, value: func(t Transaction) string {
+		if t.optionContracts != "" {
+			return t.optionContracts
+		}
+		return t.shares
+	}, colour: buySellColour},
+	{name: "Price", number: true, value: func(t Transaction) string { return t.price }},
+	{name: "Proceeds", number: true, value: func(t Transaction) string { return t.proceeds }},
+	{name: "Commission", number: true, value: func(t Transaction) string { return t.commission }},
+	{name: "Dividend", number: true, value: func(t Transaction) string { return t.dividend }},
+	{name: "Fee", number: true, value: func(t Transaction) string { return t.fee }},
+	{name: "Realized P/L", number: true, value: func(t Transaction) string { return t.realizedPL }, colour: func(t Transaction) string {
+		return gainLossColour(t.realizedPL)
+	}},
+	{name: "Currency", value: func(t Transaction) string { return t.currency }},
+	{name: "Notes", value: func(t Transaction) string { return strings.ReplaceAll(t.notes, "\n", "; ") }},
+}
+
+// Table is a summary with a header row, written with aligned columns for the terminal, as Markdown or as CSV.
+type Table struct {
+	header  []string
+	numbers []bool // right aligned columns, never truncated
+	rows    [][]string
+	colours [][]string // colour of each cell, blank for no colour
+}
+
+// WriteTable writes the transactions as a table with aligned columns for reading in a terminal, sorted by date.
+// Text columns are truncated to fit the width (0 for no limit), colour shows buys / sells and gains / losses.
+func WriteTable(w io.Writer, txs []Transaction, width int, colour bool) {
+	TransactionsTable(txs).WriteText(w, width, colour)
+}
+
+// WriteMarkdown writes the transactions as a Markdown table, sorted by date.
+func WriteMarkdown(w io.Writer, txs []Transaction) {
+	TransactionsTable(txs).WriteMarkdown(w)
+}
+
+// TransactionsTable has a row for each transaction sorted by date and the columns that have values.
+func TransactionsTable(txs []Transaction) Table {
+	sorted := sortedTransactions(txs)
+	var columns []tableColumn
+	for _, column := range tableColumns {
+		for _, tx := range sorted {
+			if column.value(tx) != "" {
+				columns = append(columns, column)
+				break
+			}
+		}
+	}
+
+	var table Table
+	for _, column := range columns {
+		table.header = append(table.header, column.name)
+		table.numbers = append(table.numbers, column.number)
+	}
+	for _, tx := range sorted {
+		row, colours := make([]string, len(columns)), make([]string, len(columns))
+		for c, column := range columns {
+			row[c] = column.value(tx)
+			if column.colour != nil {
+				colours[c] = column.colour(tx)
+			}
+		}
+		table.rows = append(table.rows, row)
+		table.colours = append(table.colours, colours)
+	}
+	return table
+}
+
+// WriteText writes the table with aligned columns, text columns are truncated to fit the width (0 for no limit).
+func (t Table) WriteText(w io.Writer, width int, colour bool) {
+	widths := make([]int, len(t.header))
+	for c, name := range t.header {
+		widths[c] = utf8.RuneCountInString(name)
+		for _, row := range t.rows {
+			if n := utf8.RuneCountInString(row[c]); n > widths[c] {
+				widths[c] = n
+			}
+		}
+	}
+	// shrink the widest text columns until the table fits
+	const minWidth, separator = 8, 2
+	for width > 0 {
+		total := separator * (len(widths) - 1)
+		widest := -1
+		for c, w := range widths {
+			total += w
+			if !t.numbers[c] && w > minWidth && (widest < 0 || w > widths[widest]) {
+				widest = c
+			}
+		}
+		if total <= width || widest < 0 {
+			break
+		}
+		widths[widest]--
+	}
+
+	line := func(cells []string, colours []string) {
+		var out strings.Builder
+		for c, cell := range cells {
+			if c > 0 {
+				out.WriteString(strings.Repeat(" ", separator))
+			}
+			cell = truncate(cell, widths[c])
+			padding := strings.Repeat(" ", widths[c]-utf8.RuneCountInString(cell))
+			if colour && colours != nil && colours[c] != "" {
+				cell = colours[c] + cell + reset
+			}
+			if t.numbers[c] {
+				out.WriteString(padding + cell)
+			} else {
+				out.WriteString(cell + padding)
+			}
+		}
+		fmt.Fprintln(w, strings.TrimRight(out.String(), " "))
+	}
+
+	var rule []string
+	for c := range t.header {
+		rule = append(rule, strings.Repeat("-", widths[c]))
+	}
+	line(t.header, nil)
+	line(rule, nil)
+	for r, row := range t.rows {
+		var colours []string
+		if r < len(t.colours) {
+			colours = t.colours[r]
+		}
+		line(row, colours)
+	}
+}
+
+// WriteMarkdown writes the table as a Markdown table with the number columns right aligned.
+func (t Table) WriteMarkdown(w io.Writer) {
+	escape := func(cells []string) string {
+		escaped := make([]string, len(cells))
+		for c, cell := range cells {
+			escaped[c] = strings.ReplaceAll(cell, "|", `\|`)
+		}
+		return "| " + strings.Join(escaped, " | ") + " |"
+	}
+
+	var alignment []string
+	for c := range t.header {
+		if t.numbers[c] {
+			alignment = append(alignment, "---:")
+		} else {
+			alignment = append(alignment, "---")
+		}
+	}
+	fmt.Fprintln(w, escape(t.header))
+	fmt.Fprintln(w, "| "+strings.Join(alignment, " | ")+" |")
+	for _, row := range t.rows {
+		fmt.Fprintln(w, escape(row))
+	}
+}
+
+// WriteCsv writes the table as CSV with the header row.
+func (t Table) WriteCsv(w io.Writer) {
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(append([][]string{t.header}, t.rows...)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// sortedTransactions returns a copy of the transactions sorted by date.
+func sortedTransactions(txs []Transaction) []Transaction {
+	sorted := append([]Transaction{}, txs...)
+	sortTransactions(sorted)
+	return sorted
+}
+
+func buySellColour(t Transaction) string {
+	switch {
+	case t.buySell == "Buy":
+		return green
+	case t.buySell == "Sell":
+		return red
+	}
+	return ""
+}
+
+func gainLossColour(amount string) string {
+	switch {
+	case amount == "":
+		return ""
+	case parseAmount(amount) > 0:
+		return green
+	case parseAmount(amount) < 0:
+		return red
+	}
+	return ""
+}
+
+// truncate shortens the text to the width, ending it with … when it was cut.
+func truncate(text string, width int) string {
+	if utf8.RuneCountInString(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:width-1]) + "…"
+}
@@ -0,0 +1,55 @@
+package parse
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var tableTransactions = []Transaction{
+	{date: "2023-06-08", account: "TFSA", accountID: "U1234567", action: "Trade", actionModified: "Trade - Close", ticker: "BBWI", buySell: "Sell", shares: "-100", price: "41.44", proceeds: "4144.00", commission: "-0.52", realizedPL: "326.48", currency: "USD", notes: "hit GTC target"},
+	{date: "2023-06-05", account: "TFSA", accountID: "U1234567", action: "Trade - Option", ticker: "BBWI", optionContract: "16JUN23 35 C", buySell: "Buy", optionContracts: "1", price: "6.53", proceeds: "-653.00", commission: "-1.05", currency: "USD", notes: "roll | up"},
+}
+
+func TestWriteTable(t *testing.T) {
+	var out bytes.Buffer
+	WriteTable(&out, tableTransactions, 0, false)
+	require.Equal(t, `Date        Account  Action          Symbol             Quantity  Price  Proceeds  Commission  Realized P/L  Currency  Notes
+----------  -------  --------------  -----------------  --------  -----  --------  ----------  ------------  --------  --------------
+2023-06-05  TFSA     Trade - Option  BBWI 16JUN23 35 C         1   6.53   -653.00       -1.05                USD       roll | up
+2023-06-08  TFSA     Trade - Close   BBWI                   -100  41.44   4144.00       -0.52        326.48  USD       hit GTC target
+`, out.String())
+}
+
+func TestWriteTableWidth(t *testing.T) {
+	var out bytes.Buffer
+	WriteTable(&out, tableTransactions, 120, false)
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		require.LessOrEqual(t, len([]rune(line)), 120, line)
+	}
+	require.Contains(t, out.String(), "BBWI 16JUN…")
+	// numbers are never truncated
+	require.Contains(t, out.String(), "4144.00")
+}
+
+func TestWriteTableColour(t *testing.T) {
+	var out bytes.Buffer
+	WriteTable(&out, tableTransactions, 0, true)
+	require.Contains(t, out.String(), green+"Trade - Option"+reset)
+	require.Contains(t, out.String(), red+"-100"+reset)
+	require.Contains(t, out.String(), green+"326.48"+reset)
+	// colour doesn't change the alignment
+	require.Contains(t, out.String(), "   "+red+"-100"+reset+"  41.44")
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var out bytes.Buffer
+	WriteMarkdown(&out, tableTransactions)
+	require.Equal(t, `| Date | Account | Action | Symbol | Quantity | Price | Proceeds | Commission | Realized P/L | Currency | Notes |
+| --- | --- | --- | --- | ---: | ---: | ---: | ---: | ---: | --- | --- |
+| 2023-06-05 | TFSA | Trade - Option | BBWI 16JUN23 35 C | 1 | 6.53 | -653.00 | -1.05 |  | USD | roll \| up |
+| 2023-06-08 | TFSA | Trade - Close | BBWI | -100 | 41.44 | 4144.00 | -0.52 | 326.48 | USD | hit GTC target |
+`, out.String())
+}
@@ -0,0 +1,74 @@
+package parse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate checks the transactions for problems that would make the journal wrong, e.g. a trade without a quantity
+// or the same transaction twice, and returns a description of each problem.
+func Validate(txs []Transaction) []string {
+	var problems []string
+	problem := func(tx Transaction, format string, args ...any) {
+		problems = append(problems, fmt.Sprintf("%s %s %s: %s", tx.date, tx.account, narration(tx), fmt.Sprintf(format, args...)))
+	}
+
+	seen := make(map[string]int)
+	for _, tx := range sortedTransactions(txs) {
+		if _, err := time.Parse("2006-01-02", tx.date); err != nil {
+			problem(tx, "invalid date %q", tx.date)
+		}
+		if tx.accountID == "" {
+			problem(tx, "no account")
+		}
+		if tx.currency == "" {
+			problem(tx, "no currency")
+		}
+		for name, amount := range map[string]string{"proceeds": tx.proceeds, "commission": tx.commission,
+			"dividend": tx.dividend, "fee": tx.fee, "price": tx.price, "shares": tx.shares} {
+			if amount != "" && !isNumber(amount) {
+				problem(tx, "%s %q isn't a number", name, amount)
+			}
+		}
+
+		switch {
+		case tx.action == "Forex":
+			if tx.forexBuyCurrency == "" || tx.forexSellCurrency == "" {
+				problem(tx, "forex without the currencies bought and sold")
+			}
+		case strings.HasPrefix(tx.action, "Trade"):
+			if _, quantity := tradedSymbol(tx); quantity == 0 {
+				problem(tx, "trade without a quantity")
+			}
+			if tx.ticker == "" {
+				problem(tx, "trade without a ticker")
+			}
+		case tx.action == "Dividend":
+			if tx.dividend == "" {
+				problem(tx, "dividend without an amount")
+			}
+		case tx.action == "Fee" || tx.action == "Withholding Tax":
+			if tx.fee == "" {
+				problem(tx, "%s without an amount", strings.ToLower(tx.action))
+			}
+		case tx.action == "Interest", tx.action == "Transfer", strings.HasPrefix(tx.action, "Corporate Action"):
+		default:
+			problem(tx, "unknown action %q", tx.action)
+		}
+
+		// identical fills of an order are expected, anything else is likely a statement imported twice
+		key := transactionKey(tx)
+		seen[key]++
+		if seen[key] == 2 && tx.orderID == "" {
+			problem(tx, "duplicate transaction")
+		}
+	}
+	return problems
+}
+
+func isNumber(amount string) bool {
+	_, err := strconv.ParseFloat(strings.ReplaceAll(amount, ",", ""), 64)
+	return err == nil
+}
@@ -0,0 +1,39 @@
+package parse
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateStatements(t *testing.T) {
+	statements, err := filepath.Glob("../testdata/input/*.csv")
+	require.NoError(t, err)
+	for _, statement := range statements {
+		journal := NewJournal()
+		require.Empty(t, Validate(journal.ReadTransactions(statement)), statement)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	fee := Transaction{date: "2023-06-05", account: "Margin", accountID: "U1234567", action: "Fee", fee: "-1.5", currency: "USD", notes: "NYSE"}
+	problems := Validate([]Transaction{
+		fee,
+		fee,
+		{date: "2023-06-31", account: "Margin", accountID: "U1234567", action: "Trade", ticker: "TECK", shares: "100", currency: "USD"},
+		{date: "2023-06-05", account: "Margin", accountID: "U1234567", action: "Trade", ticker: "TECK", currency: "USD"},
+		{date: "2023-06-05", account: "Margin", accountID: "U1234567", action: "Transfer", fee: "1,5x", currency: "USD"},
+		{date: "2023-06-05", account: "Margin", accountID: "U1234567", action: "Split", currency: "USD"},
+		{date: "2023-06-05", account: "Margin", action: "Dividend", ticker: "MSFT", dividend: "136"},
+	})
+	require.Equal(t, []string{
+		"2023-06-05 Margin Dividend MSFT: no account",
+		"2023-06-05 Margin Dividend MSFT: no currency",
+		"2023-06-05 Margin Fee - NYSE: duplicate transaction",
+		"2023-06-05 Margin Transfer: fee \"1,5x\" isn't a number",
+		"2023-06-05 Margin Split: unknown action \"Split\"",
+		"2023-06-05 Margin Trade TECK: trade without a quantity",
+		"2023-06-31 Margin Trade TECK: invalid date \"2023-06-31\"",
+	}, problems)
+}
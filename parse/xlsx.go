@@ -0,0 +1,471 @@
+package parse
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cellStyles are the indexes of the column types in the cellXfs of xlsxStyles.
+var cellStyles = map[string]int{
+	"":         0,
+	"text":     0,
+	"number":   0,
+	"date":     1,
+	"currency": 2,
+	"perShare": 3,
+}
+
+const headerStyle = 4
+
+// xlsxStyles has the number formats of the column types: dates, currency amounts with 2 decimals and per share
+// amounts (e.g. cost basis per share) with 2 to 8 decimals.
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="3">
+<numFmt numFmtId="164" formatCode="yyyy-mm-dd"/>
+<numFmt numFmtId="165" formatCode="#,##0.00"/>
+<numFmt numFmtId="166" formatCode="#,##0.00######"/>
+</numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="5">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="166" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+</cellXfs>
+</styleSheet>`
+
+// ToXlsx writes the transactions to an Excel workbook with the columns of the journal's layout, one sheet per account.
+// Each sheet starts with a frozen header row, numbers and dates are written as typed cells so they can be summed and
+// sorted without converting them.
+func (j *Journal) ToXlsx(txs []Transaction, xlsxPath string) {
+	layout := j.journalLayout()
+	layout.Header = false
+
+	sheets := make(map[string][][]string)
+	names, accounts := accountSheets(txs)
+	for _, name := range names {
+		sheets[name] = layout.rows(accounts[name])
+	}
+	writeXlsx(xlsxPath, layout, names, sheets)
+}
+
+// AppendXlsx adds the transactions to an existing journal workbook the same way AppendCsv does, creating it if it
+// doesn't exist. Sheets of accounts without new transactions are kept as they are.
+func (j *Journal) AppendXlsx(txs []Transaction, xlsxPath string) {
+	layout := j.journalLayout()
+	names, sheets := readXlsx(xlsxPath, layout)
+
+	newNames, accounts := accountSheets(txs)
+	for _, name := range newNames {
+		if _, ok := sheets[name]; !ok {
+			names = append(names, name)
+		}
+		sheets[name] = layout.merge(sheets[name], accounts[name])
+	}
+	writeXlsx(xlsxPath, layout, names, sheets)
+}
+
+// accountSheets groups the transactions by account, by sheet name sorted by account.
+func accountSheets(txs []Transaction) ([]string, map[string][]Transaction) {
+	byAccount := make(map[string][]Transaction)
+	var accounts []string
+	for _, tx := range txs {
+		if _, ok := byAccount[tx.account]; !ok {
+			accounts = append(accounts, tx.account)
+		}
+		byAccount[tx.account] = append(byAccount[tx.account], tx)
+	}
+	sort.Strings(accounts)
+
+	var names []string
+	sheets := make(map[string][]Transaction)
+	for _, account := range accounts {
+		name := sheetName(account, names)
+		names = append(names, name)
+		sheets[name] = byAccount[account]
+	}
+	return names, sheets
+}
+
+// writeXlsx writes the rows of each sheet below the layout's header row, in the order of the sheet names.
+func writeXlsx(xlsxPath string, layout Layout, names []string, sheets map[string][][]string) {
+	f, err := os.Create(xlsxPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	workbook := zip.NewWriter(f)
+	for i, name := range names {
+		writeZipFile(workbook, fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), worksheet(layout, sheets[name]))
+	}
+	if len(names) == 0 {
+		// a workbook needs at least one sheet
+		names = append(names, "Transactions")
+		writeZipFile(workbook, "xl/worksheets/sheet1.xml", worksheet(layout, nil))
+	}
+
+	writeZipFile(workbook, "[Content_Types].xml", contentTypes(len(names)))
+	writeZipFile(workbook, "_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`)
+	writeZipFile(workbook, "xl/workbook.xml", workbookXml(names))
+	writeZipFile(workbook, "xl/_rels/workbook.xml.rels", workbookRels(len(names)))
+	writeZipFile(workbook, "xl/styles.xml", xlsxStyles)
+
+	if err := workbook.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func writeZipFile(workbook *zip.Writer, name string, content string) {
+	w, err := workbook.Create(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := w.Write([]byte(content)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// worksheet writes the header row and the rows below it, with the header row frozen.
+func worksheet(layout Layout, rows [][]string) string {
+	var sheet strings.Builder
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>
+<sheetData>`)
+
+	sheet.WriteString(`<row r="1">`)
+	for c, column := range layout.Columns {
+		if column.Name != "" {
+			sheet.WriteString(stringCell(cellReference(c, 1), column.Name, headerStyle))
+		}
+	}
+	sheet.WriteString(`</row>`)
+
+	for r, row := range rows {
+		sheet.WriteString(fmt.Sprintf(`<row r="%d">`, r+2))
+		for c, value := range row {
+			if value == "" {
+				continue
+			}
+			sheet.WriteString(cell(cellReference(c, r+2), value, columnType(layout, c)))
+		}
+		sheet.WriteString(`</row>`)
+	}
+
+	sheet.WriteString(`</sheetData></worksheet>`)
+	return sheet.String()
+}
+
+// columnType is the type of the column's cells. Columns filled in by hand keep numbers as numbers.
+func columnType(layout Layout, c int) string {
+	if c >= len(layout.Columns) {
+		return "number"
+	}
+	column := layout.Columns[c]
+	if column.Type == "" && column.Field == "" && column.Expression == "" {
+		return "number"
+	}
+	return column.Type
+}
+
+// cell writes the value as a number or date when the column has that type and the value can be converted,
+// otherwise as text.
+func cell(reference string, value string, columnType string) string {
+	switch columnType {
+	case "date":
+		if date, err := time.Parse("2006-01-02", value); err == nil {
+			return numberCell(reference, strconv.Itoa(excelDate(date)), cellStyles[columnType])
+		}
+	case "number", "currency", "perShare":
+		// IBKR amounts have thousands separators e.g. 4,838.82
+		number := strings.ReplaceAll(value, ",", "")
+		if _, err := strconv.ParseFloat(number, 64); err == nil {
+			return numberCell(reference, number, cellStyles[columnType])
+		}
+	}
+	return stringCell(reference, value, 0)
+}
+
+func numberCell(reference string, value string, style int) string {
+	return fmt.Sprintf(`<c r="%s" s="%d"><v>%s</v></c>`, reference, style, value)
+}
+
+func stringCell(reference string, value string, style int) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(value))
+	return fmt.Sprintf(`<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`,
+		reference, style, escaped.String())
+}
+
+// excelDate converts the date to the number of days since 1899-12-30, which is how Excel stores dates.
+func excelDate(date time.Time) int {
+	return int(date.Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+}
+
+// cellReference converts a zero based column index and a row number to a cell reference e.g. 0, 1: A1 and 27, 2: AB2
+func cellReference(column int, row int) string {
+	name := ""
+	for column++; column > 0; column = (column - 1) / 26 {
+		name = string(rune('A'+(column-1)%26)) + name
+	}
+	return name + strconv.Itoa(row)
+}
+
+// sheetName makes the account name a valid and unique sheet name: at most 31 characters without []:*?/\
+func sheetName(account string, existing []string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, account)
+	if name == "" {
+		name = "Account"
+	}
+	if len(name) > 31 {
+		name = name[:31]
+	}
+
+	unique := name
+	for i := 2; contains(existing, unique); i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		unique = name
+		if len(unique)+len(suffix) > 31 {
+			unique = unique[:31-len(suffix)]
+		}
+		unique += suffix
+	}
+	return unique
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func contentTypes(sheets int) string {
+	var types strings.Builder
+	types.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+`)
+	for i := 1; i <= sheets; i++ {
+		types.WriteString(fmt.Sprintf(`<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+`, i))
+	}
+	types.WriteString(`</Types>`)
+	return types.String()
+}
+
+func workbookXml(sheets []string) string {
+	var workbook strings.Builder
+	workbook.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets>`)
+	for i, sheet := range sheets {
+		var name bytes.Buffer
+		xml.EscapeText(&name, []byte(sheet))
+		workbook.WriteString(fmt.Sprintf(`<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, name.String(), i+1, i+1))
+	}
+	workbook.WriteString(`</sheets></workbook>`)
+	return workbook.String()
+}
+
+// workbookRels relates the workbook to its sheets (rId1...rIdN) and styles (rIdN+1).
+func workbookRels(sheets int) string {
+	var rels strings.Builder
+	rels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+`)
+	for i := 1; i <= sheets; i++ {
+		rels.WriteString(fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>
+`, i, i))
+	}
+	rels.WriteString(fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`, sheets+1))
+	return rels.String()
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is an inline or shared string, which is split into runs when parts of it are formatted differently.
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	text := t.Text
+	for _, run := range t.Runs {
+		text += run.Text
+	}
+	return text
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Reference string   `xml:"r,attr"`
+			Type      string   `xml:"t,attr"`
+			Value     string   `xml:"v"`
+			Inline    xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXlsx reads the rows below the header row of each sheet in a journal workbook, written by ToXlsx and then
+// possibly saved by a spreadsheet. Dates in date columns are converted back to 2006-01-02.
+// A workbook that doesn't exist has no sheets.
+func readXlsx(xlsxPath string, layout Layout) ([]string, map[string][][]string) {
+	sheets := make(map[string][][]string)
+	reader, err := zip.OpenReader(xlsxPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, sheets
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer reader.Close()
+
+	files := make(map[string]*zip.File)
+	for _, f := range reader.File {
+		files[f.Name] = f
+	}
+	unmarshal := func(name string, v any) bool {
+		f := files[name]
+		if f == nil {
+			return false
+		}
+		r, err := f.Open()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer r.Close()
+		if err := xml.NewDecoder(r).Decode(v); err != nil {
+			panic(fmt.Sprintf("invalid workbook %s: %s %v", xlsxPath, name, err))
+		}
+		return true
+	}
+
+	var workbook xlsxWorkbook
+	var relationships xlsxRelationships
+	var sharedStrings xlsxSharedStrings
+	if !unmarshal("xl/workbook.xml", &workbook) || !unmarshal("xl/_rels/workbook.xml.rels", &relationships) {
+		panic(fmt.Sprintf("invalid workbook %s", xlsxPath))
+	}
+	unmarshal("xl/sharedStrings.xml", &sharedStrings)
+
+	targets := make(map[string]string)
+	for _, relationship := range relationships.Relationships {
+		target := strings.TrimPrefix(relationship.Target, "/")
+		if !strings.HasPrefix(target, "xl/") {
+			target = "xl/" + target
+		}
+		targets[relationship.ID] = target
+	}
+
+	var names []string
+	for _, sheet := range workbook.Sheets {
+		var worksheet xlsxWorksheet
+		if !unmarshal(targets[sheet.ID], &worksheet) {
+			panic(fmt.Sprintf("invalid workbook %s: no sheet %s", xlsxPath, sheet.Name))
+		}
+
+		var rows [][]string
+		for r, xlsxRow := range worksheet.Rows {
+			if r == 0 {
+				// header
+				continue
+			}
+			var row []string
+			for i, xlsxCell := range xlsxRow.Cells {
+				c := i
+				if xlsxCell.Reference != "" {
+					c = columnIndex(xlsxCell.Reference)
+				}
+				for len(row) <= c {
+					row = append(row, "")
+				}
+
+				switch xlsxCell.Type {
+				case "s":
+					index, err := strconv.Atoi(xlsxCell.Value)
+					if err != nil || index >= len(sharedStrings.Items) {
+						panic(fmt.Sprintf("invalid workbook %s: shared string %s", xlsxPath, xlsxCell.Value))
+					}
+					row[c] = sharedStrings.Items[index].String()
+				case "inlineStr":
+					row[c] = xlsxCell.Inline.String()
+				default:
+					row[c] = xlsxCell.Value
+				}
+
+				if c < len(layout.Columns) && layout.Columns[c].Type == "date" && xlsxCell.Type == "" {
+					if days, err := strconv.ParseFloat(row[c], 64); err == nil {
+						row[c] = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(days)).Format("2006-01-02")
+					}
+				}
+			}
+			rows = append(rows, row)
+		}
+		names = append(names, sheet.Name)
+		sheets[sheet.Name] = rows
+	}
+	return names, sheets
+}
+
+// columnIndex converts a cell reference to a zero based column index e.g. A1: 0, AB2: 27
+func columnIndex(reference string) int {
+	index := 0
+	for _, r := range reference {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A') + 1
+	}
+	return index - 1
+}
@@ -0,0 +1,97 @@
+package parse
+
+import (
+	"archive/zip"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToXlsx(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/14-multi-account.csv")
+
+	xlsxPath := filepath.Join(t.TempDir(), "transactions.xlsx")
+	journal.ToXlsx(transactions, xlsxPath)
+
+	reader, err := zip.OpenReader(xlsxPath)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	files := make(map[string]string)
+	for _, f := range reader.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+		files[f.Name] = string(content)
+	}
+
+	require.Contains(t, files, "[Content_Types].xml")
+	require.Contains(t, files, "xl/styles.xml")
+	// one sheet per account, sorted by account
+	require.Contains(t, files["xl/workbook.xml"], `<sheet name="RRSP" sheetId="1" r:id="rId1"/><sheet name="TFSA" sheetId="2" r:id="rId2"/>`)
+
+	rrsp := files["xl/worksheets/sheet1.xml"]
+	require.Contains(t, rrsp, `state="frozen"`)
+	require.Contains(t, rrsp, `<c r="A1" s="4" t="inlineStr"><is><t xml:space="preserve">Date</t></is></c>`)
+	// dates and amounts are typed cells
+	require.Contains(t, rrsp, `<c r="A2" s="1"><v>45085</v></c>`)
+	require.NotContains(t, rrsp, "TFSA")
+	require.NotContains(t, files["xl/worksheets/sheet2.xml"], "RRSP")
+}
+
+func TestToXlsxForex(t *testing.T) {
+	journal := NewJournal()
+	transactions := journal.ReadTransactions("../testdata/input/16-forex-usd-cad.csv")
+
+	xlsxPath := filepath.Join(t.TempDir(), "forex.xlsx")
+	journal.ToXlsx(transactions, xlsxPath)
+
+	reader, err := zip.OpenReader(xlsxPath)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	var sheet string
+	for _, f := range reader.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		r, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+		sheet = string(content)
+	}
+
+	// the forex sell amount of -2,000 is a number, not text
+	require.Contains(t, sheet, `<c r="AC2" s="2"><v>-2000</v></c>`)
+	require.NotContains(t, sheet, "-2,000")
+}
+
+func TestXlsxCell(t *testing.T) {
+	require.Equal(t, `<c r="N2" s="2"><v>-4607.00</v></c>`, cell("N2", "-4607.00", "currency"))
+	require.Equal(t, `<c r="Q2" s="3"><v>46.08000000</v></c>`, cell("Q2", "46.08000000", "perShare"))
+	require.Equal(t, `<c r="M2" s="0"><v>100</v></c>`, cell("M2", "100", "number"))
+	require.Equal(t, `<c r="A2" s="1"><v>45082</v></c>`, cell("A2", "2023-06-05", "date"))
+	require.Equal(t, `<c r="AA2" s="2"><v>4838.82</v></c>`, cell("AA2", "4,838.82", "currency"))
+	require.Equal(t, `<c r="M2" s="0"><v>1000</v></c>`, cell("M2", "1,000", "number"))
+	// values that aren't numbers stay text
+	require.Equal(t, `<c r="AI2" s="0" t="inlineStr"><is><t xml:space="preserve">a &amp; b</t></is></c>`, cell("AI2", "a & b", "currency"))
+
+	require.Equal(t, 1, excelDate(time.Date(1899, 12, 31, 0, 0, 0, 0, time.UTC)))
+	require.Equal(t, "A1", cellReference(0, 1))
+	require.Equal(t, "Z3", cellReference(25, 3))
+	require.Equal(t, "AA3", cellReference(26, 3))
+	require.Equal(t, "AZ10", cellReference(51, 10))
+
+	require.Equal(t, "U1234567_2023", sheetName("U1234567/2023", nil))
+	require.Equal(t, "TFSA (2)", sheetName("TFSA", []string{"TFSA"}))
+	require.Len(t, sheetName(strings.Repeat("a", 40), nil), 31)
+}